@@ -59,15 +59,23 @@ func (c *BuildCommand) ParseArgs(args []string) (*BuildArgs, int) {
 	}
 
 	args = flags.Args()
-	if len(args) != 1 {
+	if len(args) == 0 {
 		flags.Usage()
 		return &cfg, 1
 	}
-	cfg.Path = args[0]
+	cfg.setPaths(args)
 	return &cfg, 0
 }
 
 func writeDiags(ui packersdk.Ui, files map[string]*hcl.File, diags hcl.Diagnostics) int {
+	if jsonUi, ok := ui.(*packer.JSONUi); ok {
+		jsonUi.Diagnostics(diags)
+		if diags.HasErrors() {
+			return 1
+		}
+		return 0
+	}
+
 	// write HCL errors/diagnostics if any.
 	b := bytes.NewBuffer(nil)
 	err := hcl.NewDiagnosticTextWriter(b, files, 80, false).WriteDiagnostics(diags)
@@ -86,6 +94,10 @@ func writeDiags(ui packersdk.Ui, files map[string]*hcl.File, diags hcl.Diagnosti
 }
 
 func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int {
+	if cla.Output == "json" {
+		c.Ui = &packer.JSONUi{Writer: c.uiWriter()}
+	}
+
 	packerStarter, ret := c.GetConfig(&cla.MetaArgs)
 	if ret != 0 {
 		return ret
@@ -97,7 +109,10 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 		return ret
 	}
 
-	diags = packerStarter.Initialize(packer.InitializeOptions{})
+	diags = packerStarter.Initialize(packer.InitializeOptions{
+		DatasourceParallelism: cla.DatasourceParallelism,
+		RefreshDatasources:    cla.RefreshDatasources,
+	})
 	ret = writeDiags(c.Ui, nil, diags)
 	if ret != 0 {
 		return ret
@@ -141,6 +156,36 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 		c.Ui.Say("Debug mode enabled. Builds will not be parallelized.")
 	}
 
+	var buildState *packer.BuildStateFile
+	if cla.Resume != "" {
+		buildState, err = packer.LoadBuildStateFile(cla.Resume)
+		if err != nil {
+			return writeDiags(c.Ui, nil, hcl.Diagnostics{
+				&hcl.Diagnostic{
+					Summary:  "Failed to load build state file",
+					Severity: hcl.DiagError,
+					Detail:   err.Error(),
+				},
+			})
+		}
+		for _, b := range builds {
+			if cb, ok := b.(*packer.CoreBuild); ok {
+				cb.State = buildState.Build(cb.Name())
+			}
+		}
+	}
+
+	// -build-timeout applies to all the builds, unless their own timeout is
+	// shorter.
+	if cla.BuildTimeout > 0 {
+		for _, b := range builds {
+			cb, ok := b.(*packer.CoreBuild)
+			if ok && (cb.Timeout == 0 || cla.BuildTimeout < cb.Timeout) {
+				cb.Timeout = cla.BuildTimeout
+			}
+		}
+	}
+
 	// Compile all the UIs for the builds
 	colors := [5]packer.UiColor{
 		packer.UiColorGreen,
@@ -150,8 +195,15 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 		packer.UiColorBlue,
 	}
 	buildUis := make(map[packersdk.Build]packersdk.Ui)
+	_, jsonOutput := c.Ui.(*packer.JSONUi)
 	for i := range builds {
 		ui := c.Ui
+		if jsonOutput {
+			// JSON events are neither colored nor prefixed, they have their
+			// own timestamp.
+			buildUis[builds[i]] = ui
+			continue
+		}
 		if cla.Color {
 			// Only set up UI colors if -machine-readable isn't set.
 			if _, ok := c.Ui.(*packer.MachineReadableUi); !ok {
@@ -207,6 +259,48 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 	}{m: make(map[string]error)}
 	limitParallel := semaphore.NewWeighted(cla.ParallelBuilds)
 
+	// Builds depending on other builds are started after them, and wait for
+	// them to complete before running.
+	dependencies := newBuildDependencies(builds)
+	builds = dependencies.sort(builds)
+
+	// Builds that did not change since they last completed successfully are
+	// skipped, the artifacts of that run are reused. With -force, all the
+	// builds run, their results replacing the cached ones. Builds are never
+	// skipped when the template publishes to HCP Packer, as a skipped build
+	// would not be recorded in the version being built.
+	var buildCache *packer.BuildCache
+	fingerprints := map[packersdk.Build]string{}
+	cachedArtifacts := map[packersdk.Build][]packersdk.Artifact{}
+	if cla.CacheDir != "" {
+		buildCache = &packer.BuildCache{Dir: cla.CacheDir}
+		if c.CoreConfig != nil {
+			buildCache.Plugins = c.CoreConfig.Components.PluginConfig
+		}
+		lookup := true
+		switch {
+		case cla.Force:
+			lookup = false
+		case registry.IsHCPEnabled(packerStarter):
+			log.Printf("[INFO] HCP Packer is enabled, builds are not skipped by the build cache")
+			lookup = false
+		}
+		for _, b := range builds {
+			fingerprint, err := buildCache.Fingerprint(b)
+			if err != nil {
+				log.Printf("[INFO] build %q will not be cached: %s", b.Name(), err)
+				continue
+			}
+			fingerprints[b] = fingerprint
+			if !lookup {
+				continue
+			}
+			if cached, found := buildCache.Lookup(fingerprint); found {
+				cachedArtifacts[b] = cached
+			}
+		}
+	}
+
 	var hasPossibleIncompatibleHCPIntegration bool
 	for i := range builds {
 		if err := buildCtx.Err(); err != nil {
@@ -229,19 +323,49 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 
 		// Run the build in a goroutine
 		go func() {
-			// Get the start of the build
-			buildStart := time.Now()
-
 			defer wg.Done()
 
 			defer limitParallel.Release(1)
 
-			err := hcpRegistry.StartBuild(buildCtx, b)
+			var runArtifacts []packersdk.Artifact
+			var err error
+			defer func() { dependencies.complete(b, runArtifacts, err) }()
+
+			var warnings []string
+			warnings, err = dependencies.wait(buildCtx, b)
+			for _, warning := range warnings {
+				ui.Say(fmt.Sprintf("Warning: %s", warning))
+			}
+			if err != nil {
+				ui.Error(fmt.Sprintf("Build '%s' cannot start: %s", name, err))
+				errs.Lock()
+				errs.m[name] = err
+				errs.Unlock()
+				return
+			}
+
+			if cached, found := cachedArtifacts[b]; found {
+				ui.Say(fmt.Sprintf("Build '%s' did not change since it last "+
+					"completed successfully, reusing its artifacts.", name))
+				runArtifacts = cached
+				artifacts.Lock()
+				artifacts.m[name] = cached
+				artifacts.Unlock()
+				return
+			}
+
+			// Get the start of the build
+			buildStart := time.Now()
+
+			err = hcpRegistry.StartBuild(buildCtx, b)
 			// Seems odd to require this error check here. Now that it is an error we can just exit with diag
 			if err != nil {
 				// If the build is already done, we skip without a warning
 				if errors.As(err, &registry.ErrBuildAlreadyDone{}) {
 					ui.Say(fmt.Sprintf("skipping already done build %q", name))
+					// The builds depending on it cannot run, as its
+					// artifacts are not known: they fail with this error.
+					err = fmt.Errorf("it was already done in HCP Packer, its artifacts are not known")
 					return
 				}
 				writeDiags(c.Ui, nil, hcl.Diagnostics{
@@ -256,12 +380,24 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 				return
 			}
 
+			machineUi := &packer.TargetedUI{
+				Target: name,
+				Ui:     ui,
+			}
+			machineUi.Machine("build-start")
+
 			log.Printf("Starting build run: %s", name)
-			runArtifacts, err := b.Run(buildCtx, ui)
+			runArtifacts, err = b.Run(buildCtx, ui)
 
 			// Get the duration of the build and parse it
 			buildEnd := time.Now()
 			buildDuration := buildEnd.Sub(buildStart)
+			machineErr := ""
+			if err != nil {
+				machineErr = err.Error()
+			}
+			machineUi.Machine("build-end",
+				strconv.FormatFloat(buildDuration.Seconds(), 'f', 3, 64), machineErr)
 			fmtBuildDuration := durafmt.Parse(buildDuration).LimitFirstN(2)
 
 			runArtifacts, hcperr := hcpRegistry.CompleteBuild(
@@ -289,6 +425,16 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 				errs.Unlock()
 			} else {
 				ui.Say(fmt.Sprintf("Build '%s' finished after %s.", name, fmtBuildDuration))
+				if buildState != nil {
+					if err := buildState.Forget(name); err != nil {
+						log.Printf("[WARN] failed to update build state file: %s", err)
+					}
+				}
+				if fingerprint, ok := fingerprints[b]; ok {
+					if err := buildCache.Store(fingerprint, name, runArtifacts); err != nil {
+						log.Printf("[WARN] failed to update build cache: %s", err)
+					}
+				}
 				if runArtifacts != nil {
 					artifacts.Lock()
 					artifacts.m[name] = runArtifacts
@@ -391,6 +537,21 @@ func (c *BuildCommand) RunContext(buildCtx context.Context, cla *BuildArgs) int
 		c.Ui.Say("\n==> Builds finished but no artifacts were created.")
 	}
 
+	outputs, diags := packerStarter.EvaluateOutputs(artifacts.m)
+	if writeDiags(c.Ui, nil, diags) != 0 {
+		ret = 1
+	}
+	if err := writeOutputs(c.Ui, outputs); err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to show outputs: %s", err))
+		ret = 1
+	}
+	if cla.OutputFile != "" {
+		if err := writeOutputFile(cla.OutputFile, outputs); err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to write output file %s: %s", cla.OutputFile, err))
+			ret = 1
+		}
+	}
+
 	if hasPossibleIncompatibleHCPIntegration {
 		msg := fmt.Sprintf(`
 It looks like one or more plugins in your build may be incompatible with HCP Packer.
@@ -410,24 +571,36 @@ Check that you are using an HCP Ready integration before trying again:
 
 func (*BuildCommand) Help() string {
 	helpText := `
-Usage: packer build [options] TEMPLATE
+Usage: packer build [options] TEMPLATE...
 
   Will execute multiple builds in parallel as defined in the template.
   The various artifacts created by the template will be outputted.
 
+  Several HCL2 templates, files or folders, can be given; they are merged
+  into one configuration.
+
 Options:
 
   -color=false                  Disable color output. (Default: color)
+  -build-timeout=duration       Stop the builds that did not complete after this duration, like 1h30m; a build block timeout can be shorter.
+  -cache-dir=path               Skip the builds that did not change since they last succeeded, reusing the artifacts recorded in this directory. With -force, or when publishing to HCP Packer, no build is skipped.
   -debug                        Debug mode enabled for builds.
   -except=foo,bar,baz           Run all builds and post-processors other than these.
   -only=foo,bar,baz             Build only the specified builds.
   -force                        Force a build to continue if artifacts exist, deletes existing artifacts.
   -machine-readable             Produce machine-readable output.
+  -mock-file=path               Use the outputs of the mock_data blocks of this file instead of executing data sources, can be used multiple times.
   -on-error=[cleanup|abort|ask|run-cleanup-provisioner] If the build fails do: clean up (default), abort, ask, or run-cleanup-provisioner.
+  -output=[text|json]           Output format; json outputs a stream of newline-delimited JSON events. (Default: text)
+  -output-file=path             Write the outputs of the template to this JSON file once the builds completed.
   -parallel-builds=1            Number of builds to run in parallel. 1 disables parallelization. 0 means no limit (Default: 0)
+  -parallel-datasources=1       Number of data sources to evaluate in parallel. 0 means no limit (Default: 0)
+  -refresh-datasources          Execute the data sources whose outputs are cached again, refreshing their cache.
+  -resume=path                  Record build progress in this state file and skip the steps a previous failed run completed; steps are only skipped for builders re-attaching to an existing machine, like null.
   -timestamp-ui                 Enable prefixing of each ui output with an RFC3339 timestamp.
   -var 'key=value'              Variable for templates, can be used multiple times.
   -var-file=path                JSON or HCL2 file containing user variables, can be used multiple times.
+  -var-source=kind:path         Read variables from a json, yaml or dotenv file, or from the JSON output of an exec program; can be used multiple times.
   -warn-on-undeclared-var       Display warnings for user variable files containing undeclared variables.
 `
 
@@ -444,16 +617,25 @@ func (*BuildCommand) AutocompleteArgs() complete.Predictor {
 
 func (*BuildCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
-		"-color":            complete.PredictNothing,
-		"-debug":            complete.PredictNothing,
-		"-except":           complete.PredictNothing,
-		"-only":             complete.PredictNothing,
-		"-force":            complete.PredictNothing,
-		"-machine-readable": complete.PredictNothing,
-		"-on-error":         complete.PredictNothing,
-		"-parallel":         complete.PredictNothing,
-		"-timestamp-ui":     complete.PredictNothing,
-		"-var":              complete.PredictNothing,
-		"-var-file":         complete.PredictNothing,
+		"-build-timeout":        complete.PredictNothing,
+		"-cache-dir":            complete.PredictDirs("*"),
+		"-color":                complete.PredictNothing,
+		"-debug":                complete.PredictNothing,
+		"-except":               complete.PredictNothing,
+		"-only":                 complete.PredictNothing,
+		"-force":                complete.PredictNothing,
+		"-machine-readable":     complete.PredictNothing,
+		"-on-error":             complete.PredictNothing,
+		"-output":               complete.PredictSet("text", "json"),
+		"-output-file":          complete.PredictFiles("*.json"),
+		"-parallel":             complete.PredictNothing,
+		"-resume":               complete.PredictFiles("*"),
+		"-timestamp-ui":         complete.PredictNothing,
+		"-mock-file":            complete.PredictFiles("*.hcl"),
+		"-parallel-datasources": complete.PredictNothing,
+		"-refresh-datasources":  complete.PredictNothing,
+		"-var":                  complete.PredictNothing,
+		"-var-file":             complete.PredictNothing,
+		"-var-source":           complete.PredictNothing,
 	}
 }
@@ -0,0 +1,129 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+// buildDependencies keeps track of the builds that have to complete before
+// other builds can start, as set with `depends_on` in build blocks, and hands
+// over the artifacts of upstream builds to the builds depending on them.
+type buildDependencies struct {
+	// byBlock lists the builds of each build block, by build block name.
+	byBlock map[string][]packersdk.Build
+	done    map[packersdk.Build]chan struct{}
+
+	l         sync.Mutex
+	artifacts map[packersdk.Build][]packersdk.Artifact
+	// errs are the errors of the builds that did not complete successfully.
+	errs map[packersdk.Build]error
+}
+
+func newBuildDependencies(builds []packersdk.Build) *buildDependencies {
+	d := &buildDependencies{
+		byBlock:   map[string][]packersdk.Build{},
+		done:      map[packersdk.Build]chan struct{}{},
+		artifacts: map[packersdk.Build][]packersdk.Artifact{},
+		errs:      map[packersdk.Build]error{},
+	}
+	for _, b := range builds {
+		d.done[b] = make(chan struct{})
+		if cb, ok := b.(*packer.CoreBuild); ok && cb.BuildName != "" {
+			d.byBlock[cb.BuildName] = append(d.byBlock[cb.BuildName], b)
+		}
+	}
+	return d
+}
+
+// dependsOn returns the names of the build blocks b depends on.
+func dependsOn(b packersdk.Build) []string {
+	if cb, ok := b.(*packer.CoreBuild); ok {
+		return cb.DependsOn
+	}
+	return nil
+}
+
+// sort returns builds ordered so that every build comes after the builds it
+// depends on; builds are otherwise kept in their original order. Cycles are
+// reported when the config is parsed, so there can be none here.
+func (d *buildDependencies) sort(builds []packersdk.Build) []packersdk.Build {
+	res := make([]packersdk.Build, 0, len(builds))
+	added := map[packersdk.Build]bool{}
+	var add func(b packersdk.Build)
+	add = func(b packersdk.Build) {
+		if added[b] {
+			return
+		}
+		added[b] = true
+		for _, name := range dependsOn(b) {
+			for _, upstream := range d.byBlock[name] {
+				add(upstream)
+			}
+		}
+		res = append(res, b)
+	}
+	for _, b := range builds {
+		add(b)
+	}
+	return res
+}
+
+// wait blocks until all builds b depends on are complete, and then configures
+// b with their artifacts, returning the warnings of its builder configured
+// this way. An error is returned when one of them failed or was not selected to
+// run.
+func (d *buildDependencies) wait(ctx context.Context, b packersdk.Build) ([]string, error) {
+	deps := dependsOn(b)
+	if len(deps) == 0 {
+		return nil, nil
+	}
+
+	upstreamArtifacts := map[string][]packersdk.Artifact{}
+	for _, name := range deps {
+		upstreams := d.byBlock[name]
+		if len(upstreams) == 0 {
+			return nil, fmt.Errorf("build %q depends on build %q, which is not selected to run", b.Name(), name)
+		}
+		for _, upstream := range upstreams {
+			select {
+			case <-d.done[upstream]:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+
+			d.l.Lock()
+			err := d.errs[upstream]
+			artifacts := d.artifacts[upstream]
+			d.l.Unlock()
+			if err != nil {
+				return nil, fmt.Errorf("build %q depends on build %q, which did not complete successfully: %s", b.Name(), upstream.Name(), err)
+			}
+			upstreamArtifacts[name] = append(upstreamArtifacts[name], artifacts...)
+		}
+	}
+
+	if cb, ok := b.(*packer.CoreBuild); ok && cb.PrepareUpstream != nil {
+		warnings, err := cb.PrepareUpstream(upstreamArtifacts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure build with the artifacts of the builds it depends on: %s", err)
+		}
+		return warnings, nil
+	}
+	return nil, nil
+}
+
+// complete marks b as done, unblocking the builds depending on it.
+func (d *buildDependencies) complete(b packersdk.Build, artifacts []packersdk.Artifact, err error) {
+	d.l.Lock()
+	d.artifacts[b] = artifacts
+	d.errs[b] = err
+	d.l.Unlock()
+	close(d.done[b])
+}
@@ -0,0 +1,88 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+const sensitiveOutputValue = "<sensitive>"
+
+// outputFileEntry is how an output is written in the -output-file file.
+type outputFileEntry struct {
+	Description string          `json:"description,omitempty"`
+	Sensitive   bool            `json:"sensitive"`
+	Type        json.RawMessage `json:"type"`
+	Value       json.RawMessage `json:"value"`
+}
+
+// outputJSON returns the JSON encoding of the value and type of output.
+func outputJSON(output packer.Output) (value, typ json.RawMessage, err error) {
+	value, err = ctyjson.Marshal(output.Value, output.Value.Type())
+	if err != nil {
+		return nil, nil, fmt.Errorf("output %q: %s", output.Name, err)
+	}
+	typ, err = ctyjson.MarshalType(output.Value.Type())
+	if err != nil {
+		return nil, nil, fmt.Errorf("output %q: %s", output.Name, err)
+	}
+	return value, typ, nil
+}
+
+// writeOutputs shows outputs in ui, hiding the values of the sensitive ones.
+func writeOutputs(ui packersdk.Ui, outputs []packer.Output) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	ui.Say("\n==> Outputs:")
+	for _, output := range outputs {
+		if output.Sensitive {
+			ui.Machine("output", output.Name, sensitiveOutputValue)
+			ui.Say(fmt.Sprintf("--> %s: %s", output.Name, sensitiveOutputValue))
+			continue
+		}
+
+		value, _, err := outputJSON(output)
+		if err != nil {
+			return err
+		}
+		ui.Machine("output", output.Name, string(value))
+		formatted := strings.TrimSpace(string(hclwrite.TokensForValue(output.Value).Bytes()))
+		ui.Say(fmt.Sprintf("--> %s: %s", output.Name, formatted))
+	}
+	return nil
+}
+
+// writeOutputFile writes outputs to path as a JSON object with an entry per
+// output; the values of sensitive outputs are written too.
+func writeOutputFile(path string, outputs []packer.Output) error {
+	entries := map[string]outputFileEntry{}
+	for _, output := range outputs {
+		value, typ, err := outputJSON(output)
+		if err != nil {
+			return err
+		}
+		entries[output.Name] = outputFileEntry{
+			Description: output.Description,
+			Sensitive:   output.Sensitive,
+			Type:        typ,
+			Value:       value,
+		}
+	}
+
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
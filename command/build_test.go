@@ -4,6 +4,7 @@
 package command
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"os"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/packer/packer"
 )
 
 var (
@@ -468,6 +470,37 @@ func TestBuild(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "hcl - outputs are written to the output file",
+			args: []string{
+				"-output-file=outputs.json",
+				testFixture("hcl", "outputs"),
+			},
+			fileCheck: fileCheck{
+				expectedContent: map[string]string{
+					"chocolate.txt": "chocolate",
+					"outputs.json": `{
+  "artifact_id": {
+    "sensitive": false,
+    "type": "string",
+    "value": "File"
+  },
+  "files": {
+    "description": "Files of the chocolate build",
+    "sensitive": false,
+    "type": [
+      "list",
+      "string"
+    ],
+    "value": [
+      "chocolate.txt"
+    ]
+  }
+}
+`,
+				},
+			},
+		},
 		{
 			name: "hcl - unknown ",
 			args: []string{
@@ -610,6 +643,47 @@ func TestBuildStdin(t *testing.T) {
 	}
 }
 
+func TestBuildStdin_merged(t *testing.T) {
+	c := &BuildCommand{
+		Meta: TestMetaFile(t),
+	}
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(`
+build {
+  name    = "stdin"
+  sources = ["source.file.greeting"]
+}
+`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = stdin }()
+
+	// stdin is read when it is not the first of the merged paths too.
+	target := filepath.Join(t.TempDir(), "greeting.txt")
+	args := []string{
+		"-only=stdin.*",
+		"-var", "target=" + target,
+		filepath.Join(testFixture("test"), "template.pkr.hcl"),
+		"-",
+	}
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+	if !fileExists(target) {
+		t.Errorf("Expected to find %s", target)
+	}
+}
+
 func TestBuildOnlyFileMultipleFlags(t *testing.T) {
 	c := &BuildCommand{
 		Meta: TestMetaFile(t),
@@ -1089,6 +1163,54 @@ func TestBuildCommand_ParseArgs(t *testing.T) {
 			},
 			0,
 		},
+		{fields{defaultMeta},
+			args{[]string{"dir", "file.pkr.hcl"}},
+			&BuildArgs{
+				MetaArgs: MetaArgs{
+					Path:  "dir",
+					Paths: []string{"dir", "file.pkr.hcl"},
+				},
+				ParallelBuilds: math.MaxInt64,
+				Color:          true,
+			},
+			0,
+		},
+		{fields{defaultMeta},
+			args{[]string{"-var-source=yaml:vars.yml", "-var-source=exec:./vars.sh", "file.pkr.hcl"}},
+			&BuildArgs{
+				MetaArgs: MetaArgs{
+					Path:       "file.pkr.hcl",
+					VarSources: []string{"yaml:vars.yml", "exec:./vars.sh"},
+				},
+				ParallelBuilds: math.MaxInt64,
+				Color:          true,
+			},
+			0,
+		},
+		{fields{defaultMeta},
+			args{[]string{"-mock-file=mocks.pkrtest.hcl", "file.pkr.hcl"}},
+			&BuildArgs{
+				MetaArgs: MetaArgs{
+					Path:      "file.pkr.hcl",
+					MockFiles: []string{"mocks.pkrtest.hcl"},
+				},
+				ParallelBuilds: math.MaxInt64,
+				Color:          true,
+			},
+			0,
+		},
+		{fields{defaultMeta},
+			args{[]string{"-refresh-datasources", "file.pkr.hcl"}},
+			&BuildArgs{
+				MetaArgs: MetaArgs{
+					Path:               "file.pkr.hcl",
+					RefreshDatasources: true,
+				},
+				ParallelBuilds: math.MaxInt64,
+				Color:          true,
+			},
+			0,
+		},
 		{fields{defaultMeta},
 			args{[]string{"-parallel-builds=1", "-parallel-builds=5", "otherfile.json"}},
 			&BuildArgs{
@@ -1374,3 +1496,35 @@ func TestBuildCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildCommand_outputJSON(t *testing.T) {
+	meta := TestMetaFile(t)
+	c := &BuildCommand{Meta: meta}
+
+	target := filepath.Join(t.TempDir(), "greeting.txt")
+	args := []string{
+		"-output=json",
+		"-var", "target=" + target,
+		filepath.Join(testFixture("test"), "template.pkr.hcl"),
+	}
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, meta)
+	}
+
+	// the JSON events are written to the output of the command UI.
+	out, _ := GetStdoutAndErrFromTestMeta(t, meta)
+	dec := json.NewDecoder(strings.NewReader(out))
+	buildEnd := false
+	for dec.More() {
+		var event packer.JSONEvent
+		if err := dec.Decode(&event); err != nil {
+			t.Fatalf("bad json output %q: %s", out, err)
+		}
+		if event.Type == "build-end" && event.Target == "file.greeting" {
+			buildEnd = true
+		}
+	}
+	if !buildEnd {
+		t.Fatalf("expected a build-end event, got %q", out)
+	}
+}
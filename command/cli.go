@@ -6,6 +6,7 @@ package command
 import (
 	"flag"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/packer/command/enumflag"
 	kvflag "github.com/hashicorp/packer/command/flag-kv"
@@ -35,10 +36,15 @@ func (ma *MetaArgs) GetConfigType() (configType, error) {
 	if ma.Path == "" {
 		return ma.ConfigType, nil
 	}
+	if len(ma.Paths) > 1 {
+		// only HCL2 templates can be merged together.
+		return ConfigTypeHCL2, nil
+	}
 	name := ma.Path
 	if name == "-" {
-		// TODO(azr): To allow piping HCL2 confs (when args is "-"), we probably
-		// will need to add a setting that says "this is an HCL config".
+		// the type of a template piped to stdin is guessed from its content
+		// once it is read, unless -config-type=hcl2 is set; see
+		// Meta.GetConfig.
 		return ma.ConfigType, nil
 	}
 	if strings.HasSuffix(name, ".pkr.hcl") ||
@@ -58,17 +64,53 @@ func (ma *MetaArgs) AddFlagSets(fs *flag.FlagSet) {
 	fs.Var((*sliceflag.StringFlag)(&ma.Except), "except", "")
 	fs.Var((*kvflag.Flag)(&ma.Vars), "var", "")
 	fs.Var((*kvflag.StringSlice)(&ma.VarFiles), "var-file", "")
+	fs.IntVar(&ma.DatasourceParallelism, "parallel-datasources", 0, "")
 	fs.Var(&ma.ConfigType, "config-type", "set to 'hcl2' to run in hcl2 mode when no file is passed.")
 }
 
+// setPaths sets the template paths from the command arguments.
+func (ma *MetaArgs) setPaths(paths []string) {
+	ma.Path = paths[0]
+	if len(paths) > 1 {
+		ma.Paths = paths
+	}
+}
+
+// readsStdin tells whether one of the template paths is "-", stdin.
+func (ma *MetaArgs) readsStdin() bool {
+	if ma.Path == "-" {
+		return true
+	}
+	for _, path := range ma.Paths {
+		if path == "-" {
+			return true
+		}
+	}
+	return false
+}
+
 // MetaArgs defines commonalities between all commands
 type MetaArgs struct {
-	// TODO(azr): in the future, I want to allow passing multiple path to
-	// merge HCL confs together; but this will probably need an RFC first.
-	Path         string
+	// Path is the path of the template, or the first of Paths.
+	Path string
+	// Paths are the paths of the HCL2 templates, files or folders, that are
+	// merged into one configuration, when more than one is given.
+	Paths        []string
 	Only, Except []string
 	Vars         map[string]string
 	VarFiles     []string
+	// VarSources are the sources of variable values, as kind:path, where
+	// kind is json, yaml, dotenv or exec.
+	VarSources []string
+	// MockFiles are the files of mock_data blocks, mocking the outputs of
+	// data sources.
+	MockFiles []string
+	// DatasourceParallelism is the maximum number of data sources evaluated
+	// concurrently, 0 means no limit.
+	DatasourceParallelism int
+	// RefreshDatasources executes the data sources whose outputs are cached
+	// again, refreshing their cache.
+	RefreshDatasources bool
 	// set to "hcl2" to force hcl2 mode
 	ConfigType configType
 
@@ -85,11 +127,21 @@ func (ba *BuildArgs) AddFlagSets(flags *flag.FlagSet) {
 	flags.BoolVar(&ba.MachineReadable, "machine-readable", false, "")
 
 	flags.Int64Var(&ba.ParallelBuilds, "parallel-builds", 0, "")
+	flags.StringVar(&ba.Resume, "resume", "", "")
+	flags.StringVar(&ba.CacheDir, "cache-dir", "", "")
+	flags.StringVar(&ba.OutputFile, "output-file", "", "")
+	flags.DurationVar(&ba.BuildTimeout, "build-timeout", 0, "")
 
 	flagOnError := enumflag.New(&ba.OnError, "cleanup", "abort", "ask", "run-cleanup-provisioner")
 	flags.Var(flagOnError, "on-error", "")
 
+	flagOutput := enumflag.New(&ba.Output, "text", "json")
+	flags.Var(flagOutput, "output", "")
+
 	flags.BoolVar(&ba.MetaArgs.WarnOnUndeclaredVar, "warn-on-undeclared-var", false, "Show warnings for variable files containing undeclared variables.")
+	flags.Var((*kvflag.StringSlice)(&ba.VarSources), "var-source", "")
+	flags.Var((*kvflag.StringSlice)(&ba.MockFiles), "mock-file", "")
+	flags.BoolVar(&ba.RefreshDatasources, "refresh-datasources", false, "")
 	ba.MetaArgs.AddFlagSets(flags)
 }
 
@@ -100,6 +152,20 @@ type BuildArgs struct {
 	Color, TimestampUi, MachineReadable bool
 	ParallelBuilds                      int64
 	OnError                             string
+	// Resume is the path to a state file recording the progress of the
+	// builds, used to resume builds that failed in a previous run.
+	Resume string
+	// Output is the format of the output, text or json; json outputs a
+	// stream of newline-delimited JSON events.
+	Output string
+	// CacheDir is the directory of the build cache, used to skip the builds
+	// that did not change since they last completed successfully.
+	CacheDir string
+	// BuildTimeout is how long each build can run, 0 means no limit.
+	BuildTimeout time.Duration
+	// OutputFile is the path of the JSON file the outputs of the template
+	// are written to once the builds completed.
+	OutputFile string
 }
 
 func (ia *InitArgs) AddFlagSets(flags *flag.FlagSet) {
@@ -121,6 +187,14 @@ type PluginsRequiredArgs struct {
 	MetaArgs
 }
 
+func (ca *ConsoleArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.Var((*kvflag.StringSlice)(&ca.VarSources), "var-source", "")
+	flags.Var((*kvflag.StringSlice)(&ca.MockFiles), "mock-file", "")
+	flags.BoolVar(&ca.RefreshDatasources, "refresh-datasources", false, "")
+
+	ca.MetaArgs.AddFlagSets(flags)
+}
+
 // ConsoleArgs represents a parsed cli line for a `packer console`
 type ConsoleArgs struct {
 	MetaArgs
@@ -142,6 +216,9 @@ func (va *ValidateArgs) AddFlagSets(flags *flag.FlagSet) {
 	flags.BoolVar(&va.SyntaxOnly, "syntax-only", false, "check syntax only")
 	flags.BoolVar(&va.NoWarnUndeclaredVar, "no-warn-undeclared-var", false, "Ignore warnings for variable files containing undeclared variables.")
 	flags.BoolVar(&va.EvaluateDatasources, "evaluate-datasources", false, "evaluate datasources for validation (HCL2 only, may incur costs)")
+	flags.Var((*kvflag.StringSlice)(&va.VarSources), "var-source", "")
+	flags.Var((*kvflag.StringSlice)(&va.MockFiles), "mock-file", "")
+	flags.BoolVar(&va.RefreshDatasources, "refresh-datasources", false, "")
 
 	va.MetaArgs.AddFlagSets(flags)
 }
@@ -154,6 +231,8 @@ type ValidateArgs struct {
 }
 
 func (va *InspectArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.Var((*kvflag.StringSlice)(&va.VarSources), "var-source", "")
+
 	va.MetaArgs.AddFlagSets(flags)
 }
 
@@ -162,6 +241,36 @@ type InspectArgs struct {
 	MetaArgs
 }
 
+func (va *PlanArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.Var((*kvflag.StringSlice)(&va.VarSources), "var-source", "")
+	flags.Var((*kvflag.StringSlice)(&va.MockFiles), "mock-file", "")
+	flags.BoolVar(&va.RefreshDatasources, "refresh-datasources", false, "")
+
+	va.MetaArgs.AddFlagSets(flags)
+}
+
+// PlanArgs represents a parsed cli line for a `packer plan`
+type PlanArgs struct {
+	MetaArgs
+}
+
+func (ta *TestArgs) AddFlagSets(flags *flag.FlagSet) {
+	flags.Var((*kvflag.Flag)(&ta.Vars), "var", "")
+	flags.Var((*kvflag.StringSlice)(&ta.VarFiles), "var-file", "")
+	flags.Var((*kvflag.StringSlice)(&ta.VarSources), "var-source", "")
+	flags.Var((*kvflag.StringSlice)(&ta.MockFiles), "mock-file", "")
+	flags.IntVar(&ta.DatasourceParallelism, "parallel-datasources", 0, "")
+	flags.BoolVar(&ta.RefreshDatasources, "refresh-datasources", false, "")
+	flags.Var((*sliceflag.StringFlag)(&ta.Filter), "filter", "")
+}
+
+// TestArgs represents a parsed cli line for a `packer test`
+type TestArgs struct {
+	MetaArgs
+	// Filter are the test files to run, all of them when empty.
+	Filter []string
+}
+
 func (va *HCL2UpgradeArgs) AddFlagSets(flags *flag.FlagSet) {
 	flags.StringVar(&va.OutputFile, "output-file", "", "File where to put the hcl2 generated config. Defaults to JSON_TEMPLATE.pkr.hcl")
 	flags.BoolVar(&va.WithAnnotations, "with-annotations", false, "Adds helper annotations with information about the generated HCL2 blocks.")
@@ -51,8 +51,8 @@ func (c *ConsoleCommand) ParseArgs(args []string) (*ConsoleArgs, int) {
 	}
 
 	args = flags.Args()
-	if len(args) == 1 {
-		cfg.Path = args[0]
+	if len(args) > 0 {
+		cfg.setPaths(args)
 	}
 	return &cfg, 0
 }
@@ -63,7 +63,10 @@ func (c *ConsoleCommand) RunContext(ctx context.Context, cla *ConsoleArgs) int {
 		return ret
 	}
 
-	_ = packerStarter.Initialize(packer.InitializeOptions{})
+	_ = packerStarter.Initialize(packer.InitializeOptions{
+		DatasourceParallelism: cla.DatasourceParallelism,
+		RefreshDatasources:    cla.RefreshDatasources,
+	})
 
 	// Determine if stdin is a pipe. If so, we evaluate directly.
 	if c.StdinPiped() {
@@ -75,16 +78,21 @@ func (c *ConsoleCommand) RunContext(ctx context.Context, cla *ConsoleArgs) int {
 
 func (*ConsoleCommand) Help() string {
 	helpText := `
-Usage: packer console [options] [TEMPLATE]
+Usage: packer console [options] [TEMPLATE...]
 
   Creates a console for testing variable interpolation.
   If a template is provided, this command will load the template and any
   variables defined therein into its context to be referenced during
-  interpolation.
+  interpolation. Several HCL2 templates, files or folders, can be given;
+  they are merged into one configuration.
 
 Options:
+  -mock-file=path        Use the outputs of the mock_data blocks of this file instead of executing data sources, can be used multiple times.
+  -parallel-datasources=1  Number of data sources to evaluate in parallel. 0 means no limit (Default: 0)
+  -refresh-datasources     Execute the data sources whose outputs are cached again, refreshing their cache.
   -var 'key=value'       Variable for templates, can be used multiple times.
   -var-file=path         JSON or HCL2 file containing user variables.
+  -var-source=kind:path  Read variables from a json, yaml or dotenv file, or from the JSON output of an exec program; can be used multiple times.
   -config-type           Set to 'hcl2' to run in HCL2 mode when no file is passed. Defaults to json.
 `
 
@@ -101,8 +109,12 @@ func (*ConsoleCommand) AutocompleteArgs() complete.Predictor {
 
 func (*ConsoleCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
-		"-var":      complete.PredictNothing,
-		"-var-file": complete.PredictNothing,
+		"-mock-file":            complete.PredictFiles("*.hcl"),
+		"-parallel-datasources": complete.PredictNothing,
+		"-refresh-datasources":  complete.PredictNothing,
+		"-var":                  complete.PredictNothing,
+		"-var-file":             complete.PredictNothing,
+		"-var-source":           complete.PredictNothing,
 	}
 }
 
@@ -35,6 +35,42 @@ func TestFmt(t *testing.T) {
 	assert.Equal(t, expected, strings.TrimSpace(s.String()))
 }
 
+func TestFmt_varSource(t *testing.T) {
+	c := &FormatCommand{
+		Meta: testMeta(t),
+	}
+
+	// fmt does not evaluate variables.
+	args := []string{"-var-source=yaml:vars.yml", filepath.Join(testFixture("fmt"), "formatted.pkr.hcl")}
+	if _, code := c.ParseArgs(args); code != 1 {
+		t.Fatalf("expected -var-source to be rejected, got exit code %d", code)
+	}
+}
+
+func TestFmt_mockFile(t *testing.T) {
+	c := &FormatCommand{
+		Meta: testMeta(t),
+	}
+
+	// fmt does not evaluate data sources.
+	args := []string{"-mock-file=mocks.pkrtest.hcl", filepath.Join(testFixture("fmt"), "formatted.pkr.hcl")}
+	if _, code := c.ParseArgs(args); code != 1 {
+		t.Fatalf("expected -mock-file to be rejected, got exit code %d", code)
+	}
+}
+
+func TestFmt_refreshDatasources(t *testing.T) {
+	c := &FormatCommand{
+		Meta: testMeta(t),
+	}
+
+	// fmt does not evaluate data sources.
+	args := []string{"-refresh-datasources", filepath.Join(testFixture("fmt"), "formatted.pkr.hcl")}
+	if _, code := c.ParseArgs(args); code != 1 {
+		t.Fatalf("expected -refresh-datasources to be rejected, got exit code %d", code)
+	}
+}
+
 func TestFmt_unformattedPKRVarsTemplate(t *testing.T) {
 	c := &FormatCommand{
 		Meta: testMeta(t),
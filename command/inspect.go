@@ -36,8 +36,8 @@ func (c *InspectCommand) ParseArgs(args []string) (*InspectArgs, int) {
 	}
 
 	args = flags.Args()
-	if len(args) == 1 {
-		cfg.Path = args[0]
+	if len(args) > 0 {
+		cfg.setPaths(args)
 	}
 	return &cfg, 0
 }
@@ -58,15 +58,17 @@ func (c *InspectCommand) RunContext(ctx context.Context, cla *InspectArgs) int {
 
 func (*InspectCommand) Help() string {
 	helpText := `
-Usage: packer inspect TEMPLATE
+Usage: packer inspect TEMPLATE...
 
   Inspects a template, parsing and outputting the components a template
   defines. This does not validate the contents of a template (other than
-  basic syntax by necessity).
+  basic syntax by necessity). Several HCL2 templates, files or folders,
+  can be given; they are merged into one configuration.
 
 Options:
 
-  -machine-readable  Machine-readable output
+  -machine-readable       Machine-readable output
+  -var-source=kind:path  Read variables from a json, yaml or dotenv file, or from the JSON output of an exec program; can be used multiple times.
 `
 
 	return strings.TrimSpace(helpText)
@@ -83,5 +85,6 @@ func (c *InspectCommand) AutocompleteArgs() complete.Predictor {
 func (c *InspectCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
 		"-machine-readable": complete.PredictNothing,
+		"-var-source":       complete.PredictNothing,
 	}
 }
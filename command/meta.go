@@ -5,6 +5,8 @@ package command
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -26,6 +28,23 @@ type Meta struct {
 	CoreConfig *packer.CoreConfig
 	Ui         packersdk.Ui
 	Version    string
+
+	// stdin is the template read from stdin, when one of its paths is "-".
+	stdin []byte
+}
+
+// uiWriter returns the writer the output of m.Ui goes to, for the UIs a
+// command sets up in place of m.Ui, like the JSON one, to write to it too.
+func (m *Meta) uiWriter() io.Writer {
+	switch ui := m.Ui.(type) {
+	case *packersdk.BasicUi:
+		return ui.Writer
+	case *packer.MachineReadableUi:
+		return ui.Writer
+	case *packer.JSONUi:
+		return ui.Writer
+	}
+	return os.Stdout
 }
 
 // Core returns the core for the given template given the configured
@@ -105,10 +124,20 @@ func (m *Meta) GetConfig(cla *MetaArgs) (packer.Handler, int) {
 		return nil, 1
 	}
 
+	if cla.readsStdin() {
+		m.stdin, err = io.ReadAll(wrappedstreams.Stdin())
+		if err != nil {
+			m.Ui.Error(fmt.Sprintf("Failed to read the template from stdin: %s", err))
+			return nil, 1
+		}
+		if cfgType == ConfigTypeJSON && !isLegacyJSONTemplate(m.stdin) {
+			cfgType = ConfigTypeHCL2
+		}
+	}
+
 	switch cfgType {
 	case ConfigTypeHCL2:
 		packer.CheckpointReporter.SetTemplateType(packer.HCL2Template)
-		// TODO(azr): allow to pass a slice of files here.
 		return m.GetConfigFromHCL(cla)
 	default:
 		packer.CheckpointReporter.SetTemplateType(packer.JSONTemplate)
@@ -123,6 +152,17 @@ func (m *Meta) GetConfig(cla *MetaArgs) (packer.Handler, int) {
 }
 
 func (m *Meta) GetConfigFromHCL(cla *MetaArgs) (*hcl2template.PackerConfig, int) {
+	parser := m.hcl2Parser(cla)
+	paths := cla.Paths
+	if len(paths) == 0 {
+		paths = []string{cla.Path}
+	}
+	cfg, diags := parser.ParsePaths(paths, cla.VarFiles, cla.Vars)
+	return cfg, writeDiags(m.Ui, parser.Files(), diags)
+}
+
+// hcl2Parser returns the parser of the HCL2 templates of cla.
+func (m *Meta) hcl2Parser(cla *MetaArgs) *hcl2template.Parser {
 	parser := &hcl2template.Parser{
 		CorePackerVersion:       version.SemVer,
 		CorePackerVersionString: version.FormattedVersion(),
@@ -132,11 +172,24 @@ func (m *Meta) GetConfigFromHCL(cla *MetaArgs) (*hcl2template.PackerConfig, int)
 			WarnOnUndeclaredVar: cla.WarnOnUndeclaredVar,
 		},
 	}
-	cfg, diags := parser.Parse(cla.Path, cla.VarFiles, cla.Vars)
-	return cfg, writeDiags(m.Ui, parser.Files(), diags)
+	if m.stdin != nil {
+		parser.Stdin = bytes.NewReader(m.stdin)
+	}
+	parser.VarSources = cla.VarSources
+	parser.MockFiles = cla.MockFiles
+	return parser
 }
 
 func (m *Meta) GetConfigFromJSON(cla *MetaArgs) (packer.Handler, int) {
+	if len(cla.VarSources) > 0 {
+		m.Ui.Error("The -var-source option is only supported by HCL2 templates.")
+		return nil, 1
+	}
+	if len(cla.MockFiles) > 0 {
+		m.Ui.Error("The -mock-file option is only supported by HCL2 templates.")
+		return nil, 1
+	}
+
 	// Parse the template
 	var tpl *template.Template
 	var err error
@@ -144,6 +197,8 @@ func (m *Meta) GetConfigFromJSON(cla *MetaArgs) (packer.Handler, int) {
 		// here cla validation passed so this means we want a default builder
 		// and we probably are in the console command
 		tpl, err = template.Parse(TiniestBuilder)
+	} else if cla.Path == "-" && m.stdin != nil {
+		tpl, err = template.Parse(bytes.NewReader(m.stdin))
 	} else {
 		tpl, err = template.ParseFile(cla.Path)
 	}
@@ -166,3 +221,14 @@ func (m *Meta) GetConfigFromJSON(cla *MetaArgs) (packer.Handler, int) {
 	}
 	return core, ret
 }
+
+// isLegacyJSONTemplate tells whether src is a legacy JSON template, rather
+// than an HCL2 one: legacy templates are JSON objects with a builders key.
+func isLegacyJSONTemplate(src []byte) bool {
+	var tpl map[string]json.RawMessage
+	if err := json.Unmarshal(src, &tpl); err != nil {
+		return false
+	}
+	_, found := tpl["builders"]
+	return found
+}
@@ -0,0 +1,292 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package command
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+	"github.com/posener/complete"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type PlanCommand struct {
+	Meta
+}
+
+func (c *PlanCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *PlanCommand) ParseArgs(args []string) (*PlanArgs, int) {
+	var cfg PlanArgs
+	flags := c.Meta.FlagSet("plan")
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		return &cfg, 1
+	}
+	cfg.Path = args[0]
+	return &cfg, 0
+}
+
+func (c *PlanCommand) RunContext(ctx context.Context, cla *PlanArgs) int {
+	packerStarter, ret := c.GetConfig(&cla.MetaArgs)
+	if ret != 0 {
+		return ret
+	}
+
+	diags := packerStarter.DetectPluginBinaries()
+	ret = writeDiags(c.Ui, nil, diags)
+	if ret != 0 {
+		return ret
+	}
+
+	diags = packerStarter.Initialize(packer.InitializeOptions{
+		DatasourceParallelism: cla.DatasourceParallelism,
+		RefreshDatasources:    cla.RefreshDatasources,
+	})
+	ret = writeDiags(c.Ui, nil, diags)
+	if ret != 0 {
+		return ret
+	}
+
+	builds, diags := packerStarter.GetBuilds(packer.GetBuildsOptions{
+		Only:   cla.Only,
+		Except: cla.Except,
+	})
+	ret = writeDiags(c.Ui, nil, diags)
+	if ret != 0 {
+		return ret
+	}
+
+	if len(builds) == 0 {
+		c.Ui.Say("No builds to run.")
+		return 0
+	}
+
+	for _, b := range builds {
+		cb, ok := b.(*packer.CoreBuild)
+		if !ok {
+			continue
+		}
+		c.Ui.Say(packersdk.LogSecretFilter.FilterString(formatBuildPlan(cb.Plan())))
+	}
+
+	return 0
+}
+
+// formatBuildPlan renders plan as an HCL-like description of the build.
+func formatBuildPlan(plan *packer.BuildPlan) string {
+	f := hclwrite.NewEmptyFile()
+	build := f.Body().AppendNewBlock("build", []string{plan.Name}).Body()
+	build.SetAttributeValue("builder", cty.StringVal(plan.BuilderType))
+	if len(plan.DependsOn) > 0 {
+		var deps []cty.Value
+		for _, dep := range plan.DependsOn {
+			deps = append(deps, cty.StringVal(dep))
+		}
+		build.SetAttributeValue("depends_on", cty.TupleVal(deps))
+	}
+	if plan.Timeout != 0 {
+		build.SetAttributeValue("timeout", cty.StringVal(plan.Timeout.String()))
+	}
+
+	build.AppendNewline()
+	writePlanConfig(build.AppendNewBlock("source", nil).Body(), plan.Config)
+
+	for _, p := range plan.Provisioners {
+		build.AppendNewline()
+		if p.Parallel != nil {
+			writeParallelProvisionersPlan(build.AppendNewBlock("provisioners_parallel", nil).Body(), p)
+			continue
+		}
+		writeProvisionerPlan(build.AppendNewBlock("provisioner", []string{p.Type}).Body(), p)
+	}
+
+	if plan.CleanupProvisioner != nil {
+		build.AppendNewline()
+		writeProvisionerPlan(build.AppendNewBlock("error-cleanup-provisioner",
+			[]string{plan.CleanupProvisioner.Type}).Body(), *plan.CleanupProvisioner)
+	}
+
+	for _, ppSeq := range plan.PostProcessors {
+		build.AppendNewline()
+		seq := build.AppendNewBlock("post-processors", nil).Body()
+		for i, pp := range ppSeq {
+			if i > 0 {
+				seq.AppendNewline()
+			}
+			ppBody := seq.AppendNewBlock("post-processor", []string{pp.Type}).Body()
+			if pp.Name != "" && pp.Name != pp.Type {
+				ppBody.SetAttributeValue("name", cty.StringVal(pp.Name))
+			}
+			if pp.KeepInputArtifact != nil {
+				ppBody.SetAttributeValue("keep_input_artifact", cty.BoolVal(*pp.KeepInputArtifact))
+			} else {
+				ppBody.AppendUnstructuredTokens(hclwrite.Tokens{{
+					Type:  hclsyntax.TokenComment,
+					Bytes: []byte("# keep_input_artifact is decided by the post-processor\n"),
+				}})
+			}
+			writePlanConfig(ppBody, pp.Config)
+		}
+	}
+
+	return strings.TrimSpace(string(hclwrite.Format(f.Bytes())))
+}
+
+func writeParallelProvisionersPlan(body *hclwrite.Body, p packer.ProvisionerPlan) {
+	if p.Concurrency != 0 {
+		body.SetAttributeValue("concurrency", cty.NumberIntVal(int64(p.Concurrency)))
+	}
+	for i, child := range p.Parallel {
+		if i > 0 || p.Concurrency != 0 {
+			body.AppendNewline()
+		}
+		writeProvisionerPlan(body.AppendNewBlock("provisioner", []string{child.Type}).Body(), child)
+	}
+}
+
+func writeProvisionerPlan(body *hclwrite.Body, p packer.ProvisionerPlan) {
+	if p.Name != "" && p.Name != p.Type {
+		body.SetAttributeValue("name", cty.StringVal(p.Name))
+	}
+	if p.PauseBefore != 0 {
+		body.SetAttributeValue("pause_before", cty.StringVal(p.PauseBefore.String()))
+	}
+	if p.Timeout != 0 {
+		body.SetAttributeValue("timeout", cty.StringVal(p.Timeout.String()))
+	}
+	if p.MaxRetries != 0 {
+		body.SetAttributeValue("max_retries", cty.NumberIntVal(int64(p.MaxRetries)))
+	}
+	writePlanConfig(body, p.Config)
+}
+
+// writePlanConfig writes the attributes of config that are set in body, in
+// alphabetical order.
+func writePlanConfig(body *hclwrite.Body, config cty.Value) {
+	config, ok := planValue(config)
+	if !ok || !config.Type().IsObjectType() {
+		return
+	}
+	attrs := config.AsValueMap()
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		if hclsyntax.ValidIdentifier(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		body.SetAttributeValue(name, attrs[name])
+	}
+}
+
+// planValue prepares v to be written in a plan: null and empty values are
+// removed, collections become tuples and objects so that they can hold the
+// remaining values, and unknown values, that are only known once the build
+// runs, are shown as "<unknown>". false is returned when nothing is left of v.
+func planValue(v cty.Value) (cty.Value, bool) {
+	if !v.IsKnown() {
+		return cty.StringVal("<unknown>"), true
+	}
+	if v.IsNull() {
+		return cty.NilVal, false
+	}
+
+	t := v.Type()
+	switch {
+	case t.IsObjectType() || t.IsMapType():
+		attrs := map[string]cty.Value{}
+		for it := v.ElementIterator(); it.Next(); {
+			k, ev := it.Element()
+			if ev, ok := planValue(ev); ok {
+				attrs[k.AsString()] = ev
+			}
+		}
+		if len(attrs) == 0 {
+			return cty.NilVal, false
+		}
+		return cty.ObjectVal(attrs), true
+	case t.IsListType() || t.IsSetType() || t.IsTupleType():
+		var elems []cty.Value
+		for it := v.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			if ev, ok := planValue(ev); ok {
+				elems = append(elems, ev)
+			}
+		}
+		if len(elems) == 0 {
+			return cty.NilVal, false
+		}
+		return cty.TupleVal(elems), true
+	}
+	return v, true
+}
+
+func (*PlanCommand) Help() string {
+	helpText := `
+Usage: packer plan [options] TEMPLATE
+
+  Shows what each build of a template will do, without running it: the
+  fully resolved configuration of its source, its provisioners in order,
+  with their only/except, overrides, pause_before, max_retries and timeout
+  applied, its error-cleanup-provisioner and its post-processor chains.
+
+Options:
+
+  -except=foo,bar,baz           Show all builds other than these.
+  -mock-file=path               Use the outputs of the mock_data blocks of this file instead of executing data sources, can be used multiple times.
+  -parallel-datasources=1       Number of data sources to evaluate in parallel. 0 means no limit (Default: 0)
+  -refresh-datasources          Execute the data sources whose outputs are cached again, refreshing their cache.
+  -only=foo,bar,baz             Show only these builds.
+  -var 'key=value'              Variable for templates, can be used multiple times.
+  -var-file=path                JSON or HCL2 file containing user variables, can be used multiple times.
+  -var-source=kind:path         Read variables from a json, yaml or dotenv file, or from the JSON output of an exec program; can be used multiple times.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*PlanCommand) Synopsis() string {
+	return "show what builds will do without running them"
+}
+
+func (*PlanCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*PlanCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-except":               complete.PredictNothing,
+		"-only":                 complete.PredictNothing,
+		"-mock-file":            complete.PredictFiles("*.hcl"),
+		"-parallel-datasources": complete.PredictNothing,
+		"-refresh-datasources":  complete.PredictNothing,
+		"-var":                  complete.PredictNothing,
+		"-var-file":             complete.PredictNothing,
+		"-var-source":           complete.PredictNothing,
+	}
+}
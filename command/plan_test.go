@@ -0,0 +1,47 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package command
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanCommand(t *testing.T) {
+	c := &PlanCommand{
+		Meta: TestMetaFile(t),
+	}
+
+	args := []string{filepath.Join(testFixture("plan"), "template.pkr.hcl")}
+	if code := c.Run(args); code != 0 {
+		out, stderr := GetStdoutAndErrFromTestMeta(t, c.Meta)
+		t.Fatalf("Bad exit code %d\nStdout:\n%s\nStderr:\n%s", code, out, stderr)
+	}
+
+	out, _ := GetStdoutAndErrFromTestMeta(t, c.Meta)
+	// ignore alignment
+	plan := strings.Join(strings.Fields(out), " ")
+
+	for _, expected := range []string{
+		`build "null.test" { builder = "null"`,
+		`provisioner "shell-local" {`,
+		`pause_before = "10s"`,
+		`max_retries = 2`,
+		`inline = ["echo overridden"]`,
+		`post-processors { post-processor "manifest" { keep_input_artifact = true`,
+	} {
+		if !strings.Contains(plan, expected) {
+			t.Errorf("expected %q in plan:\n%s", expected, out)
+		}
+	}
+	for _, unexpected := range []string{
+		`echo base`,
+		`echo skipped`,
+	} {
+		if strings.Contains(plan, unexpected) {
+			t.Errorf("did not expect %q in plan:\n%s", unexpected, out)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+source "file" "chocolate" {
+  content = "chocolate"
+  target  = "chocolate.txt"
+}
+
+build {
+  sources = ["sources.file.chocolate"]
+}
+
+output "artifact_id" {
+  value = builds["file.chocolate"].artifact_id
+}
+
+output "files" {
+  description = "Files of the chocolate build"
+  type        = list(string)
+  value       = builds["file.chocolate"].artifacts[0].files
+}
@@ -0,0 +1,27 @@
+source "null" "test" {
+  communicator = "none"
+}
+
+build {
+  sources = ["source.null.test"]
+
+  provisioner "shell-local" {
+    pause_before = "10s"
+    max_retries  = 2
+    inline       = ["echo base"]
+    override = {
+      test = {
+        inline = ["echo overridden"]
+      }
+    }
+  }
+
+  provisioner "shell-local" {
+    only   = ["null.other"]
+    inline = ["echo skipped"]
+  }
+
+  post-processor "manifest" {
+    keep_input_artifact = true
+  }
+}
@@ -0,0 +1,17 @@
+run "defaults" {
+  assert {
+    condition     = builds["file.greeting"].config.content == "hello world"
+    error_message = "The default greeting must be hello."
+  }
+}
+
+run "wrong_greeting" {
+  variables {
+    greeting = "hi"
+  }
+
+  assert {
+    condition     = builds["file.greeting"].config.content == "hello world"
+    error_message = "The greeting must be hello."
+  }
+}
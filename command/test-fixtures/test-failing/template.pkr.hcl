@@ -0,0 +1,13 @@
+variable "greeting" {
+  type    = string
+  default = "hello"
+}
+
+source "file" "greeting" {
+  content = "${var.greeting} world"
+  target  = "greeting.txt"
+}
+
+build {
+  sources = ["source.file.greeting"]
+}
@@ -0,0 +1,18 @@
+variable "greeting" {
+  type    = string
+  default = "hello"
+}
+
+variable "target" {
+  type    = string
+  default = "greeting.txt"
+}
+
+source "file" "greeting" {
+  content = "${var.greeting} world"
+  target  = var.target
+}
+
+build {
+  sources = ["source.file.greeting"]
+}
@@ -0,0 +1,45 @@
+run "defaults" {
+  assert {
+    condition     = builds["file.greeting"].config.content == "hello world"
+    error_message = "The default greeting must be hello."
+  }
+
+  assert {
+    condition     = builds["file.greeting"].type == "file"
+    error_message = "The greeting must be built with the file builder."
+  }
+}
+
+run "custom_greeting" {
+  variables {
+    greeting = "bonjour"
+  }
+
+  assert {
+    condition     = builds["file.greeting"].config.content == "bonjour world"
+    error_message = "The greeting must be set by the greeting variable."
+  }
+}
+
+run "build" {
+  command = "build"
+
+  assert {
+    condition     = builds["file.greeting"].artifact_id == "File"
+    error_message = "The greeting must be written to a file."
+  }
+}
+
+run "mocked_build" {
+  command = "build"
+
+  mock_source "file" "greeting" {
+    artifact_id = "mocked"
+    files       = ["greeting.txt"]
+  }
+
+  assert {
+    condition     = builds["file.greeting"].artifact_id == "mocked"
+    error_message = "The file builder must be replaced by its mock."
+  }
+}
@@ -0,0 +1,257 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/hcl2template"
+	"github.com/hashicorp/packer/packer"
+	"github.com/posener/complete"
+)
+
+type TestCommand struct {
+	Meta
+}
+
+func (c *TestCommand) Run(args []string) int {
+	ctx, cleanup := handleTermInterrupt(c.Ui)
+	defer cleanup()
+
+	cfg, ret := c.ParseArgs(args)
+	if ret != 0 {
+		return ret
+	}
+
+	return c.RunContext(ctx, cfg)
+}
+
+func (c *TestCommand) ParseArgs(args []string) (*TestArgs, int) {
+	var cfg TestArgs
+	flags := c.Meta.FlagSet("test")
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	cfg.AddFlagSets(flags)
+	if err := flags.Parse(args); err != nil {
+		return &cfg, 1
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		return &cfg, 1
+	}
+	cfg.Path = args[0]
+	return &cfg, 0
+}
+
+func (c *TestCommand) RunContext(ctx context.Context, cla *TestArgs) int {
+	parser := c.hcl2Parser(&cla.MetaArgs)
+	files, diags := parser.ParseTestFiles(cla.Path)
+	if ret := writeDiags(c.Ui, parser.Files(), diags); ret != 0 {
+		return ret
+	}
+	files = filterTestFiles(files, cla.Path, cla.Filter)
+	if len(files) == 0 {
+		c.Ui.Say(fmt.Sprintf("No test files found in %s.", cla.Path))
+		return 0
+	}
+
+	passed, failed := 0, 0
+	for _, file := range files {
+		c.Ui.Say(fmt.Sprintf("%s:", file.Filename))
+		for _, run := range file.Runs {
+			if err := ctx.Err(); err != nil {
+				c.Ui.Error("Interrupted, not running any more tests.")
+				return 1
+			}
+
+			diags := c.testRun(ctx, parser, cla, run)
+			if diags.HasErrors() {
+				failed++
+				c.Ui.Error(fmt.Sprintf("  run %q... fail", run.Name))
+			} else {
+				passed++
+				c.Ui.Say(fmt.Sprintf("  run %q... pass", run.Name))
+			}
+			writeDiags(c.Ui, parser.Files(), diags)
+		}
+	}
+
+	c.Ui.Say(fmt.Sprintf("\n%d passed, %d failed.", passed, failed))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// filterTestFiles returns the files matching filter, by path relative to the
+// configuration at path or by name; all files when filter is empty.
+func filterTestFiles(files []*hcl2template.TestFile, path string, filter []string) []*hcl2template.TestFile {
+	if len(filter) == 0 {
+		return files
+	}
+	dir := path
+	if isDir, err := isDir(path); err == nil && !isDir {
+		dir = filepath.Dir(path)
+	}
+
+	var res []*hcl2template.TestFile
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file.Filename)
+		if err != nil {
+			rel = file.Filename
+		}
+		for _, f := range filter {
+			if filepath.Clean(f) == rel || f == filepath.Base(file.Filename) {
+				res = append(res, file)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// testRun evaluates the configuration with the variables of run, resolves
+// the builds it selects, runs them for build runs and then checks the
+// assertions of the run.
+func (c *TestCommand) testRun(ctx context.Context, parser *hcl2template.Parser, cla *TestArgs, run *hcl2template.RunBlock) hcl.Diagnostics {
+	cfg, diags := parser.ParseRun(cla.Path, run, cla.VarFiles, cla.Vars)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	diags = append(diags, cfg.DetectPluginBinaries()...)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	diags = append(diags, cfg.Initialize(packer.InitializeOptions{
+		SkipDatasourcesExecution: run.SkipDatasources,
+		DatasourceParallelism:    cla.DatasourceParallelism,
+		RefreshDatasources:       cla.RefreshDatasources,
+	})...)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	builds, moreDiags := cfg.GetBuilds(packer.GetBuildsOptions{
+		Only:   run.Only,
+		Except: run.Except,
+	})
+	diags = append(diags, moreDiags...)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	var artifacts map[string][]packersdk.Artifact
+	if run.Command == hcl2template.RunCommandBuild {
+		var err error
+		artifacts, err = c.runBuilds(ctx, builds)
+		defer func() {
+			for name, buildArtifacts := range artifacts {
+				for _, artifact := range buildArtifacts {
+					if artifact == nil {
+						continue
+					}
+					if err := artifact.Destroy(); err != nil {
+						c.Ui.Error(fmt.Sprintf("Failed to destroy the artifact of build %q: %s", name, err))
+					}
+				}
+			}
+		}()
+		if err != nil {
+			return append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Failed to run the builds of run %q", run.Name),
+				Detail:   err.Error(),
+				Subject:  run.Range.Ptr(),
+			})
+		}
+	}
+
+	return append(diags, cfg.EvaluateRunAssertions(run, builds, artifacts)...)
+}
+
+// runBuilds runs builds one at a time, each after the builds it depends on,
+// and returns their artifacts by build name.
+func (c *TestCommand) runBuilds(ctx context.Context, builds []packersdk.Build) (map[string][]packersdk.Artifact, error) {
+	artifacts := map[string][]packersdk.Artifact{}
+	dependencies := newBuildDependencies(builds)
+	for _, b := range dependencies.sort(builds) {
+		var runArtifacts []packersdk.Artifact
+		ui := &packer.TargetedUI{
+			Target: b.Name(),
+			Ui:     c.Ui,
+		}
+		warnings, err := dependencies.wait(ctx, b)
+		for _, warning := range warnings {
+			ui.Say(fmt.Sprintf("Warning: %s", warning))
+		}
+		if err == nil {
+			runArtifacts, err = b.Run(ctx, ui)
+		}
+		dependencies.complete(b, runArtifacts, err)
+		if err != nil {
+			return artifacts, fmt.Errorf("build %q failed: %s", b.Name(), err)
+		}
+		artifacts[b.Name()] = runArtifacts
+	}
+	return artifacts, nil
+}
+
+func (*TestCommand) Help() string {
+	helpText := `
+Usage: packer test [options] PATH
+
+  Runs the tests of the HCL2 configuration of the PATH directory: the run
+  blocks of the .pkrtest.hcl files of this directory and of its tests
+  sub-directory.
+
+  Each run evaluates the configuration with its variables and resolves its
+  builds, then checks its assertions. Runs whose command is "build" also run
+  their builds, and destroy their artifacts once the assertions are checked.
+
+  Builds run with their real builders, which can create remote resources,
+  unless their source is mocked with a mock_source block: the mocked builds
+  only produce the artifact of their mock. Data sources can be mocked with
+  mock_data blocks.
+
+Options:
+
+  -filter=foo.pkrtest.hcl       Only run the tests of these files, can be used multiple times.
+  -mock-file=path               Use the outputs of the mock_data blocks of this file instead of executing data sources, can be used multiple times.
+  -parallel-datasources=1       Number of data sources to evaluate in parallel. 0 means no limit (Default: 0)
+  -refresh-datasources          Execute the data sources whose outputs are cached again, refreshing their cache.
+  -var 'key=value'              Variable for templates, can be used multiple times.
+  -var-file=path                JSON or HCL2 file containing user variables, can be used multiple times.
+  -var-source=kind:path         Read variables from a json, yaml or dotenv file, or from the JSON output of an exec program; can be used multiple times.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*TestCommand) Synopsis() string {
+	return "run the tests of an HCL2 configuration"
+}
+
+func (*TestCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (*TestCommand) AutocompleteFlags() complete.Flags {
+	return complete.Flags{
+		"-filter":               complete.PredictFiles("*.pkrtest.hcl"),
+		"-mock-file":            complete.PredictFiles("*.hcl"),
+		"-parallel-datasources": complete.PredictNothing,
+		"-refresh-datasources":  complete.PredictNothing,
+		"-var":                  complete.PredictNothing,
+		"-var-file":             complete.PredictNothing,
+		"-var-source":           complete.PredictNothing,
+	}
+}
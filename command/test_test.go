@@ -0,0 +1,75 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTestCommand(t *testing.T) {
+	c := &TestCommand{
+		Meta: TestMetaFile(t),
+	}
+
+	target := filepath.Join(t.TempDir(), "greeting.txt")
+	args := []string{
+		"-var", "target=" + target,
+		testFixture("test"),
+	}
+	if code := c.Run(args); code != 0 {
+		out, stderr := GetStdoutAndErrFromTestMeta(t, c.Meta)
+		t.Fatalf("Bad exit code %d\nStdout:\n%s\nStderr:\n%s", code, out, stderr)
+	}
+
+	out, _ := GetStdoutAndErrFromTestMeta(t, c.Meta)
+	for _, expected := range []string{
+		`run "defaults"... pass`,
+		`run "custom_greeting"... pass`,
+		`run "build"... pass`,
+		`run "mocked_build"... pass`,
+		`4 passed, 0 failed.`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in output:\n%s", expected, out)
+		}
+	}
+
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("expected the artifact of the build run to be destroyed, got %v", err)
+	}
+}
+
+func TestTestCommand_failing(t *testing.T) {
+	c := &TestCommand{
+		Meta: TestMetaFile(t),
+	}
+
+	args := []string{testFixture("test-failing")}
+	if code := c.Run(args); code != 1 {
+		out, stderr := GetStdoutAndErrFromTestMeta(t, c.Meta)
+		t.Fatalf("Bad exit code %d\nStdout:\n%s\nStderr:\n%s", code, out, stderr)
+	}
+
+	out, stderr := GetStdoutAndErrFromTestMeta(t, c.Meta)
+	for _, expected := range []string{
+		`run "defaults"... pass`,
+		`1 passed, 1 failed.`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in output:\n%s", expected, out)
+		}
+	}
+	for _, expected := range []string{
+		`run "wrong_greeting"... fail`,
+		`Assertion of run "wrong_greeting" failed`,
+		`The greeting must be hello.`,
+	} {
+		if !strings.Contains(stderr, expected) {
+			t.Errorf("expected %q in errors:\n%s", expected, stderr)
+		}
+	}
+}
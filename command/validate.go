@@ -39,11 +39,11 @@ func (c *ValidateCommand) ParseArgs(args []string) (*ValidateArgs, int) {
 	}
 
 	args = flags.Args()
-	if len(args) != 1 {
+	if len(args) == 0 {
 		flags.Usage()
 		return &cfg, 1
 	}
-	cfg.Path = args[0]
+	cfg.setPaths(args)
 	return &cfg, 0
 }
 
@@ -73,6 +73,8 @@ func (c *ValidateCommand) RunContext(ctx context.Context, cla *ValidateArgs) int
 
 	diags = packerStarter.Initialize(packer.InitializeOptions{
 		SkipDatasourcesExecution: !cla.EvaluateDatasources,
+		DatasourceParallelism:    cla.DatasourceParallelism,
+		RefreshDatasources:       cla.RefreshDatasources,
 	})
 	ret = writeDiags(c.Ui, nil, diags)
 	if ret != 0 {
@@ -99,7 +101,7 @@ func (c *ValidateCommand) RunContext(ctx context.Context, cla *ValidateArgs) int
 
 func (*ValidateCommand) Help() string {
 	helpText := `
-Usage: packer validate [options] TEMPLATE
+Usage: packer validate [options] TEMPLATE...
 
   Checks the template is valid by parsing the template and also
   checking the configuration with the various builders, provisioners, etc.
@@ -108,14 +110,21 @@ Usage: packer validate [options] TEMPLATE
   with a non-zero exit status. If it is valid, it will exit with a zero
   exit status.
 
+  Several HCL2 templates, files or folders, can be given; they are merged
+  into one configuration.
+
 Options:
 
   -syntax-only                  Only check syntax. Do not verify config of the template.
   -except=foo,bar,baz           Validate all builds other than these.
+  -mock-file=path               Use the outputs of the mock_data blocks of this file instead of executing data sources, can be used multiple times.
+  -parallel-datasources=1       Number of data sources to evaluate in parallel. 0 means no limit (Default: 0)
+  -refresh-datasources          Execute the data sources whose outputs are cached again, refreshing their cache.
   -only=foo,bar,baz             Validate only these builds.
   -machine-readable             Produce machine-readable output.
   -var 'key=value'              Variable for templates, can be used multiple times.
   -var-file=path                JSON or HCL2 file containing user variables, can be used multiple times.
+  -var-source=kind:path         Read variables from a json, yaml or dotenv file, or from the JSON output of an exec program; can be used multiple times.
   -no-warn-undeclared-var       Disable warnings for user variable files containing undeclared variables.
   -evaluate-datasources         Evaluate data sources during validation (HCL2 only, may incur costs); Defaults to false. 
 `
@@ -133,11 +142,15 @@ func (*ValidateCommand) AutocompleteArgs() complete.Predictor {
 
 func (*ValidateCommand) AutocompleteFlags() complete.Flags {
 	return complete.Flags{
-		"-syntax-only":      complete.PredictNothing,
-		"-except":           complete.PredictNothing,
-		"-only":             complete.PredictNothing,
-		"-var":              complete.PredictNothing,
-		"-machine-readable": complete.PredictNothing,
-		"-var-file":         complete.PredictNothing,
+		"-syntax-only":          complete.PredictNothing,
+		"-except":               complete.PredictNothing,
+		"-only":                 complete.PredictNothing,
+		"-mock-file":            complete.PredictFiles("*.hcl"),
+		"-parallel-datasources": complete.PredictNothing,
+		"-refresh-datasources":  complete.PredictNothing,
+		"-var":                  complete.PredictNothing,
+		"-machine-readable":     complete.PredictNothing,
+		"-var-file":             complete.PredictNothing,
+		"-var-source":           complete.PredictNothing,
 	}
 }
@@ -59,6 +59,12 @@ func init() {
 			}, nil
 		},
 
+		"plan": func() (cli.Command, error) {
+			return &command.PlanCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
 		"plugin": func() (cli.Command, error) {
 			return &command.PluginCommand{
 				Meta: *CommandMeta,
@@ -95,6 +101,12 @@ func init() {
 			}, nil
 		},
 
+		"test": func() (cli.Command, error) {
+			return &command.TestCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
 		"validate": func() (cli.Command, error) {
 			return &command.ValidateCommand{
 				Meta: *CommandMeta,
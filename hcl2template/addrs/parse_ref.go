@@ -57,11 +57,19 @@ func parseRef(traversal hcl.Traversal) (*Reference, hcl.Diagnostics) {
 			Remaining:   remain,
 		}, diags
 
+	case "local":
+		name, rng, remain, diags := parseSingleAttrRef(traversal)
+		return &Reference{
+			Subject:     LocalValue{Name: name},
+			SourceRange: rng,
+			Remaining:   remain,
+		}, diags
+
 	default:
 		diags = append(diags, &hcl.Diagnostic{
 			Severity: hcl.DiagError,
 			Summary:  "Unhandled reference type",
-			Detail:   `Currently parseRef can only parse "var" references.`,
+			Detail:   `Currently parseRef can only parse "var" and "local" references.`,
 			Subject:  &rootRange,
 		})
 	}
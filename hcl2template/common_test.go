@@ -153,6 +153,59 @@ func testParse_only_Parse(t *testing.T, tests []parseTest) {
 	}
 }
 
+// testParseConfig parses the configuration at filename with parser, failing
+// the test on errors.
+func testParseConfig(t *testing.T, parser *Parser, filename string) *PackerConfig {
+	t.Helper()
+
+	return testParseConfigVars(t, parser, filename, nil)
+}
+
+// testParseConfigVars parses the configuration at filename with parser, with
+// its input variables set by vars, failing the test on errors.
+func testParseConfigVars(t *testing.T, parser *Parser, filename string, vars map[string]string) *PackerConfig {
+	t.Helper()
+
+	cfg, diags := parser.Parse(filename, nil, vars)
+	if diags.HasErrors() {
+		t.Fatalf("Parser.Parse() unexpected error: %s", diags)
+	}
+	return cfg
+}
+
+// testInitializeConfig parses and initializes the configuration at filename,
+// failing the test on errors. The warnings of its initialization are
+// returned.
+func testInitializeConfig(t *testing.T, parser *Parser, filename string, opts packer.InitializeOptions) (*PackerConfig, hcl.Diagnostics) {
+	t.Helper()
+
+	cfg := testParseConfig(t, parser, filename)
+	return cfg, testInitialize(t, cfg, opts)
+}
+
+// testInitialize initializes cfg, failing the test on errors, and returns
+// the warnings of its initialization.
+func testInitialize(t *testing.T, cfg *PackerConfig, opts packer.InitializeOptions) hcl.Diagnostics {
+	t.Helper()
+
+	diags := cfg.Initialize(opts)
+	if diags.HasErrors() {
+		t.Fatalf("PackerConfig.Initialize() unexpected error: %s", diags)
+	}
+	return diags
+}
+
+// testGetBuilds returns the builds of cfg, failing the test on errors.
+func testGetBuilds(t *testing.T, cfg *PackerConfig, opts packer.GetBuildsOptions) []packersdk.Build {
+	t.Helper()
+
+	builds, diags := cfg.GetBuilds(opts)
+	if diags.HasErrors() {
+		t.Fatalf("PackerConfig.GetBuilds() unexpected error: %s", diags)
+	}
+	return builds
+}
+
 var (
 	// everything in the tests is a basicNestedMockConfig this allow to test
 	// each known type to packer ( and embedding ) in one go.
@@ -349,6 +402,8 @@ var cmpOpts = []cmp.Option{
 		PackerConfig{},
 		Variable{},
 		SourceBlock{},
+		SourceUseBlock{},
+		CommunicatorBlock{},
 		DatasourceBlock{},
 		ProvisionerBlock{},
 		PostProcessorBlock{},
@@ -0,0 +1,128 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// datasourceCacheDir is the directory of the cached data source outputs, in
+// the Packer cache directory.
+const datasourceCacheDir = "datasources"
+
+// datasourceCacheEntry is the content of the file caching the outputs of a
+// data source execution.
+type datasourceCacheEntry struct {
+	Type       string                  `json:"type"`
+	ExecutedAt time.Time               `json:"executed_at"`
+	Outputs    ctyjson.SimpleJSONValue `json:"outputs"`
+}
+
+// datasourceCachePath returns the path of the file caching the outputs of a
+// dsType data source configured with config, its decoded configuration: the
+// data sources of the same type and configuration share their outputs.
+func datasourceCachePath(dsType string, config cty.Value) (string, error) {
+	b, err := ctyjson.Marshal(config, config.Type())
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(dsType))
+	h.Write([]byte{0})
+	h.Write(b)
+	return packersdk.CachePath(datasourceCacheDir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// datasourceNotCacheable returns why the outputs of ds, whose configuration
+// has the spec spec and is evaluated in ectx, must not be written to disk; or
+// an empty string when they can be cached. Outputs declared sensitive, and
+// outputs of a data source configured with ephemeral values, are not cached.
+func datasourceNotCacheable(ds DatasourceBlock, spec hcldec.Spec, ectx *hcl.EvalContext) string {
+	if len(ds.SensitiveOutputs) > 0 {
+		return "it has " + sensitiveOutputsAttr
+	}
+	for _, traversal := range hcldec.Variables(ds.body, spec) {
+		value, diags := traversal.TraverseAbs(ectx)
+		if !diags.HasErrors() && hasMark(value, ephemeralMark) {
+			return "its configuration uses ephemeral values"
+		}
+	}
+	return ""
+}
+
+// readDatasourceCache returns the outputs cached at path, as a value of
+// outputType, when they were cached less than ttl ago.
+func readDatasourceCache(path string, ttl time.Duration, outputType cty.Type) (cty.Value, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[WARN] failed to read the data source cache %s: %s", path, err)
+		}
+		return cty.NilVal, false
+	}
+
+	var entry datasourceCacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		log.Printf("[WARN] ignoring the invalid data source cache %s: %s", path, err)
+		return cty.NilVal, false
+	}
+	if time.Since(entry.ExecutedAt) > ttl {
+		return cty.NilVal, false
+	}
+	value, err := convert.Convert(entry.Outputs.Value, outputType)
+	if err != nil {
+		log.Printf("[WARN] ignoring the data source cache %s, its outputs are not compatible with the data source: %s", path, err)
+		return cty.NilVal, false
+	}
+	return value, true
+}
+
+// writeDatasourceCache caches at path the outputs of a dsType data source,
+// executed now.
+func writeDatasourceCache(path, dsType string, outputs cty.Value) error {
+	b, err := json.Marshal(datasourceCacheEntry{
+		Type:       dsType,
+		ExecutedAt: time.Now().UTC(),
+		Outputs:    ctyjson.SimpleJSONValue{Value: outputs},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Outputs can be secrets, the file is only readable by its owner. It is
+	// written to a temporary file first so that concurrent runs never read a
+	// partially written cache.
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write %s: %s", path, err)
+	}
+	return nil
+}
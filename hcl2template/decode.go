@@ -17,5 +17,8 @@ type Decodable interface {
 }
 
 func decodeHCL2Spec(body hcl.Body, ectx *hcl.EvalContext, dec Decodable) (cty.Value, hcl.Diagnostics) {
-	return hcldec.Decode(body, dec.ConfigSpec(), ectx)
+	val, diags := hcldec.Decode(body, dec.ConfigSpec(), ectx)
+	// plugins cannot handle marked values: sensitive parts of the config are
+	// redacted from the logs before being unmarked.
+	return filterSensitiveValues(val), diags
 }
@@ -0,0 +1,68 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// inputFiles records the local files matched by the fileset function while a
+// configuration is evaluated. Data sources are evaluated concurrently, so it
+// is safe for concurrent use.
+type inputFiles struct {
+	l     sync.Mutex
+	paths map[string]bool
+}
+
+func (f *inputFiles) add(path string) {
+	f.l.Lock()
+	defer f.l.Unlock()
+	if f.paths == nil {
+		f.paths = map[string]bool{}
+	}
+	f.paths[filepath.Clean(path)] = true
+}
+
+// list returns the recorded files, sorted.
+func (f *inputFiles) list() []string {
+	f.l.Lock()
+	defer f.l.Unlock()
+	res := make([]string, 0, len(f.paths))
+	for path := range f.paths {
+		res = append(res, path)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// recordFileSet wraps fileset, the fileset function of the basedir
+// directory, so that the files it matches are added to files.
+func recordFileSet(fileset function.Function, basedir string, files *inputFiles) function.Function {
+	return function.New(&function.Spec{
+		Params: fileset.Params(),
+		Type:   function.StaticReturnType(cty.Set(cty.String)),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			matches, err := fileset.Call(args)
+			if err != nil || !matches.IsKnown() || matches.IsNull() {
+				return matches, err
+			}
+			// Matches are relative to the path argument, itself relative
+			// to basedir.
+			path := args[0].AsString()
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(basedir, path)
+			}
+			for it := matches.ElementIterator(); it.Next(); {
+				_, match := it.Element()
+				files.add(filepath.Join(path, filepath.FromSlash(match.AsString())))
+			}
+			return matches, nil
+		},
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// valueMark is the type of the marks set on cty values.
+type valueMark string
+
+// sensitiveMark marks the values of sensitive variables, locals and data
+// source outputs. cty propagates it to every value derived from them, through
+// operators, functions and locals, so that they can be redacted too.
+const sensitiveMark = valueMark("sensitive")
+
+// ephemeralMark marks the values of ephemeral variables, and the values derived
+// from them, which must not be persisted: in manifests, HCP Packer metadata,
+// output files or the output of `packer inspect`.
+const ephemeralMark = valueMark("ephemeral")
+
+// markSensitive marks v as sensitive.
+func markSensitive(v cty.Value) cty.Value {
+	return v.Mark(sensitiveMark)
+}
+
+// markEphemeral marks v as ephemeral.
+func markEphemeral(v cty.Value) cty.Value {
+	return v.Mark(ephemeralMark)
+}
+
+// hasMark tells if v, or any value nested in v, has mark.
+func hasMark(v cty.Value, mark valueMark) bool {
+	_, pvms := v.UnmarkDeepWithPaths()
+	for _, pvm := range pvms {
+		if _, found := pvm.Marks[mark]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSensitiveValues registers the strings of v marked as sensitive in the
+// log secret filter, redacting them from the UI and the logs, and returns v
+// without its marks, as plugins and most of Packer cannot handle marked
+// values.
+func filterSensitiveValues(v cty.Value) cty.Value {
+	unmarked, pvms := v.UnmarkDeepWithPaths()
+	for _, pvm := range pvms {
+		if _, sensitive := pvm.Marks[sensitiveMark]; !sensitive {
+			continue
+		}
+		sensitive, err := pvm.Path.Apply(unmarked)
+		if err != nil {
+			continue
+		}
+		filterStrings(sensitive)
+	}
+	return unmarked
+}
+
+// filterStrings registers all the known strings of v, an unmarked value, in
+// the log secret filter.
+func filterStrings(v cty.Value) {
+	_ = cty.Walk(v, func(_ cty.Path, nested cty.Value) (bool, error) {
+		if nested.IsWhollyKnown() && !nested.IsNull() && nested.Type().Equals(cty.String) {
+			packersdk.LogSecretFilter.Set(nested.AsString())
+		}
+		return true, nil
+	})
+}
+
+// unmarkedEvalContext returns a copy of ectx, and of its parents, whose
+// variables are unmarked, to evaluate the attributes decoded into Go values
+// with gohcl, which cannot handle marked values.
+func unmarkedEvalContext(ectx *hcl.EvalContext) *hcl.EvalContext {
+	if ectx == nil {
+		return nil
+	}
+	res := &hcl.EvalContext{}
+	if parent := ectx.Parent(); parent != nil {
+		res = unmarkedEvalContext(parent).NewChild()
+	}
+	res.Functions = ectx.Functions
+	if ectx.Variables != nil {
+		res.Variables = make(map[string]cty.Value, len(ectx.Variables))
+		for name, value := range ectx.Variables {
+			res.Variables[name] = filterSensitiveValues(value)
+		}
+	}
+	return res
+}
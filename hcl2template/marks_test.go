@@ -0,0 +1,49 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParse_sensitive_derived_values(t *testing.T) {
+	cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/sensitive/derived", packer.InitializeOptions{})
+
+	for _, name := range []string{"encoded", "token"} {
+		if !cfg.LocalVariables[name].Value().ContainsMarked() {
+			t.Errorf("expected local.%s to be marked as sensitive", name)
+		}
+	}
+
+	datasources, _ := cfg.Datasources.Values()
+	credentials := datasources["amazon-ami"].Index(cty.StringVal("credentials"))
+	if !credentials.GetAttr("string").IsMarked() {
+		t.Errorf("expected the sensitive output of the data source to be marked")
+	}
+	if credentials.GetAttr("int").IsMarked() {
+		t.Errorf("expected the other outputs of the data source not to be marked")
+	}
+
+	// base64encode("s3cr3t")
+	for _, secret := range []string{"czNjcjN0", "token-ds-s3cr3t"} {
+		if filtered := packersdk.LogSecretFilter.FilterString("value: " + secret); strings.Contains(filtered, secret) {
+			t.Errorf("expected %q to be redacted from the logs, got %q", secret, filtered)
+		}
+	}
+
+	testGetBuilds(t, cfg, packer.GetBuildsOptions{})
+}
+
+func TestParse_sensitive_unknown_output(t *testing.T) {
+	cfg := testParseConfig(t, getBasicParser(), "testdata/sensitive/unknown_output")
+	diags := cfg.Initialize(packer.InitializeOptions{})
+	if !strings.Contains(diags.Error(), `Unknown output "password" in sensitive_outputs`) {
+		t.Fatalf("expected an unknown sensitive output error, got %s", diags)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ModuleFetcher fetches the source of a module block into a local directory,
+// from which the module configuration is then parsed.
+//
+// The Parser uses a LocalModuleFetcher unless told otherwise; fetchers for
+// remote sources, like git repositories or http archives, can be plugged in
+// through this interface.
+type ModuleFetcher interface {
+	// Fetch returns the local directory holding the module at source. A
+	// relative source is relative to basedir, the directory of the
+	// configuration using the module.
+	Fetch(source, basedir string) (string, error)
+}
+
+// LocalModuleFetcher fetches modules from local directories: their source is
+// a path starting with ./ or ../, or an absolute path.
+type LocalModuleFetcher struct{}
+
+var _ ModuleFetcher = LocalModuleFetcher{}
+
+func (LocalModuleFetcher) Fetch(source, basedir string) (string, error) {
+	if !isLocalModuleSource(source) {
+		return "", fmt.Errorf("%q is not a local path; local module sources "+
+			"start with ./ or ../", source)
+	}
+
+	dir := source
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(basedir, dir)
+	}
+	isDir, err := isDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if !isDir {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return dir, nil
+}
+
+func isLocalModuleSource(source string) bool {
+	for _, prefix := range []string{"./", "../", `.\`, `..\`} {
+		if strings.HasPrefix(source, prefix) {
+			return true
+		}
+	}
+	return filepath.IsAbs(source)
+}
+
+func (p *Parser) moduleFetcher() ModuleFetcher {
+	if p.ModuleFetcher != nil {
+		return p.ModuleFetcher
+	}
+	return LocalModuleFetcher{}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// overrideBody is an hcl.Body made of the content of base, overridden by the
+// content of override: an attribute set in override replaces the one of base,
+// and the blocks of a type set in override replace the blocks of that type in
+// base.
+//
+// Unlike hcl.MergeBodies, setting the same attribute in both bodies is not an
+// error; this is what allows a source to change a setting of the
+// communicator it uses, for example.
+type overrideBody struct {
+	base     hcl.Body
+	override hcl.Body
+
+	// mergeBlocks merges the blocks of a type that is set once in both
+	// bodies, with the same labels, instead of replacing the block of base.
+	// This is how a source extending another one is merged over it.
+	mergeBlocks bool
+}
+
+var _ hcl.Body = (*overrideBody)(nil)
+
+func (b *overrideBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	relaxed := relaxedSchema(schema)
+	baseContent, diags := b.base.Content(relaxed)
+	overrideContent, moreDiags := b.override.Content(relaxed)
+	diags = append(diags, moreDiags...)
+
+	content := b.mergeBodyContent(baseContent, overrideContent)
+	diags = append(diags, checkRequiredAttributes(schema, content)...)
+	return content, diags
+}
+
+func (b *overrideBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	relaxed := relaxedSchema(schema)
+	baseContent, baseRemain, diags := b.base.PartialContent(relaxed)
+	overrideContent, overrideRemain, moreDiags := b.override.PartialContent(relaxed)
+	diags = append(diags, moreDiags...)
+
+	content := b.mergeBodyContent(baseContent, overrideContent)
+	diags = append(diags, checkRequiredAttributes(schema, content)...)
+	return content, &overrideBody{
+		base:        baseRemain,
+		override:    overrideRemain,
+		mergeBlocks: b.mergeBlocks,
+	}, diags
+}
+
+func (b *overrideBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	attrs, diags := b.base.JustAttributes()
+	overrideAttrs, moreDiags := b.override.JustAttributes()
+	diags = append(diags, moreDiags...)
+
+	res := hcl.Attributes{}
+	for name, attr := range attrs {
+		res[name] = attr
+	}
+	for name, attr := range overrideAttrs {
+		res[name] = attr
+	}
+	return res, diags
+}
+
+func (b *overrideBody) MissingItemRange() hcl.Range {
+	return b.override.MissingItemRange()
+}
+
+// relaxedSchema returns a copy of schema in which no attribute is required,
+// as a required attribute can be set in either of the bodies.
+func relaxedSchema(schema *hcl.BodySchema) *hcl.BodySchema {
+	relaxed := &hcl.BodySchema{
+		Attributes: make([]hcl.AttributeSchema, len(schema.Attributes)),
+		Blocks:     schema.Blocks,
+	}
+	for i, attr := range schema.Attributes {
+		attr.Required = false
+		relaxed.Attributes[i] = attr
+	}
+	return relaxed
+}
+
+func checkRequiredAttributes(schema *hcl.BodySchema, content *hcl.BodyContent) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, attr := range schema.Attributes {
+		if _, ok := content.Attributes[attr.Name]; attr.Required && !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing required argument",
+				Detail:   fmt.Sprintf("The argument %q is required, but no definition was found.", attr.Name),
+				Subject:  content.MissingItemRange.Ptr(),
+			})
+		}
+	}
+	return diags
+}
+
+func (b *overrideBody) mergeBodyContent(base, override *hcl.BodyContent) *hcl.BodyContent {
+	if base == nil {
+		base = &hcl.BodyContent{}
+	}
+	if override == nil {
+		override = &hcl.BodyContent{}
+	}
+	content := &hcl.BodyContent{
+		Attributes:       hcl.Attributes{},
+		MissingItemRange: override.MissingItemRange,
+	}
+	for name, attr := range base.Attributes {
+		content.Attributes[name] = attr
+	}
+	for name, attr := range override.Attributes {
+		content.Attributes[name] = attr
+	}
+
+	overridden := map[string]bool{}
+	for _, block := range override.Blocks {
+		overridden[block.Type] = true
+	}
+	for _, block := range base.Blocks {
+		if !overridden[block.Type] {
+			content.Blocks = append(content.Blocks, block)
+		}
+	}
+	for _, block := range override.Blocks {
+		if baseBlock := b.mergeableBlock(base.Blocks, override.Blocks, block); baseBlock != nil {
+			merged := *block
+			merged.Body = &overrideBody{
+				base:        baseBlock.Body,
+				override:    block.Body,
+				mergeBlocks: true,
+			}
+			block = &merged
+		}
+		content.Blocks = append(content.Blocks, block)
+	}
+	return content
+}
+
+// mergeableBlock returns the block of base that block is merged over, when
+// blocks are merged and block is the only one of its type in both base and
+// override, with the same labels.
+func (b *overrideBody) mergeableBlock(base, override hcl.Blocks, block *hcl.Block) *hcl.Block {
+	if !b.mergeBlocks {
+		return nil
+	}
+	if len(override.OfType(block.Type)) != 1 {
+		return nil
+	}
+	baseBlocks := base.OfType(block.Type)
+	if len(baseBlocks) != 1 || !equalLabels(baseBlocks[0].Labels, block.Labels) {
+		return nil
+	}
+	return baseBlocks[0]
+}
+
+func equalLabels(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -4,7 +4,9 @@
 package hcl2template
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -12,7 +14,6 @@ import (
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/ext/dynblock"
 	"github.com/hashicorp/hcl/v2/hclparse"
-	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer/packer"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -27,6 +28,9 @@ const (
 	dataSourceLabel   = "data"
 	buildLabel        = "build"
 	communicatorLabel = "communicator"
+	moduleLabel       = "module"
+	outputLabel       = "output"
+	checkLabel        = "check"
 )
 
 var configSchema = &hcl.BodySchema{
@@ -40,6 +44,9 @@ var configSchema = &hcl.BodySchema{
 		{Type: dataSourceLabel, LabelNames: []string{"type", "name"}},
 		{Type: buildLabel},
 		{Type: communicatorLabel, LabelNames: []string{"type", "name"}},
+		{Type: moduleLabel, LabelNames: []string{"name"}},
+		{Type: outputLabel, LabelNames: []string{"name"}},
+		{Type: checkLabel, LabelNames: []string{"name"}},
 	},
 }
 
@@ -65,9 +72,28 @@ type Parser struct {
 
 	PluginConfig *packer.PluginConfig
 
+	// ModuleFetcher fetches the sources of module blocks, only local
+	// directories are supported when it is not set.
+	ModuleFetcher ModuleFetcher
+
+	// Stdin is where the template of the "-" path is read from, os.Stdin
+	// when it is not set.
+	Stdin io.Reader
+
+	// VarSources are the sources input variables values are read from, as
+	// kind:path; see the -var-source flag.
+	VarSources []string
+
+	// MockFiles are the files of mock_data blocks, mocking the outputs of
+	// data sources; see the -mock-file flag.
+	MockFiles []string
+
 	ValidationOptions
 
 	*hclparse.Parser
+
+	// loadingModules are the directories of the modules being loaded.
+	loadingModules []string
 }
 
 const (
@@ -77,6 +103,12 @@ const (
 	hcl2VarJsonFileExt     = ".pkrvars.json"
 	hcl2AutoVarFileExt     = ".auto.pkrvars.hcl"
 	hcl2AutoVarJsonFileExt = ".auto.pkrvars.json"
+
+	// stdinPath is the path of a template read from stdin.
+	stdinPath = "-"
+	// stdinFilename is the name of a template read from stdin in
+	// diagnostics; its directory is the current one.
+	stdinFilename = "<stdin>"
 )
 
 // Parse will Parse all HCL files in filename. Path can be a folder or a file.
@@ -91,11 +123,52 @@ const (
 // init should be called next to expand dynamic blocks and verify that used
 // things do exist.
 func (p *Parser) Parse(filename string, varFiles []string, argVars map[string]string) (*PackerConfig, hcl.Diagnostics) {
+	cfg, diags := p.parse([]string{filename}, varFiles, nil, p.VarSources, argVars, os.Environ())
+	return cfg, append(diags, p.setMockData(cfg, nil)...)
+}
+
+// ParsePaths parses the HCL files of all paths, folders or files, into one
+// configuration, as Parse does for a single path.
+//
+// The base directory of the configuration is the one of the first path. The
+// expressions of the files of other directories are evaluated with their
+// own directory as path.root, and their file functions are relative to it.
+func (p *Parser) ParsePaths(paths []string, varFiles []string, argVars map[string]string) (*PackerConfig, hcl.Diagnostics) {
+	cfg, diags := p.parse(paths, varFiles, nil, p.VarSources, argVars, os.Environ())
+	return cfg, append(diags, p.setMockData(cfg, nil)...)
+}
+
+// parse parses the configuration at filenames, varSources and env holding
+// the variable sources and environment variables that can set its input
+// variables; modules are parsed without them. extraVarFiles are var files
+// already parsed, set after varFiles.
+func (p *Parser) parse(filenames []string, varFiles []string, extraVarFiles []*hcl.File, varSources []string, argVars map[string]string, env []string) (*PackerConfig, hcl.Diagnostics) {
 	var files []*hcl.File
 	var diags hcl.Diagnostics
 
+	// fileDirs are the directories of the config files, to evaluate them
+	// with their own path.root.
+	fileDirs := map[*hcl.File]string{}
+	seen := map[string]bool{}
+
 	// parse config files
-	if filename != "" {
+	for _, filename := range filenames {
+		if filename == "" {
+			continue
+		}
+		if filename == stdinPath {
+			if seen[stdinPath] {
+				continue
+			}
+			seen[stdinPath] = true
+			f, moreDiags := p.parseStdin()
+			diags = append(diags, moreDiags...)
+			if f != nil {
+				files = append(files, f)
+				fileDirs[f] = filepath.Dir(stdinFilename)
+			}
+			continue
+		}
 		hclFiles, jsonFiles, moreDiags := GetHCL2Files(filename, hcl2FileExt, hcl2JsonFileExt)
 		diags = append(diags, moreDiags...)
 		if moreDiags.HasErrors() {
@@ -112,21 +185,37 @@ func (p *Parser) Parse(filename string, varFiles []string, argVars map[string]st
 			})
 		}
 		for _, filename := range hclFiles {
+			if seen[filepath.Clean(filename)] {
+				continue
+			}
+			seen[filepath.Clean(filename)] = true
 			f, moreDiags := p.ParseHCLFile(filename)
 			diags = append(diags, moreDiags...)
 			files = append(files, f)
+			fileDirs[f] = filepath.Dir(filename)
 		}
 		for _, filename := range jsonFiles {
+			if seen[filepath.Clean(filename)] {
+				continue
+			}
+			seen[filepath.Clean(filename)] = true
 			f, moreDiags := p.ParseJSONFile(filename)
 			diags = append(diags, moreDiags...)
 			files = append(files, f)
+			fileDirs[f] = filepath.Dir(filename)
 		}
-		if diags.HasErrors() {
-			return nil, diags
-		}
+	}
+	if diags.HasErrors() {
+		return nil, diags
 	}
 
-	basedir := filename
+	basedir := ""
+	if len(filenames) > 0 {
+		basedir = filenames[0]
+	}
+	if basedir == stdinPath {
+		basedir = filepath.Dir(stdinFilename)
+	}
 	if isDir, err := isDir(basedir); err == nil && !isDir {
 		basedir = filepath.Dir(basedir)
 	}
@@ -145,8 +234,20 @@ func (p *Parser) Parse(filename string, varFiles []string, argVars map[string]st
 		HCPVars:                 map[string]cty.Value{},
 		ValidationOptions:       p.ValidationOptions,
 		parser:                  p,
-		files:                   files,
+		inputFiles:              &inputFiles{},
+	}
+
+	for _, file := range files {
+		if dir := fileDirs[file]; filepath.Clean(dir) != filepath.Clean(basedir) {
+			file = &hcl.File{
+				Body:  newScopedBody(file.Body, cfg.fileScope(dir)),
+				Bytes: file.Bytes,
+				Nav:   file.Nav,
+			}
+		}
+		cfg.files = append(cfg.files, file)
 	}
+	files = cfg.files
 
 	for _, file := range files {
 		coreVersionConstraints, moreDiags := sniffCoreVersionRequirements(file.Body)
@@ -190,12 +291,24 @@ func (p *Parser) Parse(filename string, varFiles []string, argVars map[string]st
 			diags = append(diags, morediags...)
 			cfg.LocalBlocks = append(cfg.LocalBlocks, moreLocals...)
 		}
+
+		for _, file := range files {
+			diags = append(diags, p.decodeModules(file, cfg)...)
+		}
 	}
 
 	// parse var files
 	{
-		hclVarFiles, jsonVarFiles, moreDiags := GetHCL2Files(filename, hcl2AutoVarFileExt, hcl2AutoVarJsonFileExt)
-		diags = append(diags, moreDiags...)
+		var hclVarFiles, jsonVarFiles []string
+		for _, filename := range filenames {
+			if filename == stdinPath {
+				continue
+			}
+			hclFiles, jsonFiles, moreDiags := GetHCL2Files(filename, hcl2AutoVarFileExt, hcl2AutoVarJsonFileExt)
+			diags = append(diags, moreDiags...)
+			hclVarFiles = append(hclVarFiles, hclFiles...)
+			jsonVarFiles = append(jsonVarFiles, jsonFiles...)
+		}
 		for _, file := range varFiles {
 			switch filepath.Ext(file) {
 			case ".hcl":
@@ -203,7 +316,7 @@ func (p *Parser) Parse(filename string, varFiles []string, argVars map[string]st
 			case ".json":
 				jsonVarFiles = append(jsonVarFiles, file)
 			default:
-				diags = append(moreDiags, &hcl.Diagnostic{
+				diags = append(diags, &hcl.Diagnostic{
 					Severity: hcl.DiagError,
 					Summary:  "Could not guess format of " + file,
 					Detail:   "A var file must be suffixed with `.hcl` or `.json`.",
@@ -227,13 +340,38 @@ func (p *Parser) Parse(filename string, varFiles []string, argVars map[string]st
 			}
 			varFiles = append(varFiles, f)
 		}
+		varFiles = append(varFiles, extraVarFiles...)
 
-		diags = append(diags, cfg.collectInputVariableValues(os.Environ(), varFiles, argVars)...)
+		sources, moreDiags := p.readVarSources(varSources, cfg.InputVariables)
+		diags = append(diags, moreDiags...)
+
+		diags = append(diags, cfg.collectInputVariableValues(env, varFiles, sources, argVars)...)
 	}
 
 	return cfg, diags
 }
 
+// parseStdin parses the template read from stdin, as HCL JSON when it starts
+// with a JSON object and as HCL otherwise.
+func (p *Parser) parseStdin() (*hcl.File, hcl.Diagnostics) {
+	stdin := p.Stdin
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	src, err := io.ReadAll(stdin)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read the template from stdin",
+			Detail:   err.Error(),
+		}}
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(src), []byte("{")) {
+		return p.ParseJSON(src, stdinFilename)
+	}
+	return p.ParseHCL(src, stdinFilename)
+}
+
 // sniffCoreVersionRequirements does minimal parsing of the given body for
 // "packer" blocks with "required_version" attributes, returning the
 // requirements found.
@@ -278,26 +416,21 @@ func sniffCoreVersionRequirements(body hcl.Body) ([]VersionConstraint, hcl.Diagn
 	return constraints, diags
 }
 
+// filterVarsFromLogs redacts the sensitive values of inputOrLocal from the UI
+// and the logs, including the parts of locals derived from sensitive values.
 func filterVarsFromLogs(inputOrLocal Variables) {
-	for _, variable := range inputOrLocal {
-		if !variable.Sensitive {
-			continue
-		}
-		value := variable.Value()
-		_ = cty.Walk(value, func(_ cty.Path, nested cty.Value) (bool, error) {
-			if nested.IsWhollyKnown() && !nested.IsNull() && nested.Type().Equals(cty.String) {
-				packersdk.LogSecretFilter.Set(nested.AsString())
-			}
-			return true, nil
-		})
+	for _, value := range inputOrLocal.Values() {
+		filterSensitiveValues(value)
 	}
 }
 
 func (cfg *PackerConfig) Initialize(opts packer.InitializeOptions) hcl.Diagnostics {
-	diags := cfg.InputVariables.ValidateValues()
-	diags = append(diags, cfg.evaluateDatasources(opts.SkipDatasourcesExecution)...)
+	diags := cfg.validateInputVariables(false)
+	diags = append(diags, cfg.evaluateDatasources(opts)...)
 	diags = append(diags, checkForDuplicateLocalDefinition(cfg.LocalBlocks)...)
 	diags = append(diags, cfg.evaluateLocalVariables(cfg.LocalBlocks)...)
+	diags = append(diags, cfg.validateInputVariables(true)...)
+	diags = append(diags, cfg.initializeModules(opts)...)
 
 	filterVarsFromLogs(cfg.InputVariables)
 	filterVarsFromLogs(cfg.LocalVariables)
@@ -307,6 +440,10 @@ func (cfg *PackerConfig) Initialize(opts packer.InitializeOptions) hcl.Diagnosti
 		diags = append(diags, cfg.parser.parseConfig(file, cfg)...)
 	}
 
+	diags = append(diags, cfg.evaluateChecks()...)
+
+	diags = append(diags, cfg.checkBuildDependencies()...)
+
 	diags = append(diags, cfg.initializeBlocks()...)
 
 	return diags
@@ -350,6 +487,32 @@ func (p *Parser) parseConfig(f *hcl.File, cfg *PackerConfig) hcl.Diagnostics {
 			}
 			cfg.Sources[ref] = source
 
+		case communicatorLabel:
+			communicator, moreDiags := p.decodeCommunicator(block)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+
+			ref := communicator.Ref()
+			if existing, found := cfg.Communicators[ref]; found {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate " + communicatorLabel + " block",
+					Detail: fmt.Sprintf("This "+communicatorLabel+" block has the "+
+						"same type and name as a previous block declared "+
+						"at %s. Each "+communicatorLabel+" must have a unique name per type.",
+						existing.block.DefRange.Ptr()),
+					Subject: communicator.block.DefRange.Ptr(),
+				})
+				continue
+			}
+
+			if cfg.Communicators == nil {
+				cfg.Communicators = map[CommunicatorRef]CommunicatorBlock{}
+			}
+			cfg.Communicators[ref] = communicator
+
 		case buildLabel:
 			build, moreDiags := p.decodeBuildConfig(block, cfg)
 			diags = append(diags, moreDiags...)
@@ -358,6 +521,48 @@ func (p *Parser) parseConfig(f *hcl.File, cfg *PackerConfig) hcl.Diagnostics {
 			}
 
 			cfg.Builds = append(cfg.Builds, build)
+
+		case outputLabel:
+			output, moreDiags := decodeOutputBlock(block)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+
+			if existing := cfg.Outputs.get(output.Name); existing != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate " + outputLabel + " block",
+					Detail: fmt.Sprintf("This "+outputLabel+" block has the "+
+						"same name as a previous block declared at %s. Each "+
+						outputLabel+" must have a unique name.", existing.Range.Ptr()),
+					Subject: output.Range.Ptr(),
+				})
+				continue
+			}
+
+			cfg.Outputs = append(cfg.Outputs, output)
+
+		case checkLabel:
+			check, moreDiags := decodeCheckBlock(block)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+
+			if existing := cfg.Checks.get(check.Name); existing != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate " + checkLabel + " block",
+					Detail: fmt.Sprintf("This "+checkLabel+" block has the "+
+						"same name as a previous block declared at %s. Each "+
+						checkLabel+" must have a unique name.", existing.Range.Ptr()),
+					Subject: check.Range.Ptr(),
+				})
+				continue
+			}
+
+			cfg.Checks = append(cfg.Checks, check)
 		}
 	}
 
@@ -51,6 +51,20 @@ func (cfg *PackerConfig) PluginRequirements() (plugingetter.Requirements, hcl.Di
 
 	}
 
+	// Modules can require plugins too; the requirements of the
+	// configuration win over theirs.
+	for _, name := range cfg.Modules.names() {
+		moduleReqs, moreDiags := cfg.Modules[name].Config.PluginRequirements()
+		diags = append(diags, moreDiags...)
+		for _, req := range moduleReqs {
+			if _, found := uniq[req.Accessor]; found {
+				continue
+			}
+			reqs = append(reqs, req)
+			uniq[req.Accessor] = nil
+		}
+	}
+
 	return reqs, diags
 }
 
@@ -154,9 +168,28 @@ func (cfg *PackerConfig) initializeBlocks() hcl.Diagnostics {
 				continue
 			}
 
-			sourceDefinition, found := cfg.Sources[srcUsage.SourceRef]
+			// The sources of a module are evaluated in the module, and
+			// can use its communicators; the build block can still set
+			// one of the configuration.
+			owner := cfg
+			var module *ModuleBlock
+			if srcUsage.Module != "" {
+				module = cfg.Modules[srcUsage.Module]
+				if module == nil {
+					diags = append(diags, &hcl.Diagnostic{
+						Summary:  fmt.Sprintf("Unknown %s %q", moduleLabel, srcUsage.Module),
+						Subject:  build.HCL2Ref.DefRange.Ptr(),
+						Severity: hcl.DiagError,
+						Detail:   fmt.Sprintf("Known: %v", cfg.Modules.names()),
+					})
+					continue
+				}
+				owner = module.Config
+			}
+
+			sourceDefinition, found := owner.Sources[srcUsage.SourceRef]
 			if !found {
-				availableSrcs := listAvailableSourceNames(cfg.Sources)
+				availableSrcs := listAvailableSourceNames(owner.Sources)
 				detail := fmt.Sprintf("Known: %v", availableSrcs)
 				if sugg := didyoumean.NameSuggestion(srcUsage.SourceRef.String(), availableSrcs); sugg != "" {
 					detail = fmt.Sprintf("Did you mean to use %q?", sugg)
@@ -170,16 +203,36 @@ func (cfg *PackerConfig) initializeBlocks() hcl.Diagnostics {
 				continue
 			}
 
-			body := sourceDefinition.block.Body
+			body, moreDiags := owner.sourceBody(sourceDefinition)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+			if module != nil {
+				// The communicator of a source of the module is evaluated
+				// in the module too.
+				body, moreDiags = owner.useCommunicator(body)
+				diags = append(diags, moreDiags...)
+				if moreDiags.HasErrors() {
+					continue
+				}
+				body = module.scopeBody(body)
+			}
 			if srcUsage.Body != nil {
 				// merge additions into source definition to get a new body.
 				body = hcl.MergeBodies([]hcl.Body{body, srcUsage.Body})
 			}
 
+			body, moreDiags = cfg.useCommunicator(body)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+
 			srcUsage.Body = body
 		}
 
-		for _, provBlock := range build.ProvisionerBlocks {
+		for _, provBlock := range flattenProvisionerBlocks(build.ProvisionerBlocks) {
 			if !cfg.parser.PluginConfig.Provisioners.Has(provBlock.PType) {
 				detail := fmt.Sprintf(
 					"The %s %s is unknown by Packer, and is likely part of a plugin that is not installed.\n"+
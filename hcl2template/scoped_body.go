@@ -0,0 +1,90 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// scopedBody is an hcl.Body whose expressions are not evaluated with the
+// context they are given, but with the one scope derives from it. It is used
+// for the bodies of modules, evaluated with the variables of the module, and
+// for the files of templates merged from different directories, evaluated
+// with their own path.root.
+type scopedBody struct {
+	hcl.Body
+	scope func(*hcl.EvalContext) *hcl.EvalContext
+}
+
+var _ hcl.Body = new(scopedBody)
+
+func newScopedBody(body hcl.Body, scope func(*hcl.EvalContext) *hcl.EvalContext) hcl.Body {
+	if body == nil {
+		return nil
+	}
+	return &scopedBody{Body: body, scope: scope}
+}
+
+func (b *scopedBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	content, diags := b.Body.Content(schema)
+	return b.scopeContent(content), diags
+}
+
+func (b *scopedBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	content, remain, diags := b.Body.PartialContent(schema)
+	return b.scopeContent(content), newScopedBody(remain, b.scope), diags
+}
+
+func (b *scopedBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	attrs, diags := b.Body.JustAttributes()
+	return b.scopeAttributes(attrs), diags
+}
+
+func (b *scopedBody) scopeContent(content *hcl.BodyContent) *hcl.BodyContent {
+	if content == nil {
+		return nil
+	}
+	scoped := &hcl.BodyContent{
+		Attributes:       b.scopeAttributes(content.Attributes),
+		MissingItemRange: content.MissingItemRange,
+	}
+	for _, block := range content.Blocks {
+		scopedBlock := *block
+		scopedBlock.Body = newScopedBody(block.Body, b.scope)
+		scoped.Blocks = append(scoped.Blocks, &scopedBlock)
+	}
+	return scoped
+}
+
+func (b *scopedBody) scopeAttributes(attrs hcl.Attributes) hcl.Attributes {
+	if attrs == nil {
+		return nil
+	}
+	scoped := make(hcl.Attributes, len(attrs))
+	for name, attr := range attrs {
+		scopedAttr := *attr
+		scopedAttr.Expr = &scopedExpr{Expression: attr.Expr, scope: b.scope}
+		scoped[name] = &scopedAttr
+	}
+	return scoped
+}
+
+// scopedExpr is an expression of a scopedBody.
+type scopedExpr struct {
+	hcl.Expression
+	scope func(*hcl.EvalContext) *hcl.EvalContext
+}
+
+var _ hcl.Expression = new(scopedExpr)
+
+func (e *scopedExpr) Value(ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	return e.Expression.Value(e.scope(ctx))
+}
+
+// UnwrapExpression lets static analysis, like hcl.AbsTraversalForExpr, see
+// the actual expression.
+func (e *scopedExpr) UnwrapExpression() hcl.Expression {
+	return e.Expression
+}
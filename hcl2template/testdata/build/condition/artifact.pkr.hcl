@@ -0,0 +1,16 @@
+build {
+  sources = [
+    "source.virtualbox-iso.ubuntu-1204"
+  ]
+
+  post-processor "manifest" {
+    condition = length([for f in artifact.files : f if can(regex("\\.vmdk$", f))]) > 0
+  }
+
+  post-processor "amazon-import" {
+    condition = artifact.builder_id == "packer.virtualbox" && try(artifact.generated_data.Region, "") == "eu-west-1"
+  }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
@@ -0,0 +1,13 @@
+
+build {
+  sources = [
+    "source.virtualbox-iso.ubuntu-1204"
+  ]
+
+  provisioner "shell" {
+    condition = "yes please"
+  }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
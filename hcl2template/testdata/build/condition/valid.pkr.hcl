@@ -0,0 +1,41 @@
+
+variable "harden" {
+  type    = bool
+  default = false
+}
+
+build {
+  sources = [
+    "source.virtualbox-iso.ubuntu-1204"
+  ]
+
+  provisioner "shell" {
+    name      = "always"
+    condition = true
+  }
+
+  provisioner "shell" {
+    name      = "hardening"
+    condition = var.harden
+  }
+
+  provisioner "file" {
+    name      = "on-source"
+    condition = source.name == "ubuntu-1204"
+  }
+
+  provisioner "shell" {
+    name      = "on-host"
+    condition = build.Host != ""
+  }
+
+  post-processor "amazon-import" {
+    condition = var.harden
+  }
+
+  post-processor "manifest" {
+  }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
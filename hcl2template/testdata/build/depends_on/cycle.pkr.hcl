@@ -0,0 +1,21 @@
+
+source "virtualbox-iso" "base" {
+}
+
+build {
+    name       = "a"
+    depends_on = [build.c]
+    sources    = ["source.virtualbox-iso.base"]
+}
+
+build {
+    name       = "b"
+    depends_on = [build.a]
+    sources    = ["source.virtualbox-iso.base"]
+}
+
+build {
+    name       = "c"
+    depends_on = [build.b]
+    sources    = ["source.virtualbox-iso.base"]
+}
@@ -0,0 +1,9 @@
+
+source "virtualbox-iso" "base" {
+}
+
+build {
+    name       = "derived"
+    depends_on = [build.base]
+    sources    = ["source.virtualbox-iso.base"]
+}
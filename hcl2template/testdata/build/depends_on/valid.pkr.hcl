@@ -0,0 +1,18 @@
+
+source "virtualbox-iso" "base" {
+}
+
+source "amazon-ebs" "derived" {
+    string = upstream.base.artifact_id
+}
+
+build {
+    name = "base"
+    sources = ["source.virtualbox-iso.base"]
+}
+
+build {
+    name       = "derived"
+    depends_on = [build.base]
+    sources    = ["source.amazon-ebs.derived"]
+}
@@ -0,0 +1,31 @@
+locals {
+  amis = {
+    "eu-west-1" = "ami-eu"
+    "us-east-1" = "ami-us"
+  }
+}
+
+source "amazon-ebs" "ubuntu" {
+  int = 42
+}
+
+source "virtualbox-iso" "ubuntu" {
+  string = "vbox"
+}
+
+build {
+  source "amazon-ebs.ubuntu" {
+    for_each = local.amis
+    string   = "${each.key}: ${each.value}"
+  }
+
+  source "virtualbox-iso.ubuntu" {
+    count = 2
+    int   = count.index
+  }
+
+  provisioner "shell" {
+    only   = ["amazon-ebs.ubuntu"]
+    string = "provisioning ${each.value}"
+  }
+}
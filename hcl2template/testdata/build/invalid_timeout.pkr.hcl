@@ -0,0 +1,11 @@
+
+build {
+    timeout = "one hour"
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204"
+    ]
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
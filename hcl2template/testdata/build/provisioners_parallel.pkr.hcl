@@ -0,0 +1,40 @@
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
+
+source "amazon-ebs" "ubuntu-1604" {
+}
+
+build {
+  sources = [
+    "source.virtualbox-iso.ubuntu-1204",
+  ]
+  source "source.amazon-ebs.ubuntu-1604" {
+    name = "aws-ubuntu-16.04"
+  }
+
+  provisioner "shell" {
+    name = "before"
+  }
+
+  provisioners_parallel {
+    concurrency = 2
+
+    provisioner "file" {
+      name = "assets"
+    }
+
+    provisioner "shell" {
+      name = "packages"
+    }
+
+    provisioner "shell" {
+      name = "caches"
+      only = ["amazon-ebs.aws-ubuntu-16.04"]
+    }
+  }
+
+  provisioner "shell" {
+    name = "after"
+  }
+}
@@ -0,0 +1,16 @@
+
+build {
+  sources = [
+    "source.virtualbox-iso.ubuntu-1204"
+  ]
+
+  provisioner "shell" {
+    max_retries = 3
+    retry {
+      retry_on = ["(unclosed"]
+    }
+  }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
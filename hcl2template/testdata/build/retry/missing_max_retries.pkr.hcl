@@ -0,0 +1,15 @@
+
+build {
+  sources = [
+    "source.virtualbox-iso.ubuntu-1204"
+  ]
+
+  post-processor "amazon-import" {
+    retry {
+      retry_on = ["RequestLimitExceeded"]
+    }
+  }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
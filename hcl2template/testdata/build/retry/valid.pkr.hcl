@@ -0,0 +1,29 @@
+
+build {
+  sources = [
+    "source.virtualbox-iso.ubuntu-1204"
+  ]
+
+  provisioner "shell" {
+    retry {
+      max_retries = 3
+      retry_on    = ["Could not get lock", "Temporary failure resolving"]
+      no_retry_on = ["syntax error"]
+      backoff {
+        initial    = "2s"
+        max        = "1m"
+        multiplier = 3
+        jitter     = 0.2
+      }
+    }
+  }
+
+  post-processor "amazon-import" {
+    retry {
+      max_retries = 2
+    }
+  }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
@@ -0,0 +1,15 @@
+
+build {
+    timeout = "1h30m"
+
+    sources = [
+        "source.virtualbox-iso.ubuntu-1204"
+    ]
+
+    provisioner "shell" {
+        timeout = "10s"
+    }
+}
+
+source "virtualbox-iso" "ubuntu-1204" {
+}
@@ -0,0 +1,23 @@
+
+communicator "ssh" "default" {
+  ssh_host     = "127.0.0.1"
+  ssh_username = "ubuntu"
+  ssh_password = "ubuntu"
+  ssh_port     = 22
+}
+
+source "null" "web" {
+  communicator = communicator.ssh.default
+}
+
+source "null" "db" {
+  communicator = communicator.ssh.default
+  ssh_port     = 2222
+}
+
+build {
+  sources = [
+    "source.null.web",
+    "source.null.db",
+  ]
+}
@@ -0,0 +1,14 @@
+
+communicator "ssh" "default" {
+  ssh_host = "127.0.0.1"
+}
+
+source "null" "web" {
+  communicator = communicator.ssh.bastion
+}
+
+build {
+  sources = [
+    "source.null.web",
+  ]
+}
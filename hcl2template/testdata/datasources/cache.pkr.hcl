@@ -0,0 +1,8 @@
+data "null" "cached" {
+  input     = "chocolate"
+  cache_ttl = "1h"
+}
+
+data "null" "uncached" {
+  input = "vanilla"
+}
@@ -0,0 +1,16 @@
+variable "token" {
+  type      = string
+  default   = "s3cr3t"
+  ephemeral = true
+}
+
+data "null" "sensitive" {
+  input             = "chocolate"
+  sensitive_outputs = ["output"]
+  cache_ttl         = "1h"
+}
+
+data "null" "ephemeral" {
+  input     = var.token
+  cache_ttl = "1h"
+}
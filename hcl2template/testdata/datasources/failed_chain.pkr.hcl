@@ -0,0 +1,15 @@
+data "null" "failed" {
+  input = ["not", "a", "string"]
+}
+
+data "null" "child" {
+  input = "${data.null.failed.output}-child"
+}
+
+data "null" "grandchild" {
+  input = "${data.null.child.output}-grandchild"
+}
+
+data "null" "unrelated" {
+  input = "unrelated"
+}
@@ -0,0 +1,4 @@
+data "null" "cached" {
+  input     = "chocolate"
+  cache_ttl = "-1h"
+}
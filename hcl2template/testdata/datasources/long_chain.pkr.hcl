@@ -0,0 +1,59 @@
+data "null" "step0" {
+  input = "0"
+}
+
+data "null" "step1" {
+  input = "${data.null.step0.output}-1"
+}
+
+data "null" "step2" {
+  input = "${data.null.step1.output}-2"
+}
+
+data "null" "step3" {
+  input = "${data.null.step2.output}-3"
+}
+
+data "null" "step4" {
+  input = "${data.null.step3.output}-4"
+}
+
+data "null" "step5" {
+  input = "${data.null.step4.output}-5"
+}
+
+data "null" "step6" {
+  input = "${data.null.step5.output}-6"
+}
+
+data "null" "step7" {
+  input = "${data.null.step6.output}-7"
+}
+
+data "null" "step8" {
+  input = "${data.null.step7.output}-8"
+}
+
+data "null" "step9" {
+  input = "${data.null.step8.output}-9"
+}
+
+data "null" "step10" {
+  input = "${data.null.step9.output}-10"
+}
+
+data "null" "step11" {
+  input = "${data.null.step10.output}-11"
+}
+
+data "null" "step12" {
+  input = "${data.null.step11.output}-12"
+}
+
+data "null" "other" {
+  input = "other"
+}
+
+data "null" "joined" {
+  input = "${data.null.step12.output}+${data.null.other.output}"
+}
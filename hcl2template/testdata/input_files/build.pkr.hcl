@@ -0,0 +1,11 @@
+locals {
+  scripts = fileset(".", "scripts/*.sh")
+}
+
+source "null" "test" {
+  communicator = "none"
+}
+
+build {
+  sources = ["source.null.test"]
+}
@@ -0,0 +1,15 @@
+variable "user" {
+  default = "packer"
+}
+
+source "null" "base" {
+  communicator = "none"
+}
+
+build {
+  sources = ["source.null.base"]
+
+  provisioner "shell" {
+    string = path.root
+  }
+}
@@ -0,0 +1,12 @@
+locals {
+  root = path.root
+}
+
+build {
+  name    = "extra"
+  sources = ["source.null.base"]
+
+  provisioner "shell" {
+    string = "${local.root} ${path.root} ${var.user}"
+  }
+}
@@ -0,0 +1,16 @@
+data "amazon-ami" "base" {
+  string = "real"
+  int    = 1
+}
+
+data "amazon-ami" "other" {
+  string = "other"
+}
+
+source "virtualbox-iso" "ubuntu" {
+  string = data.amazon-ami.base.string
+}
+
+build {
+  sources = ["source.virtualbox-iso.ubuntu"]
+}
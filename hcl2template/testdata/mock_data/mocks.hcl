@@ -0,0 +1,5 @@
+mock_data "amazon-ami" "base" {
+  outputs = {
+    string = "mocked"
+  }
+}
@@ -0,0 +1,22 @@
+
+variable "user" {
+  default = "packer"
+}
+
+module "hardening" {
+  source = "./modules/hardening"
+  user   = var.user
+}
+
+build {
+  sources = ["module.hardening.source.null.base"]
+
+  provisioner "shell" {
+    name   = "before"
+    string = module.hardening.local.greeting
+  }
+
+  provisioners {
+    from = module.hardening.build.hardening
+  }
+}
@@ -0,0 +1,29 @@
+
+variable "user" {
+  type = string
+}
+
+variable "level" {
+  default = 1
+}
+
+locals {
+  greeting = "hello ${var.user}"
+}
+
+source "null" "base" {
+  communicator = "ssh"
+  ssh_host     = "127.0.0.1"
+  ssh_username = var.user
+  ssh_password = var.user
+}
+
+build {
+  name = "hardening"
+
+  provisioner "shell" {
+    name   = "harden"
+    string = "${local.greeting} at level ${var.level}"
+    int    = var.level
+  }
+}
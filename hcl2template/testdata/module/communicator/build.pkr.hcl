@@ -0,0 +1,19 @@
+
+variable "user" {
+  default = "root"
+}
+
+communicator "ssh" "default" {
+  ssh_host     = "127.0.0.1"
+  ssh_username = var.user
+  ssh_password = var.user
+}
+
+module "image" {
+  source = "./modules/image"
+  user   = "packer"
+}
+
+build {
+  sources = ["module.image.source.null.base"]
+}
@@ -0,0 +1,14 @@
+
+variable "user" {
+  type = string
+}
+
+communicator "ssh" "default" {
+  ssh_host     = "127.0.0.1"
+  ssh_username = var.user
+  ssh_password = var.user
+}
+
+source "null" "base" {
+  communicator = communicator.ssh.default
+}
@@ -0,0 +1,4 @@
+
+module "self" {
+  source = "./"
+}
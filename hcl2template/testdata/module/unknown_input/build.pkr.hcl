@@ -0,0 +1,10 @@
+
+module "hardening" {
+  source = "../basic/modules/hardening"
+  user   = "packer"
+  colour = "red"
+}
+
+build {
+  sources = ["module.hardening.source.null.base"]
+}
@@ -0,0 +1,34 @@
+
+variable "password" {
+  type    = string
+  default = "s3cr3t"
+}
+
+source "null" "base" {
+  communicator = "none"
+}
+
+build {
+  name    = "images"
+  sources = ["null.base"]
+}
+
+output "image_id" {
+  description = "ID of the image"
+  type        = string
+  value       = builds["images.null.base"].artifact_id
+}
+
+output "region" {
+  value = builds["images.null.base"].generated_data.Region
+}
+
+output "files" {
+  type  = list(string)
+  value = flatten([for a in builds["images.null.base"].artifacts : a.files])
+}
+
+output "password" {
+  sensitive = true
+  value     = var.password
+}
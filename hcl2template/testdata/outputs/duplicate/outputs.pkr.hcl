@@ -0,0 +1,8 @@
+
+output "image_id" {
+  value = "a"
+}
+
+output "image_id" {
+  value = "b"
+}
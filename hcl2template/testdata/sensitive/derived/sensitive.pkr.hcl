@@ -0,0 +1,26 @@
+variable "password" {
+  type      = string
+  default   = "s3cr3t"
+  sensitive = true
+}
+
+data "amazon-ami" "credentials" {
+  string            = "ds-s3cr3t"
+  int               = 42
+  sensitive_outputs = ["string"]
+}
+
+locals {
+  encoded = base64encode(var.password)
+  token   = "token-${data.amazon-ami.credentials.string}"
+}
+
+source "virtualbox-iso" "ubuntu" {
+  string       = local.encoded
+  slice_string = [local.token]
+}
+
+build {
+  description = "built with ${local.encoded}"
+  sources = ["source.virtualbox-iso.ubuntu"]
+}
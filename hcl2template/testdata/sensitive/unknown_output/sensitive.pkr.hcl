@@ -0,0 +1,4 @@
+data "amazon-ami" "credentials" {
+  string            = "ds-s3cr3t"
+  sensitive_outputs = ["password"]
+}
@@ -0,0 +1,30 @@
+source "amazon-ebs" "base" {
+  string = "base"
+  int    = 42
+
+  nested {
+    string = "nested base"
+    int    = 1
+  }
+}
+
+source "amazon-ebs" "child" {
+  extends = source.amazon-ebs.base
+  string  = "child"
+
+  nested {
+    int = 2
+  }
+}
+
+source "amazon-ebs" "grandchild" {
+  extends = source.amazon-ebs.child
+  int     = 43
+}
+
+build {
+  sources = [
+    "source.amazon-ebs.child",
+    "source.amazon-ebs.grandchild",
+  ]
+}
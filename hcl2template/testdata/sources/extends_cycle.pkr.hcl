@@ -0,0 +1,11 @@
+source "amazon-ebs" "a" {
+  extends = source.amazon-ebs.b
+}
+
+source "amazon-ebs" "b" {
+  extends = source.amazon-ebs.a
+}
+
+build {
+  sources = ["source.amazon-ebs.a"]
+}
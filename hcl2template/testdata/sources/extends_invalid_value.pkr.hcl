@@ -0,0 +1,12 @@
+source "amazon-ebs" "base" {
+  string = "base"
+}
+
+source "amazon-ebs" "child" {
+  extends = source.amazon-ebs.base
+  int     = "not a number"
+}
+
+build {
+  sources = ["source.amazon-ebs.child"]
+}
@@ -0,0 +1,19 @@
+variable "name" {
+  type    = string
+  default = "default"
+}
+
+data "amazon-ami" "base" {
+  string = "ami-${var.name}"
+}
+
+source "virtualbox-iso" "ubuntu" {
+  string = data.amazon-ami.base.string
+  int    = 42
+}
+
+build {
+  sources = ["source.virtualbox-iso.ubuntu"]
+
+  post-processor "manifest" {}
+}
@@ -0,0 +1,63 @@
+run "defaults" {
+  assert {
+    condition     = builds["virtualbox-iso.ubuntu"].config.string == "ami-default"
+    error_message = "The default name must be used."
+  }
+}
+
+run "named" {
+  command = "plan"
+  only    = ["virtualbox-iso.ubuntu"]
+
+  variables {
+    name = "named"
+  }
+
+  assert {
+    condition     = builds["virtualbox-iso.ubuntu"].config.string == "ami-default"
+    error_message = "The name must not change the image."
+  }
+}
+
+run "skip_datasources" {
+  skip_datasources = true
+
+  assert {
+    condition     = builds["virtualbox-iso.ubuntu"].post_processors[0][0].type == "manifest"
+    error_message = "The build must have a manifest."
+  }
+}
+
+run "mocked_data" {
+  mock_data "amazon-ami" "base" {
+    outputs = {
+      string = "ami-mocked"
+    }
+  }
+
+  assert {
+    condition     = builds["virtualbox-iso.ubuntu"].config.string == "ami-mocked"
+    error_message = "The image must be the one of the data source."
+  }
+}
+
+run "mocked_source" {
+  command = "build"
+
+  mock_source "virtualbox-iso" "ubuntu" {
+    artifact_id = "vm-mocked"
+    generated_data = {
+      ID = "vm-mocked"
+    }
+  }
+
+  assert {
+    condition     = builds["virtualbox-iso.ubuntu"].artifact_id == "vm-mocked"
+    error_message = "The artifact must be the mocked one."
+  }
+
+  assert {
+    condition     = builds["virtualbox-iso.ubuntu"].generated_data.ID == "vm-mocked"
+    error_message = "The generated data must be the mocked ones."
+  }
+}
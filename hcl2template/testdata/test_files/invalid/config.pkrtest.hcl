@@ -0,0 +1,9 @@
+run "deploy" {
+  command = "apply"
+}
+
+run "check" {
+}
+
+run "check" {
+}
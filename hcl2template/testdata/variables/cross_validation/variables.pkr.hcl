@@ -0,0 +1,35 @@
+variable "encrypt" {
+  type    = bool
+  default = false
+}
+
+variable "kms_key_id" {
+  type    = string
+  default = ""
+
+  validation {
+    condition     = !var.encrypt || var.kms_key_id != ""
+    error_message = "A KMS key must be set to encrypt images."
+  }
+}
+
+variable "disk_size" {
+  type    = number
+  default = 20
+
+  validation {
+    condition     = var.disk_size <= local.max_disk_size
+    error_message = "The disk size cannot exceed the size of the base image."
+  }
+}
+
+locals {
+  max_disk_size = 40
+}
+
+check "disk_encryption" {
+  assert {
+    condition     = !var.encrypt || var.disk_size >= 30
+    error_message = "Encrypted images need a disk of at least 30GB."
+  }
+}
@@ -0,0 +1,33 @@
+variable "old_region" {
+  type       = string
+  default    = "us-east-1"
+  deprecated = "Use var.region instead."
+}
+
+variable "region" {
+  type     = string
+  default  = null
+  nullable = false
+}
+
+variable "token" {
+  type      = string
+  default   = "t0k3n"
+  ephemeral = true
+}
+
+locals {
+  authorization = "Bearer ${var.token}"
+}
+
+source "virtualbox-iso" "ubuntu" {
+  string = local.authorization
+}
+
+build {
+  sources = ["source.virtualbox-iso.ubuntu"]
+
+  post-processor "manifest" {
+    string = local.authorization
+  }
+}
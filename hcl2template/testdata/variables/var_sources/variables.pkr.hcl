@@ -0,0 +1,24 @@
+variable "region" {
+  type    = string
+  default = "us-east-1"
+}
+
+variable "instance_type" {
+  type    = string
+  default = "t2.micro"
+}
+
+variable "tags" {
+  type    = map(string)
+  default = {}
+}
+
+variable "zones" {
+  type    = list(string)
+  default = []
+}
+
+variable "owner" {
+  type    = string
+  default = "packer"
+}
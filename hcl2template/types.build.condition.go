@@ -0,0 +1,196 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// evaluateCondition evaluates the condition of a provisioner or
+// post-processor block, telling whether it should run. A block without a
+// condition, or with a null one, always runs.
+//
+// known is false when the condition depends on values that are only known
+// once the build runs, like most of the build variables; the condition is
+// then evaluated again right before the provisioner or post-processor runs.
+func evaluateCondition(expr hcl.Expression, ectx *hcl.EvalContext) (run bool, known bool, diags hcl.Diagnostics) {
+	const errInvalidCondition = "Invalid condition result"
+
+	if expr == nil {
+		return true, true, nil
+	}
+
+	result, diags := expr.Value(ectx)
+	if diags.HasErrors() {
+		return false, false, diags
+	}
+	result, _ = result.UnmarkDeep()
+	if !result.IsKnown() {
+		return false, false, diags
+	}
+	if result.IsNull() {
+		return true, true, diags
+	}
+
+	result, err := convert.Convert(result, cty.Bool)
+	if err != nil {
+		return false, false, append(diags, &hcl.Diagnostic{
+			Severity:    hcl.DiagError,
+			Summary:     errInvalidCondition,
+			Detail:      fmt.Sprintf("Invalid condition result value: %s.", err),
+			Subject:     expr.Range().Ptr(),
+			Expression:  expr,
+			EvalContext: ectx,
+		})
+	}
+	return result.True(), true, diags
+}
+
+// runOnCondition tells whether a provisioner or post-processor block runs in
+// a build, evaluating its condition while the build is prepared. The blocks
+// whose condition can only be known once the build runs are kept, their
+// condition is evaluated again then.
+func runOnCondition(expr hcl.Expression, ectx *hcl.EvalContext, unknown unknownBuildKeys) (bool, hcl.Diagnostics) {
+	run, known, diags := evaluateCondition(expr, conditionEvalContext(ectx, unknown))
+	if diags.HasErrors() {
+		return false, diags
+	}
+	return run || !known, diags
+}
+
+// unknownBuildKeys are the build variables that are only known once the
+// build runs. They are set to a placeholder in the context the provisioners
+// and post-processors are configured with while the build is prepared.
+type unknownBuildKeys map[string]bool
+
+// conditionEvalContext returns the context conditions are evaluated in when
+// the builds are prepared: the build variables in unknown are unknown in the
+// returned context, so that a condition using them is evaluated later.
+func conditionEvalContext(ectx *hcl.EvalContext, unknown unknownBuildKeys) *hcl.EvalContext {
+	build, ok := ectx.Variables[buildAccessor]
+	if len(unknown) == 0 || !ok || !build.IsKnown() || build.IsNull() || !build.Type().IsObjectType() {
+		return ectx
+	}
+
+	values := map[string]cty.Value{}
+	for k, v := range build.AsValueMap() {
+		if unknown[k] {
+			v = cty.UnknownVal(v.Type())
+		}
+		values[k] = v
+	}
+	child := ectx.NewChild()
+	child.Variables = map[string]cty.Value{
+		buildAccessor: cty.ObjectVal(values),
+	}
+	return child
+}
+
+// postProcessorConditionEvalContext returns the context the condition of a
+// post-processor is evaluated in when the builds are prepared: the artifact
+// it would process is not known yet, so that a condition using it is
+// evaluated again right before the post-processor runs.
+func postProcessorConditionEvalContext(ectx *hcl.EvalContext) *hcl.EvalContext {
+	child := ectx.NewChild()
+	child.Variables = map[string]cty.Value{
+		artifactAccessor: cty.DynamicVal,
+	}
+	// conditionEvalContext looks for the build variables in the context it
+	// is given.
+	if build, ok := ectx.Variables[buildAccessor]; ok {
+		child.Variables[buildAccessor] = build
+	}
+	return child
+}
+
+// artifactEvalContext returns a child of ectx in which artifact is set to the
+// artifact a post-processor would process.
+func artifactEvalContext(ectx *hcl.EvalContext, artifact packersdk.Artifact) (*hcl.EvalContext, error) {
+	value, err := artifactValue(artifact)
+	if err != nil {
+		return nil, err
+	}
+	child := ectx.NewChild()
+	child.Variables = map[string]cty.Value{
+		artifactAccessor: value,
+	}
+	return child, nil
+}
+
+// artifactValue returns the artifact object the conditions of post-processors
+// can inspect: the builder ID, ID, files and generated data of artifact.
+func artifactValue(artifact packersdk.Artifact) (cty.Value, error) {
+	if artifact == nil {
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	}
+
+	files := cty.ListValEmpty(cty.String)
+	if len(artifact.Files()) > 0 {
+		var values []cty.Value
+		for _, f := range artifact.Files() {
+			values = append(values, cty.StringVal(f))
+		}
+		files = cty.ListVal(values)
+	}
+
+	generatedData := map[string]cty.Value{}
+	for k, v := range artifactGeneratedData(artifact) {
+		val, err := ConvertPluginConfigValueToHCLValue(v)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		generatedData[k] = val
+	}
+
+	return cty.ObjectVal(map[string]cty.Value{
+		"builder_id":     cty.StringVal(artifact.BuilderId()),
+		"id":             cty.StringVal(artifact.Id()),
+		"files":          files,
+		"generated_data": cty.ObjectVal(generatedData),
+	}), nil
+}
+
+// buildEvalContext returns a child of ectx in which the build variables are
+// set to buildVars, the values of the build once it ran.
+func buildEvalContext(ectx *hcl.EvalContext, buildVars map[string]interface{}) (*hcl.EvalContext, error) {
+	if len(buildVars) == 0 {
+		return ectx, nil
+	}
+
+	buildValues := map[string]cty.Value{}
+	if !ectx.Variables[buildAccessor].IsNull() {
+		buildValues = ectx.Variables[buildAccessor].AsValueMap()
+	}
+	for k, v := range buildVars {
+		val, err := ConvertPluginConfigValueToHCLValue(v)
+		if err != nil {
+			return nil, err
+		}
+
+		buildValues[k] = val
+	}
+
+	child := ectx.NewChild()
+	child.Variables = map[string]cty.Value{
+		buildAccessor: cty.ObjectVal(buildValues),
+	}
+	return child, nil
+}
+
+// artifactGeneratedData returns the data generated by the builder of
+// artifact, used as build variables by the post-processors.
+func artifactGeneratedData(artifact packersdk.Artifact) map[string]interface{} {
+	generatedData := make(map[string]interface{})
+	if artifactStateData, ok := artifact.State("generated_data").(map[interface{}]interface{}); ok {
+		for k, v := range artifactStateData {
+			generatedData[k.(string)] = v
+		}
+	}
+	return generatedData
+}
@@ -0,0 +1,242 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const buildDependsOnLabel = "depends_on"
+
+// BuildDependency is a reference to another build block, set in the
+// `depends_on` attribute of a build block:
+//
+//	build {
+//	  name       = "derived"
+//	  depends_on = [build.base]
+//	}
+type BuildDependency struct {
+	// Name of the build block depended on.
+	Name string
+
+	Range hcl.Range
+}
+
+// upstreamArtifactType is the type of an artifact of an upstream build, as
+// exposed in the `upstream` accessor.
+var upstreamArtifactType = cty.Object(map[string]cty.Type{
+	"id":         cty.String,
+	"builder_id": cty.String,
+	"files":      cty.List(cty.String),
+})
+
+// upstreamBuildType is the type of an upstream build, as exposed in the
+// `upstream` accessor.
+var upstreamBuildType = cty.Object(map[string]cty.Type{
+	"artifact_id": cty.String,
+	"artifacts":   cty.List(upstreamArtifactType),
+})
+
+func decodeBuildDependencies(attr *hcl.Attribute) ([]BuildDependency, hcl.Diagnostics) {
+	exprs, diags := hcl.ExprList(attr.Expr)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var deps []BuildDependency
+	for _, expr := range exprs {
+		traversal, moreDiags := hcl.AbsTraversalForExpr(expr)
+		if !moreDiags.HasErrors() && len(traversal) == 2 && traversal.RootName() == buildAccessor {
+			if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+				deps = append(deps, BuildDependency{
+					Name:  attr.Name,
+					Range: expr.Range(),
+				})
+				continue
+			}
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + buildDependsOnLabel + " reference",
+			Detail: "A " + buildDependsOnLabel + " entry must reference a named " +
+				"build block, for example: `build.base`.",
+			Subject: expr.Range().Ptr(),
+		})
+	}
+	return deps, diags
+}
+
+// checkBuildDependencies makes sure that all builds referenced in a
+// `depends_on` attribute exist, and that there is no dependency cycle.
+func (cfg *PackerConfig) checkBuildDependencies() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	builds := map[string]*BuildBlock{}
+	for _, build := range cfg.Builds {
+		if build.Name != "" {
+			builds[build.Name] = build
+		}
+	}
+
+	for _, build := range cfg.Builds {
+		for _, dep := range build.DependsOn {
+			if _, found := builds[dep.Name]; !found {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  fmt.Sprintf("Unknown build %q", dep.Name),
+					Detail: fmt.Sprintf("There is no build block named %q. A build "+
+						"can only depend on a build block with a name.", dep.Name),
+					Subject: dep.Range.Ptr(),
+				})
+			}
+		}
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+
+	// Walk the dependency graph depth first, a build we meet again while it
+	// is still on the path is part of a cycle.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(name string, from *BuildDependency) bool
+	visit = func(name string, from *BuildDependency) bool {
+		switch state[name] {
+		case visited:
+			return true
+		case visiting:
+			cycle := append(append([]string{}, path[indexOf(path, name):]...), name)
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Build dependency cycle",
+				Detail: fmt.Sprintf("Builds cannot depend on themselves: %s.",
+					strings.Join(cycle, " -> ")),
+				Subject: from.Range.Ptr(),
+			})
+			return false
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for i := range builds[name].DependsOn {
+			dep := &builds[name].DependsOn[i]
+			if !visit(dep.Name, dep) {
+				return false
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return true
+	}
+	for _, build := range cfg.Builds {
+		if build.Name == "" {
+			continue
+		}
+		if !visit(build.Name, nil) {
+			break
+		}
+	}
+
+	return diags
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkSelectedDependencies makes sure that the builds selected to run with
+// the -only and -except options do not depend on a build block none of whose
+// builds are selected: their artifacts would never be known.
+func checkSelectedDependencies(blocks Builds, builds []packersdk.Build) hcl.Diagnostics {
+	selected := map[string]bool{}
+	for _, b := range builds {
+		if cb, ok := b.(*packer.CoreBuild); ok {
+			selected[cb.BuildName] = true
+		}
+	}
+
+	var diags hcl.Diagnostics
+	for _, block := range blocks {
+		if !selected[block.Name] {
+			continue
+		}
+		for _, dep := range block.DependsOn {
+			if selected[dep.Name] {
+				continue
+			}
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Upstream build not selected",
+				Detail: fmt.Sprintf("The %q build depends on the %q build, whose "+
+					"builds are all excluded by the -only or -except options. "+
+					"Select them too, for example with -only='%s.*'.",
+					block.Name, dep.Name, dep.Name),
+				Subject: dep.Range.Ptr(),
+			})
+		}
+	}
+	return diags
+}
+
+// upstreamValues returns the value of the `upstream` accessor for a build
+// depending on the deps build blocks. artifacts are the artifacts produced by
+// the builds of each build block; when nil, because the upstream builds did
+// not run yet, all values are unknown.
+func upstreamValues(deps []BuildDependency, artifacts map[string][]packersdk.Artifact) cty.Value {
+	res := map[string]cty.Value{}
+	for _, dep := range deps {
+		if artifacts == nil {
+			res[dep.Name] = cty.UnknownVal(upstreamBuildType)
+			continue
+		}
+
+		artifactID := cty.NullVal(cty.String)
+		var vals []cty.Value
+		for _, artifact := range artifacts[dep.Name] {
+			if artifact == nil {
+				continue
+			}
+			if artifactID.IsNull() {
+				artifactID = cty.StringVal(artifact.Id())
+			}
+			files := cty.ListValEmpty(cty.String)
+			if len(artifact.Files()) > 0 {
+				var fileVals []cty.Value
+				for _, file := range artifact.Files() {
+					fileVals = append(fileVals, cty.StringVal(file))
+				}
+				files = cty.ListVal(fileVals)
+			}
+			vals = append(vals, cty.ObjectVal(map[string]cty.Value{
+				"id":         cty.StringVal(artifact.Id()),
+				"builder_id": cty.StringVal(artifact.BuilderId()),
+				"files":      files,
+			}))
+		}
+		list := cty.ListValEmpty(upstreamArtifactType)
+		if len(vals) > 0 {
+			list = cty.ListVal(vals)
+		}
+		res[dep.Name] = cty.ObjectVal(map[string]cty.Value{
+			"artifact_id": artifactID,
+			"artifacts":   list,
+		})
+	}
+	return cty.ObjectVal(res)
+}
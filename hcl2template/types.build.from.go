@@ -21,3 +21,16 @@ func sourceRefFromString(in string) SourceRef {
 		Name: args[1],
 	}
 }
+
+// sourceUseFromString reads the source reference of a build, which can be a
+// source of a module: `module.<module>.source.<type>.<name>`.
+func sourceUseFromString(in string) SourceUseBlock {
+	args := strings.Split(in, ".")
+	if len(args) == 5 && args[0] == moduleAccessor && args[2] == sourceLabel {
+		return SourceUseBlock{
+			SourceRef: SourceRef{Type: args[3], Name: args[4]},
+			Module:    args[1],
+		}
+	}
+	return SourceUseBlock{SourceRef: sourceRefFromString(in)}
+}
@@ -5,6 +5,7 @@ package hcl2template
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
@@ -25,14 +26,21 @@ const (
 
 	buildPostProcessorsLabel = "post-processors"
 
+	buildProvisionersLabel = "provisioners"
+
 	buildHCPPackerRegistryLabel = "hcp_packer_registry"
 )
 
 var buildSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: buildDependsOnLabel},
+	},
 	Blocks: []hcl.BlockHeaderSchema{
 		{Type: buildFromLabel, LabelNames: []string{"type"}},
 		{Type: sourceLabel, LabelNames: []string{"reference"}},
 		{Type: buildProvisionerLabel, LabelNames: []string{"type"}},
+		{Type: buildProvisionersParallelLabel},
+		{Type: buildProvisionersLabel},
 		{Type: buildErrorCleanupProvisionerLabel, LabelNames: []string{"type"}},
 		{Type: buildPostProcessorLabel, LabelNames: []string{"type"}},
 		{Type: buildPostProcessorsLabel, LabelNames: []string{}},
@@ -69,6 +77,14 @@ type BuildBlock struct {
 	// Sources is the list of sources that we want to start in this build block.
 	Sources []SourceUseBlock
 
+	// DependsOn references the build blocks whose builds must complete
+	// before the builds of this block start.
+	DependsOn []BuildDependency
+
+	// Timeout is how long each build of this block can run, 0 means no
+	// limit.
+	Timeout time.Duration
+
 	// ProvisionerBlocks references a list of HCL provisioner block that will
 	// will be ran against the sources.
 	ProvisionerBlocks []*ProvisionerBlock
@@ -94,11 +110,12 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 		Name        string   `hcl:"name,optional"`
 		Description string   `hcl:"description,optional"`
 		FromSources []string `hcl:"sources,optional"`
+		Timeout     string   `hcl:"timeout,optional"`
 		Config      hcl.Body `hcl:",remain"`
 	}
 
 	body := block.Body
-	diags := gohcl.DecodeBody(body, cfg.EvalContext(LocalContext, nil), &b)
+	diags := gohcl.DecodeBody(body, unmarkedEvalContext(cfg.EvalContext(LocalContext, nil)), &b)
 	if diags.HasErrors() {
 		return nil, diags
 	}
@@ -111,6 +128,19 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 	build.Description = b.Description
 	build.HCL2Ref.DefRange = block.DefRange
 
+	if b.Timeout != "" {
+		timeout, err := time.ParseDuration(b.Timeout)
+		if err != nil {
+			return nil, append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to parse timeout duration",
+				Detail:   err.Error(),
+				Subject:  block.DefRange.Ptr(),
+			})
+		}
+		build.Timeout = timeout
+	}
+
 	// Expose build.name during parsing of pps and provisioners
 	ectx := cfg.EvalContext(BuildContext, nil)
 	ectx.Variables[buildAccessor] = cty.ObjectVal(map[string]cty.Value{
@@ -127,11 +157,13 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 	for _, buildFrom := range b.FromSources {
 		hadSource = true
 
-		ref := sourceRefFromString(buildFrom)
+		use := sourceUseFromString(buildFrom)
+		ref := use.SourceRef
 
 		if ref == NoSource ||
 			!hclsyntax.ValidIdentifier(ref.Type) ||
-			!hclsyntax.ValidIdentifier(ref.Name) {
+			!hclsyntax.ValidIdentifier(ref.Name) ||
+			(use.Module != "" && !hclsyntax.ValidIdentifier(use.Module)) {
 			diags = append(diags, &hcl.Diagnostic{
 				Severity: hcl.DiagError,
 				Summary:  "Invalid " + sourceLabel + " reference",
@@ -145,7 +177,7 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 		}
 
 		// source with no body
-		build.Sources = append(build.Sources, SourceUseBlock{SourceRef: ref})
+		build.Sources = append(build.Sources, use)
 	}
 
 	body = b.Config
@@ -154,6 +186,11 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 	if diags.HasErrors() {
 		return nil, diags
 	}
+	if attr, ok := content.Attributes[buildDependsOnLabel]; ok {
+		deps, moreDiags := decodeBuildDependencies(attr)
+		diags = append(diags, moreDiags...)
+		build.DependsOn = deps
+	}
 	for _, block := range content.Blocks {
 		switch block.Type {
 		case buildHCPPackerRegistryLabel:
@@ -173,12 +210,12 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 			build.HCPPackerRegistry = hcpPackerRegistry
 		case sourceLabel:
 			hadSource = true
-			ref, moreDiags := p.decodeBuildSource(block)
+			refs, moreDiags := p.decodeBuildSource(block, ectx)
 			diags = append(diags, moreDiags...)
 			if moreDiags.HasErrors() {
 				continue
 			}
-			build.Sources = append(build.Sources, ref)
+			build.Sources = append(build.Sources, refs...)
 		case buildProvisionerLabel:
 			p, moreDiags := p.decodeProvisioner(block, ectx)
 			diags = append(diags, moreDiags...)
@@ -186,6 +223,20 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 				continue
 			}
 			build.ProvisionerBlocks = append(build.ProvisionerBlocks, p)
+		case buildProvisionersLabel:
+			provisioners, moreDiags := cfg.decodeModuleProvisioners(block)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+			build.ProvisionerBlocks = append(build.ProvisionerBlocks, provisioners...)
+		case buildProvisionersParallelLabel:
+			p, moreDiags := p.decodeProvisionersParallel(block, ectx)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+			build.ProvisionerBlocks = append(build.ProvisionerBlocks, p)
 		case buildErrorCleanupProvisionerLabel:
 			if build.ErrorCleanupProvisionerBlock != nil {
 				diags = append(diags, &hcl.Diagnostic{
@@ -233,7 +284,9 @@ func (p *Parser) decodeBuildConfig(block *hcl.Block, cfg *PackerConfig) (*BuildB
 		}
 	}
 
-	if !hadSource {
+	// The build blocks of a module are not built, they hold provisioners
+	// for the configurations using the module.
+	if !hadSource && !cfg.isModule {
 		diags = append(diags, &hcl.Diagnostic{
 			Summary:  "missing source reference",
 			Detail:   "a build block must reference at least one source to be built",
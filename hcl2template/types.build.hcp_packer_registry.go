@@ -37,7 +37,28 @@ func (p *Parser) decodeHCPRegistry(block *hcl.Block, cfg *PackerConfig) (*HCPPac
 		Config       hcl.Body          `hcl:",remain"`
 	}
 	ectx := cfg.EvalContext(BuildContext, nil)
-	diags := gohcl.DecodeBody(body, ectx, &b)
+
+	// HCP Packer metadata is persisted, it cannot be derived from ephemeral
+	// variables.
+	var diags hcl.Diagnostics
+	attrs, _ := body.JustAttributes()
+	for _, attr := range attrs {
+		value, _ := attr.Expr.Value(ectx)
+		if hasMark(value, ephemeralMark) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Ephemeral value in " + buildHCPPackerRegistryLabel,
+				Detail: fmt.Sprintf("The value of %q is derived from an ephemeral "+
+					"variable, which cannot be sent to HCP Packer.", attr.Name),
+				Subject: attr.Expr.Range().Ptr(),
+			})
+		}
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	diags = gohcl.DecodeBody(body, unmarkedEvalContext(ectx), &b)
 	if diags.HasErrors() {
 		return nil, diags
 	}
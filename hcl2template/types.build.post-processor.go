@@ -9,7 +9,9 @@ import (
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hcldec"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
 )
 
 // ProvisionerBlock references a detected but unparsed post processor
@@ -18,6 +20,13 @@ type PostProcessorBlock struct {
 	PName             string
 	OnlyExcept        OnlyExcept
 	KeepInputArtifact *bool
+	// MaxRetries and Retry are set with a retry block, the post-processor
+	// is then retried when it fails.
+	MaxRetries int
+	Retry      *packer.RetryPolicy
+	// Condition, when set, is a boolean expression telling whether the
+	// post-processor runs.
+	Condition hcl.Expression
 
 	HCL2Ref
 }
@@ -28,14 +37,16 @@ func (p *PostProcessorBlock) String() string {
 
 func (p *Parser) decodePostProcessor(block *hcl.Block, ectx *hcl.EvalContext) (*PostProcessorBlock, hcl.Diagnostics) {
 	var b struct {
-		Name              string   `hcl:"name,optional"`
-		Only              []string `hcl:"only,optional"`
-		Except            []string `hcl:"except,optional"`
-		KeepInputArtifact *bool    `hcl:"keep_input_artifact,optional"`
-		Rest              hcl.Body `hcl:",remain"`
+		Name              string         `hcl:"name,optional"`
+		Only              []string       `hcl:"only,optional"`
+		Except            []string       `hcl:"except,optional"`
+		KeepInputArtifact *bool          `hcl:"keep_input_artifact,optional"`
+		Condition         hcl.Expression `hcl:"condition,optional"`
+		Retry             *retryBlock    `hcl:"retry,block"`
+		Rest              hcl.Body       `hcl:",remain"`
 	}
 
-	diags := gohcl.DecodeBody(block.Body, ectx, &b)
+	diags := gohcl.DecodeBody(block.Body, unmarkedEvalContext(ectx), &b)
 	if diags.HasErrors() {
 		return nil, diags
 	}
@@ -46,6 +57,7 @@ func (p *Parser) decodePostProcessor(block *hcl.Block, ectx *hcl.EvalContext) (*
 		OnlyExcept:        OnlyExcept{Only: b.Only, Except: b.Except},
 		HCL2Ref:           newHCL2Ref(block, b.Rest),
 		KeepInputArtifact: b.KeepInputArtifact,
+		Condition:         b.Condition,
 	}
 
 	diags = diags.Extend(postProcessor.OnlyExcept.Validate())
@@ -53,6 +65,24 @@ func (p *Parser) decodePostProcessor(block *hcl.Block, ectx *hcl.EvalContext) (*
 		return nil, diags
 	}
 
+	if b.Retry != nil {
+		retry, moreDiags := decodeRetryBlock(b.Retry, block.DefRange.Ptr())
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			return nil, diags
+		}
+		if b.Retry.MaxRetries == 0 {
+			return nil, append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing max_retries",
+				Detail:   "A " + buildRetryLabel + " block needs max_retries to be set.",
+				Subject:  block.DefRange.Ptr(),
+			})
+		}
+		postProcessor.MaxRetries = b.Retry.MaxRetries
+		postProcessor.Retry = retry
+	}
+
 	return postProcessor, diags
 }
 
@@ -95,3 +125,24 @@ func (cfg *PackerConfig) startPostProcessor(source SourceUseBlock, pp *PostProce
 	}
 	return hclPostProcessor, diags
 }
+
+// manifestPostProcessorType is the type of the post-processor writing the
+// manifest of the builds, which persists its configuration.
+const manifestPostProcessorType = "manifest"
+
+// checkEphemeralManifest errors when the configuration of the manifest
+// post-processor pp is derived from ephemeral values, as they would be written
+// to the manifest.
+func checkEphemeralManifest(pp *PostProcessorBlock, ectx *hcl.EvalContext, postProcessor Decodable) hcl.Diagnostics {
+	value, _ := hcldec.Decode(pp.HCL2Ref.Rest, postProcessor.ConfigSpec(), ectx)
+	if !hasMark(value, ephemeralMark) {
+		return nil
+	}
+	return hcl.Diagnostics{&hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Ephemeral value in manifest",
+		Detail: fmt.Sprintf("The configuration of %s is derived from an "+
+			"ephemeral variable, which cannot be written to a manifest.", pp),
+		Subject: pp.DefRange.Ptr(),
+	}}
+}
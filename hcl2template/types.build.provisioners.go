@@ -12,6 +12,7 @@ import (
 	"github.com/hashicorp/hcl/v2/gohcl"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	hcl2shim "github.com/hashicorp/packer/hcl2template/shim"
+	"github.com/hashicorp/packer/packer"
 	"github.com/zclconf/go-cty/cty"
 )
 
@@ -70,6 +71,16 @@ type ProvisionerBlock struct {
 	Timeout     time.Duration
 	Override    map[string]interface{}
 	OnlyExcept  OnlyExcept
+	// Retry, set with a retry block, tells which errors are retried and
+	// how long to wait before each retry.
+	Retry *packer.RetryPolicy
+	// Condition, when set, is a boolean expression telling whether the
+	// provisioner runs.
+	Condition hcl.Expression
+	// Parallel, set for a provisioners_parallel block, lists the
+	// provisioners run concurrently, at most Concurrency at a time.
+	Parallel    []*ProvisionerBlock
+	Concurrency int
 	HCL2Ref
 }
 
@@ -79,16 +90,18 @@ func (p *ProvisionerBlock) String() string {
 
 func (p *Parser) decodeProvisioner(block *hcl.Block, ectx *hcl.EvalContext) (*ProvisionerBlock, hcl.Diagnostics) {
 	var b struct {
-		Name        string    `hcl:"name,optional"`
-		PauseBefore string    `hcl:"pause_before,optional"`
-		MaxRetries  int       `hcl:"max_retries,optional"`
-		Timeout     string    `hcl:"timeout,optional"`
-		Only        []string  `hcl:"only,optional"`
-		Except      []string  `hcl:"except,optional"`
-		Override    cty.Value `hcl:"override,optional"`
-		Rest        hcl.Body  `hcl:",remain"`
+		Name        string         `hcl:"name,optional"`
+		PauseBefore string         `hcl:"pause_before,optional"`
+		MaxRetries  int            `hcl:"max_retries,optional"`
+		Timeout     string         `hcl:"timeout,optional"`
+		Only        []string       `hcl:"only,optional"`
+		Except      []string       `hcl:"except,optional"`
+		Override    cty.Value      `hcl:"override,optional"`
+		Condition   hcl.Expression `hcl:"condition,optional"`
+		Retry       *retryBlock    `hcl:"retry,block"`
+		Rest        hcl.Body       `hcl:",remain"`
 	}
-	diags := gohcl.DecodeBody(block.Body, ectx, &b)
+	diags := gohcl.DecodeBody(block.Body, unmarkedEvalContext(ectx), &b)
 	if diags.HasErrors() {
 		return nil, diags
 	}
@@ -98,6 +111,7 @@ func (p *Parser) decodeProvisioner(block *hcl.Block, ectx *hcl.EvalContext) (*Pr
 		PName:      b.Name,
 		MaxRetries: b.MaxRetries,
 		OnlyExcept: OnlyExcept{Only: b.Only, Except: b.Except},
+		Condition:  b.Condition,
 		HCL2Ref:    newHCL2Ref(block, b.Rest),
 	}
 
@@ -106,6 +120,36 @@ func (p *Parser) decodeProvisioner(block *hcl.Block, ectx *hcl.EvalContext) (*Pr
 		return nil, diags
 	}
 
+	if b.Retry != nil {
+		if b.Retry.MaxRetries != 0 && b.MaxRetries != 0 {
+			return nil, append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "max_retries is set twice",
+				Detail: "Set max_retries either on the provisioner or in its " +
+					buildRetryLabel + " block.",
+				Subject: block.DefRange.Ptr(),
+			})
+		}
+		retry, moreDiags := decodeRetryBlock(b.Retry, block.DefRange.Ptr())
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			return nil, diags
+		}
+		provisioner.Retry = retry
+		if b.Retry.MaxRetries != 0 {
+			provisioner.MaxRetries = b.Retry.MaxRetries
+		}
+		if provisioner.MaxRetries == 0 {
+			return nil, append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing max_retries",
+				Detail: "A " + buildRetryLabel + " block needs max_retries to be set, " +
+					"on the provisioner or in the block.",
+				Subject: block.DefRange.Ptr(),
+			})
+		}
+	}
+
 	if !b.Override.IsNull() {
 		if !b.Override.Type().IsObjectType() {
 			return nil, append(diags, &hcl.Diagnostic{
@@ -130,7 +174,7 @@ func (p *Parser) decodeProvisioner(block *hcl.Block, ectx *hcl.EvalContext) (*Pr
 			}
 
 			for option, value := range overrides.AsValueMap() {
-				buildOverrides[option] = hcl2shim.ConfigValueFromHCL2(value)
+				buildOverrides[option] = hcl2shim.ConfigValueFromHCL2(filterSensitiveValues(value))
 			}
 			override[buildName] = buildOverrides
 		}
@@ -0,0 +1,118 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/packer/packer"
+)
+
+const buildProvisionersParallelLabel = "provisioners_parallel"
+
+var provisionersParallelSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: buildProvisionerLabel, LabelNames: []string{"type"}},
+	},
+}
+
+// decodeProvisionersParallel decodes a provisioners_parallel block, a group of
+// provisioners run concurrently:
+//
+//	provisioners_parallel {
+//	  concurrency = 2
+//
+//	  provisioner "file" { ... }
+//	  provisioner "shell" { ... }
+//	}
+//
+// The group is a ProvisionerBlock of type provisioners_parallel, listing its
+// provisioners in Parallel.
+func (p *Parser) decodeProvisionersParallel(block *hcl.Block, ectx *hcl.EvalContext) (*ProvisionerBlock, hcl.Diagnostics) {
+	var b struct {
+		Concurrency int      `hcl:"concurrency,optional"`
+		Rest        hcl.Body `hcl:",remain"`
+	}
+	diags := gohcl.DecodeBody(block.Body, unmarkedEvalContext(ectx), &b)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	if b.Concurrency < 0 {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid concurrency",
+			Detail:   "The concurrency of a " + buildProvisionersParallelLabel + " block cannot be negative.",
+			Subject:  block.DefRange.Ptr(),
+		})
+	}
+
+	content, moreDiags := b.Rest.Content(provisionersParallelSchema)
+	diags = append(diags, moreDiags...)
+	if moreDiags.HasErrors() {
+		return nil, diags
+	}
+
+	group := &ProvisionerBlock{
+		PType:       buildProvisionersParallelLabel,
+		Concurrency: b.Concurrency,
+		Parallel:    []*ProvisionerBlock{},
+		HCL2Ref:     newHCL2Ref(block, b.Rest),
+	}
+	for _, block := range content.Blocks {
+		provisioner, moreDiags := p.decodeProvisioner(block, ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		group.Parallel = append(group.Parallel, provisioner)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	if len(group.Parallel) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  "Empty " + buildProvisionersParallelLabel + " block",
+			Detail:   "This " + buildProvisionersParallelLabel + " block has no provisioner, it will be ignored.",
+			Subject:  block.DefRange.Ptr(),
+		})
+	}
+
+	return group, diags
+}
+
+// getCoreBuildProvisionersParallel starts the provisioners of the
+// provisioners_parallel block pb that apply to source, grouping them in a
+// single provisioner that runs them concurrently. ok is false when none of
+// them applies.
+func (cfg *PackerConfig) getCoreBuildProvisionersParallel(source SourceUseBlock, pb *ProvisionerBlock, ectx *hcl.EvalContext, unknown unknownBuildKeys) (res packer.CoreBuildProvisioner, ok bool, diags hcl.Diagnostics) {
+	provisioners, diags := cfg.getCoreBuildProvisioners(source, pb.Parallel, ectx, unknown)
+	if diags.HasErrors() || len(provisioners) == 0 {
+		return packer.CoreBuildProvisioner{}, false, diags
+	}
+
+	return packer.CoreBuildProvisioner{
+		PType: pb.PType,
+		Provisioner: &packer.ParallelProvisionHook{
+			Provisioners: provisioners,
+			Concurrency:  pb.Concurrency,
+		},
+	}, true, diags
+}
+
+// flattenProvisionerBlocks returns blocks, with the provisioners of the
+// provisioners_parallel blocks in place of these.
+func flattenProvisionerBlocks(blocks []*ProvisionerBlock) []*ProvisionerBlock {
+	var res []*ProvisionerBlock
+	for _, pb := range blocks {
+		if pb.Parallel != nil {
+			res = append(res, flattenProvisionerBlocks(pb.Parallel)...)
+			continue
+		}
+		res = append(res, pb)
+	}
+	return res
+}
@@ -0,0 +1,130 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/packer/packer"
+)
+
+const (
+	buildRetryLabel = "retry"
+
+	defaultRetryInitialBackoff = time.Second
+	defaultRetryMultiplier     = 2
+)
+
+// retryBlock is the `retry` block of a provisioner or post-processor:
+//
+//	retry {
+//	  max_retries = 5
+//	  retry_on    = ["Could not get lock", "Temporary failure resolving"]
+//	  no_retry_on = ["syntax error"]
+//	  backoff {
+//	    initial    = "2s"
+//	    max        = "1m"
+//	    multiplier = 2
+//	    jitter     = 0.2
+//	  }
+//	}
+type retryBlock struct {
+	MaxRetries int           `hcl:"max_retries,optional"`
+	RetryOn    []string      `hcl:"retry_on,optional"`
+	NoRetryOn  []string      `hcl:"no_retry_on,optional"`
+	Backoff    *backoffBlock `hcl:"backoff,block"`
+}
+
+type backoffBlock struct {
+	Initial    string  `hcl:"initial,optional"`
+	Max        string  `hcl:"max,optional"`
+	Multiplier float64 `hcl:"multiplier,optional"`
+	Jitter     float64 `hcl:"jitter,optional"`
+}
+
+// decodeRetryBlock validates a retry block, subject is the range of the
+// provisioner or post-processor block it is part of.
+func decodeRetryBlock(b *retryBlock, subject *hcl.Range) (*packer.RetryPolicy, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	policy := &packer.RetryPolicy{}
+
+	compile := func(attr string, exprs []string) []*regexp.Regexp {
+		var res []*regexp.Regexp
+		for _, expr := range exprs {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  fmt.Sprintf("Invalid %s regular expression", attr),
+					Detail:   fmt.Sprintf("%q: %s", expr, err),
+					Subject:  subject,
+				})
+				continue
+			}
+			res = append(res, re)
+		}
+		return res
+	}
+	policy.RetryOn = compile("retry_on", b.RetryOn)
+	policy.NoRetryOn = compile("no_retry_on", b.NoRetryOn)
+
+	if b.MaxRetries < 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid max_retries",
+			Detail:   "max_retries cannot be negative.",
+			Subject:  subject,
+		})
+	}
+
+	if b.Backoff == nil {
+		return policy, diags
+	}
+
+	duration := func(attr, value string, def time.Duration) time.Duration {
+		if value == "" {
+			return def
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Failed to parse backoff %s duration", attr),
+				Detail:   err.Error(),
+				Subject:  subject,
+			})
+		}
+		return d
+	}
+	policy.InitialBackoff = duration("initial", b.Backoff.Initial, defaultRetryInitialBackoff)
+	policy.MaxBackoff = duration("max", b.Backoff.Max, 0)
+
+	policy.Multiplier = b.Backoff.Multiplier
+	switch {
+	case policy.Multiplier == 0:
+		policy.Multiplier = defaultRetryMultiplier
+	case policy.Multiplier < 1:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid backoff multiplier",
+			Detail:   "The backoff multiplier must be greater than or equal to 1.",
+			Subject:  subject,
+		})
+	}
+
+	policy.Jitter = b.Backoff.Jitter
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid backoff jitter",
+			Detail:   "The backoff jitter is a fraction of the delay, between 0 and 1.",
+			Subject:  subject,
+		})
+	}
+
+	return policy, diags
+}
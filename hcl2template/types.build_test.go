@@ -4,9 +4,14 @@
 package hcl2template
 
 import (
+	"errors"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	. "github.com/hashicorp/packer/hcl2template/internal"
 	"github.com/hashicorp/packer/packer"
@@ -688,3 +693,353 @@ func TestParse_build(t *testing.T) {
 	}
 	testParse(t, tests)
 }
+
+func TestParse_build_dependsOn(t *testing.T) {
+	tests := []struct {
+		name        string
+		filename    string
+		only        []string
+		wantErr     string
+		wantDepends map[string][]string
+	}{
+		{"valid", "testdata/build/depends_on/valid.pkr.hcl", nil, "",
+			map[string][]string{
+				"base.virtualbox-iso.base":   nil,
+				"derived.amazon-ebs.derived": {"base"},
+			},
+		},
+		{"cycle", "testdata/build/depends_on/cycle.pkr.hcl", nil, "a -> c -> b -> a", nil},
+		{"unknown build", "testdata/build/depends_on/unknown.pkr.hcl", nil, `Unknown build "base"`, nil},
+		{"upstream not selected", "testdata/build/depends_on/valid.pkr.hcl", []string{"derived.*"},
+			"Upstream build not selected", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testParseConfig(t, getBasicParser(), tt.filename)
+			diags := cfg.Initialize(packer.InitializeOptions{})
+			var builds []packersdk.Build
+			if !diags.HasErrors() {
+				builds, diags = cfg.GetBuilds(packer.GetBuildsOptions{Only: tt.only})
+			}
+			if tt.wantErr != "" {
+				if !strings.Contains(diags.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %s", tt.wantErr, diags)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected error: %s", diags)
+			}
+
+			for _, b := range builds {
+				cb := b.(*packer.CoreBuild)
+				if diff := cmp.Diff(tt.wantDepends[cb.Name()], cb.DependsOn); diff != "" {
+					t.Fatalf("unexpected dependencies for %s: %s", cb.Name(), diff)
+				}
+				if cb.PrepareUpstream == nil {
+					continue
+				}
+
+				if got := cb.HCLConfig.GetAttr("string"); got.IsKnown() {
+					t.Fatalf("expected the upstream artifact id to be unknown before the upstream build, got %#v", got)
+				}
+				warnings, err := cb.PrepareUpstream(map[string][]packersdk.Artifact{
+					"base": {&packersdk.MockArtifact{IdValue: "base-image"}},
+				})
+				if err != nil {
+					t.Fatalf("failed to prepare upstream values: %s", err)
+				}
+				if len(warnings) != 0 {
+					t.Fatalf("unexpected warnings: %v", warnings)
+				}
+				if got := cb.Builder.(*MockBuilder).Config.String; got != "base-image" {
+					t.Fatalf("expected the upstream artifact id to be set, got %q", got)
+				}
+				if got := cb.HCLConfig.GetAttr("string"); !got.RawEquals(cty.StringVal("base-image")) {
+					t.Fatalf("expected the upstream artifact id in the config of the build, got %#v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestParse_build_retry(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		wantErr  string
+	}{
+		{"valid", "testdata/build/retry/valid.pkr.hcl", ""},
+		{"invalid regexp", "testdata/build/retry/invalid_regexp.pkr.hcl", "Invalid retry_on regular expression"},
+		{"missing max_retries", "testdata/build/retry/missing_max_retries.pkr.hcl", "Missing max_retries"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr != "" {
+				cfg := testParseConfig(t, getBasicParser(), tt.filename)
+				diags := cfg.Initialize(packer.InitializeOptions{})
+				if !strings.Contains(diags.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %s", tt.wantErr, diags)
+				}
+				return
+			}
+
+			cfg, _ := testInitializeConfig(t, getBasicParser(), tt.filename, packer.InitializeOptions{})
+			cb := testGetBuilds(t, cfg, packer.GetBuildsOptions{})[0].(*packer.CoreBuild)
+
+			prov, ok := cb.Provisioners[0].Provisioner.(*packer.RetriedProvisioner)
+			if !ok {
+				t.Fatalf("expected a retried provisioner, got %T", cb.Provisioners[0].Provisioner)
+			}
+			if prov.MaxRetries != 3 {
+				t.Errorf("expected 3 retries, got %d", prov.MaxRetries)
+			}
+			retry := prov.Retry
+			if retry.InitialBackoff != 2*time.Second || retry.MaxBackoff != time.Minute ||
+				retry.Multiplier != 3 || retry.Jitter != 0.2 {
+				t.Errorf("unexpected backoff: %#v", retry)
+			}
+			if !retry.ShouldRetry(errors.New("E: Could not get lock /var/lib/dpkg/lock")) {
+				t.Error("lock errors should be retried")
+			}
+			if retry.ShouldRetry(errors.New("syntax error: Could not get lock")) {
+				t.Error("syntax errors should not be retried")
+			}
+			if retry.ShouldRetry(errors.New("exit status 1")) {
+				t.Error("errors not matching retry_on should not be retried")
+			}
+
+			pp, ok := cb.PostProcessors[0][0].PostProcessor.(*packer.RetriedPostProcessor)
+			if !ok {
+				t.Fatalf("expected a retried post-processor, got %T", cb.PostProcessors[0][0].PostProcessor)
+			}
+			if pp.MaxRetries != 2 || pp.Retry.Backoff(0) != 0 {
+				t.Errorf("unexpected post-processor retry: %#v", pp)
+			}
+		})
+	}
+}
+
+func TestParse_build_condition(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/build/condition/valid.pkr.hcl", packer.InitializeOptions{})
+		cb := testGetBuilds(t, cfg, packer.GetBuildsOptions{})[0].(*packer.CoreBuild)
+
+		var names []string
+		for _, p := range cb.Provisioners {
+			names = append(names, p.PName)
+		}
+		if diff := cmp.Diff([]string{"always", "on-source", "on-host"}, names); diff != "" {
+			t.Fatalf("unexpected provisioners: %s", diff)
+		}
+		if len(cb.PostProcessors) != 1 || len(cb.PostProcessors[0]) != 1 ||
+			cb.PostProcessors[0][0].PType != "manifest" {
+			t.Fatalf("unexpected post-processors: %#v", cb.PostProcessors)
+		}
+
+		// The condition of the on-host provisioner is only known once the
+		// build ran.
+		onHost := cb.Provisioners[2].Provisioner.(*HCL2Provisioner)
+		for host, want := range map[string]bool{"": false, "10.0.0.1": true} {
+			run, err := onHost.ShouldRun(map[string]interface{}{"Host": host})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if run != want {
+				t.Errorf("with Host %q: expected run to be %t", host, want)
+			}
+		}
+	})
+
+	t.Run("unknown build values", func(t *testing.T) {
+		// Only the build variables set as unknown are, whatever their
+		// placeholder value.
+		ectx := &hcl.EvalContext{
+			Variables: map[string]cty.Value{
+				buildAccessor: cty.ObjectVal(map[string]cty.Value{
+					"name": cty.StringVal("<unknown>"),
+					"ID":   cty.StringVal("<unknown>"),
+				}),
+			},
+		}
+		build := conditionEvalContext(ectx, unknownBuildKeys{"ID": true}).Variables[buildAccessor]
+		if !build.GetAttr("name").RawEquals(cty.StringVal("<unknown>")) {
+			t.Errorf("expected the name to be known, got %#v", build.GetAttr("name"))
+		}
+		if build.GetAttr("ID").IsKnown() {
+			t.Errorf("expected the ID to be unknown, got %#v", build.GetAttr("ID"))
+		}
+	})
+
+	t.Run("artifact", func(t *testing.T) {
+		cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/build/condition/artifact.pkr.hcl", packer.InitializeOptions{})
+		cb := testGetBuilds(t, cfg, packer.GetBuildsOptions{})[0].(*packer.CoreBuild)
+
+		// The conditions using the artifact are evaluated right before the
+		// post-processors run.
+		if len(cb.PostProcessors) != 2 {
+			t.Fatalf("expected the 2 post-processors to be kept, got %#v", cb.PostProcessors)
+		}
+		tests := []struct {
+			artifact *packersdk.MockArtifact
+			want     []bool
+		}{
+			{&packersdk.MockArtifact{FilesValue: []string{"disk.vmdk", "box.ovf"}}, []bool{true, false}},
+			{&packersdk.MockArtifact{FilesValue: []string{"disk.qcow2"}}, []bool{false, false}},
+			{&packersdk.MockArtifact{
+				BuilderIdValue: "packer.virtualbox",
+				StateValues: map[string]interface{}{
+					"generated_data": map[interface{}]interface{}{"Region": "eu-west-1"},
+				},
+			}, []bool{false, true}},
+		}
+		for _, tt := range tests {
+			for i, ppSeq := range cb.PostProcessors {
+				pp := ppSeq[0].PostProcessor.(*HCL2PostProcessor)
+				run, err := pp.ShouldRun(tt.artifact)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if run != tt.want[i] {
+					t.Errorf("%s with %#v: expected run to be %t", ppSeq[0].PType, tt.artifact, tt.want[i])
+				}
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/build/condition/invalid.pkr.hcl", packer.InitializeOptions{})
+		_, diags := cfg.GetBuilds(packer.GetBuildsOptions{})
+		if !strings.Contains(diags.Error(), "Invalid condition result") {
+			t.Fatalf("expected an invalid condition error, got %s", diags)
+		}
+	})
+}
+
+func TestParse_build_provisioners_parallel(t *testing.T) {
+	cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/build/provisioners_parallel.pkr.hcl", packer.InitializeOptions{})
+	builds := testGetBuilds(t, cfg, packer.GetBuildsOptions{})
+
+	want := map[string][]string{
+		"virtualbox-iso.ubuntu-1204":  {"assets", "packages"},
+		"amazon-ebs.aws-ubuntu-16.04": {"assets", "packages", "caches"},
+	}
+	for _, b := range builds {
+		cb := b.(*packer.CoreBuild)
+		if len(cb.Provisioners) != 3 {
+			t.Fatalf("%s: expected 3 provisioners, got %d", cb.Type, len(cb.Provisioners))
+		}
+		if cb.Provisioners[0].PName != "before" || cb.Provisioners[2].PName != "after" {
+			t.Fatalf("%s: provisioners are not in order", cb.Type)
+		}
+
+		group, ok := cb.Provisioners[1].Provisioner.(*packer.ParallelProvisionHook)
+		if !ok {
+			t.Fatalf("%s: expected a parallel provisioner group, got %T", cb.Type, cb.Provisioners[1].Provisioner)
+		}
+		if group.Concurrency != 2 {
+			t.Errorf("%s: expected a concurrency of 2, got %d", cb.Type, group.Concurrency)
+		}
+		var names []string
+		for _, p := range group.Provisioners {
+			names = append(names, p.PName)
+		}
+		if diff := cmp.Diff(want[cb.Type], names); diff != "" {
+			t.Errorf("%s: unexpected provisioners in group: %s", cb.Type, diff)
+		}
+	}
+}
+
+func TestParse_build_timeout(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/build/timeout.pkr.hcl", packer.InitializeOptions{})
+		builds := testGetBuilds(t, cfg, packer.GetBuildsOptions{})
+		if timeout := builds[0].(*packer.CoreBuild).Timeout; timeout != 90*time.Minute {
+			t.Fatalf("expected a 1h30m timeout, got %s", timeout)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		cfg := testParseConfig(t, getBasicParser(), "testdata/build/invalid_timeout.pkr.hcl")
+		diags := cfg.Initialize(packer.InitializeOptions{})
+		if !strings.Contains(diags.Error(), "Failed to parse timeout duration") {
+			t.Fatalf("expected a timeout error, got %s", diags)
+		}
+	})
+}
+
+func TestParse_build_for_each(t *testing.T) {
+	getBuilds := func(t *testing.T, opts packer.GetBuildsOptions) []packersdk.Build {
+		cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/build/for_each.pkr.hcl", packer.InitializeOptions{})
+		return testGetBuilds(t, cfg, opts)
+	}
+
+	t.Run("instances", func(t *testing.T) {
+		type instance struct {
+			Config      cty.Value
+			Provisioner string
+		}
+		want := map[string]instance{
+			`amazon-ebs.ubuntu["eu-west-1"]`: {
+				cty.ObjectVal(map[string]cty.Value{
+					"string": cty.StringVal("eu-west-1: ami-eu"),
+					"int":    cty.NumberIntVal(42),
+				}),
+				"provisioning ami-eu",
+			},
+			`amazon-ebs.ubuntu["us-east-1"]`: {
+				cty.ObjectVal(map[string]cty.Value{
+					"string": cty.StringVal("us-east-1: ami-us"),
+					"int":    cty.NumberIntVal(42),
+				}),
+				"provisioning ami-us",
+			},
+			"virtualbox-iso.ubuntu[0]": {
+				cty.ObjectVal(map[string]cty.Value{
+					"string": cty.StringVal("vbox"),
+					"int":    cty.NumberIntVal(0),
+				}),
+				"",
+			},
+			"virtualbox-iso.ubuntu[1]": {
+				cty.ObjectVal(map[string]cty.Value{
+					"string": cty.StringVal("vbox"),
+					"int":    cty.NumberIntVal(1),
+				}),
+				"",
+			},
+		}
+
+		got := map[string]instance{}
+		for _, b := range getBuilds(t, packer.GetBuildsOptions{}) {
+			cb := b.(*packer.CoreBuild)
+			var inst instance
+			inst.Config = cty.ObjectVal(map[string]cty.Value{
+				"string": cb.HCLConfig.GetAttr("string"),
+				"int":    cb.HCLConfig.GetAttr("int"),
+			})
+			if len(cb.Provisioners) > 0 {
+				inst.Provisioner = cb.Provisioners[0].HCLConfig.GetAttr("string").AsString()
+			}
+			got[cb.Name()] = inst
+		}
+		if diff := cmp.Diff(want, got, ctyValueComparer); diff != "" {
+			t.Fatalf("unexpected builds: %s", diff)
+		}
+	})
+
+	t.Run("only", func(t *testing.T) {
+		for only, want := range map[string][]string{
+			`amazon-ebs.ubuntu["us-east-1"]`: {`amazon-ebs.ubuntu["us-east-1"]`},
+			"virtualbox-iso.*":               {"virtualbox-iso.ubuntu[0]", "virtualbox-iso.ubuntu[1]"},
+		} {
+			var names []string
+			for _, b := range getBuilds(t, packer.GetBuildsOptions{Only: []string{only}}) {
+				names = append(names, b.Name())
+			}
+			if diff := cmp.Diff(want, names); diff != "" {
+				t.Errorf("-only=%s: unexpected builds: %s", only, diff)
+			}
+		}
+	})
+}
@@ -0,0 +1,184 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+const checkAssertLabel = "assert"
+
+var checkBlockSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: checkAssertLabel},
+	},
+}
+
+var checkAssertBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "condition", Required: true},
+		{Name: "error_message", Required: true},
+	},
+}
+
+// CheckBlock references an HCL 'check' block, holding assertions on the input
+// variables, locals and data sources of the configuration, checked once they
+// are evaluated:
+//
+//	check "encryption" {
+//	  assert {
+//	    condition     = !var.encrypt || var.kms_key_id != ""
+//	    error_message = "A KMS key must be set to encrypt images."
+//	  }
+//	}
+type CheckBlock struct {
+	// Name of the check
+	Name string
+	// Assertions of the check, all must be true.
+	Assertions []*CheckAssertion
+
+	Range hcl.Range
+}
+
+// CheckAssertion is an 'assert' block of a check.
+type CheckAssertion struct {
+	// Condition is a boolean expression, which must be true for the
+	// assertion to pass.
+	Condition hcl.Expression
+	// ErrorMessage is the message shown when the condition is false; like the
+	// ones of variable validations, it must be made of full sentences.
+	ErrorMessage string
+
+	DeclRange hcl.Range
+}
+
+type Checks []*CheckBlock
+
+func (checks Checks) get(name string) *CheckBlock {
+	for _, check := range checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	return nil
+}
+
+func decodeCheckBlock(block *hcl.Block) (*CheckBlock, hcl.Diagnostics) {
+	check := &CheckBlock{
+		Name:  block.Labels[0],
+		Range: block.DefRange,
+	}
+
+	content, diags := block.Body.Content(checkBlockSchema)
+	if !hclsyntax.ValidIdentifier(check.Name) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + checkLabel + " name",
+			Detail:   badIdentifierDetail,
+			Subject:  &block.LabelRanges[0],
+		})
+	}
+
+	for _, assertBlock := range content.Blocks {
+		assertion := &CheckAssertion{
+			DeclRange: assertBlock.DefRange,
+		}
+		assertContent, moreDiags := assertBlock.Body.Content(checkAssertBlockSchema)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		assertion.Condition = assertContent.Attributes["condition"].Expr
+		assertion.ErrorMessage, moreDiags = decodeValidationErrorMessage(assertContent.Attributes["error_message"])
+		diags = append(diags, moreDiags...)
+		check.Assertions = append(check.Assertions, assertion)
+	}
+
+	if len(check.Assertions) == 0 && !diags.HasErrors() {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing " + checkAssertLabel + " block",
+			Detail:   "A " + checkLabel + " block must have at least one " + checkAssertLabel + " block.",
+			Subject:  block.DefRange.Ptr(),
+		})
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return check, diags
+}
+
+// evaluateChecks evaluates the assertions of the check blocks, with the input
+// variables, locals and data sources of the configuration. Assertions whose
+// condition is not known yet, like when data sources are not executed, are
+// skipped.
+func (cfg *PackerConfig) evaluateChecks() hcl.Diagnostics {
+	if len(cfg.Checks) == 0 {
+		return nil
+	}
+
+	var diags hcl.Diagnostics
+	ectx := cfg.EvalContext(LocalContext, nil)
+	for _, check := range cfg.Checks {
+		for _, assertion := range check.Assertions {
+			result, moreDiags := assertion.evaluate(ectx)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() || !result.IsKnown() {
+				continue
+			}
+
+			if result.False() {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  fmt.Sprintf("Check %q failed", check.Name),
+					Detail: fmt.Sprintf("%s\n\nThis was checked by the assertion at %s.",
+						assertion.ErrorMessage, assertion.DeclRange.String()),
+					Subject: assertion.Condition.Range().Ptr(),
+				})
+			}
+		}
+	}
+	return diags
+}
+
+// evaluate evaluates the condition of the assertion with ectx, into an
+// unmarked boolean, which is unknown when the condition depends on values
+// that are not known yet.
+func (assertion *CheckAssertion) evaluate(ectx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	const errInvalidCondition = "Invalid check assertion result"
+
+	result, diags := assertion.Condition.Value(ectx)
+	if diags.HasErrors() {
+		return cty.UnknownVal(cty.Bool), diags
+	}
+	// the condition can be derived from sensitive values
+	result, _ = result.UnmarkDeep()
+	if !result.IsKnown() {
+		return cty.UnknownVal(cty.Bool), diags
+	}
+
+	if result.IsNull() {
+		return cty.UnknownVal(cty.Bool), append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  errInvalidCondition,
+			Detail:   "Assertion condition expression must return either true or false, not null.",
+			Subject:  assertion.Condition.Range().Ptr(),
+		})
+	}
+	result, err := convert.Convert(result, cty.Bool)
+	if err != nil {
+		return cty.UnknownVal(cty.Bool), append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  errInvalidCondition,
+			Detail:   fmt.Sprintf("Invalid assertion condition result value: %s.", err),
+			Subject:  assertion.Condition.Range().Ptr(),
+		})
+	}
+	return result, diags
+}
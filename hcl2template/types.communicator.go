@@ -0,0 +1,155 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// CommunicatorBlock references an HCL 'communicator' block, a communicator
+// configuration that sources can share:
+//
+//	communicator "ssh" "default" {
+//	  ssh_username = "ubuntu"
+//	  ssh_timeout  = "10m"
+//	}
+//
+//	source "amazon-ebs" "example" {
+//	  communicator = communicator.ssh.default
+//	}
+type CommunicatorBlock struct {
+	// Type of communicator; ex: ssh
+	Type string
+	// Given name
+	Name string
+
+	block *hcl.Block
+}
+
+// CommunicatorRef is a reference to a communicator block:
+// `communicator.ssh.default`.
+type CommunicatorRef struct {
+	Type string
+	Name string
+}
+
+func (r CommunicatorRef) String() string {
+	return fmt.Sprintf("%s.%s.%s", communicatorLabel, r.Type, r.Name)
+}
+
+func (c *CommunicatorBlock) Ref() CommunicatorRef {
+	return CommunicatorRef{
+		Type: c.Type,
+		Name: c.Name,
+	}
+}
+
+func (p *Parser) decodeCommunicator(block *hcl.Block) (CommunicatorBlock, hcl.Diagnostics) {
+	communicator := CommunicatorBlock{
+		Type:  block.Labels[0],
+		Name:  block.Labels[1],
+		block: block,
+	}
+	var diags hcl.Diagnostics
+
+	if !hclsyntax.ValidIdentifier(communicator.Type) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + communicatorLabel + " type",
+			Detail:   badIdentifierDetail,
+			Subject:  &block.LabelRanges[0],
+		})
+	}
+	if !hclsyntax.ValidIdentifier(communicator.Name) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + communicatorLabel + " name",
+			Detail:   badIdentifierDetail,
+			Subject:  &block.LabelRanges[1],
+		})
+	}
+
+	return communicator, diags
+}
+
+// body returns the settings of the communicator, as they would be written in
+// a source: its type is the communicator setting.
+func (c *CommunicatorBlock) body() hcl.Body {
+	typeRange := c.block.LabelRanges[0]
+	typeBody := &hclsyntax.Body{
+		Attributes: hclsyntax.Attributes{
+			communicatorLabel: &hclsyntax.Attribute{
+				Name: communicatorLabel,
+				Expr: &hclsyntax.LiteralValueExpr{
+					Val:      cty.StringVal(c.Type),
+					SrcRange: typeRange,
+				},
+				SrcRange:  typeRange,
+				NameRange: typeRange,
+			},
+		},
+		SrcRange: c.block.DefRange,
+		EndRange: c.block.DefRange,
+	}
+	return &overrideBody{base: typeBody, override: c.block.Body}
+}
+
+// useCommunicator returns the body of a source, with the settings of the
+// communicator block it references with `communicator =
+// communicator.type.name`, if any, merged in. The settings of the source
+// take precedence over the ones of the communicator.
+func (cfg *PackerConfig) useCommunicator(body hcl.Body) (hcl.Body, hcl.Diagnostics) {
+	content, remain, diags := body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: communicatorLabel}},
+	})
+	attr, ok := content.Attributes[communicatorLabel]
+	if !ok {
+		return body, diags
+	}
+	traversal, travDiags := hcl.AbsTraversalForExpr(attr.Expr)
+	if travDiags.HasErrors() || traversal.RootName() != communicatorLabel {
+		// The communicator is set by type, like "ssh" or "none".
+		return body, diags
+	}
+
+	var ref CommunicatorRef
+	if len(traversal) == 3 {
+		typ, typOk := traversal[1].(hcl.TraverseAttr)
+		name, nameOk := traversal[2].(hcl.TraverseAttr)
+		if typOk && nameOk {
+			ref = CommunicatorRef{Type: typ.Name, Name: name.Name}
+		}
+	}
+	if ref == (CommunicatorRef{}) {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + communicatorLabel + " reference",
+			Detail: "A " + communicatorLabel + " reference is made of three parts " +
+				"split by a dot `.`, like `" + communicatorLabel + ".ssh.default`.",
+			Subject: attr.Expr.Range().Ptr(),
+		})
+	}
+
+	communicator, found := cfg.Communicators[ref]
+	if !found {
+		known := make([]string, 0, len(cfg.Communicators))
+		for ref := range cfg.Communicators {
+			known = append(known, ref.String())
+		}
+		sort.Strings(known)
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unknown " + communicatorLabel + " " + ref.String(),
+			Detail:   fmt.Sprintf("Known: %v", known),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+	}
+
+	return &overrideBody{base: communicator.body(), override: remain}, diags
+}
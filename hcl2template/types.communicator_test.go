@@ -0,0 +1,46 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParse_communicator(t *testing.T) {
+	cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/communicator/source.pkr.hcl", packer.InitializeOptions{})
+	builds := testGetBuilds(t, cfg, packer.GetBuildsOptions{})
+	if len(builds) != 2 {
+		t.Fatalf("expected 2 builds, got %d", len(builds))
+	}
+
+	wantPorts := map[string]int64{
+		"null.web": 22,
+		"null.db":  2222,
+	}
+	for _, b := range builds {
+		cb := b.(*packer.CoreBuild)
+		config := cb.HCLConfig
+		if got := config.GetAttr("communicator"); !got.RawEquals(cty.StringVal("ssh")) {
+			t.Errorf("%s: expected the ssh communicator, got %#v", cb.Type, got)
+		}
+		if got := config.GetAttr("ssh_username"); !got.RawEquals(cty.StringVal("ubuntu")) {
+			t.Errorf("%s: expected the username of the communicator block, got %#v", cb.Type, got)
+		}
+		if got := config.GetAttr("ssh_port"); !got.Equals(cty.NumberIntVal(wantPorts[cb.Type])).True() {
+			t.Errorf("%s: expected port %d, got %#v", cb.Type, wantPorts[cb.Type], got)
+		}
+	}
+}
+
+func TestParse_communicator_unknown(t *testing.T) {
+	cfg := testParseConfig(t, getBasicParser(), "testdata/communicator/unknown.pkr.hcl")
+	diags := cfg.Initialize(packer.InitializeOptions{})
+	if !strings.Contains(diags.Error(), "Unknown communicator communicator.ssh.bastion") {
+		t.Fatalf("expected an unknown communicator error, got %s", diags)
+	}
+}
@@ -5,8 +5,11 @@ package hcl2template
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	hcl2shim "github.com/hashicorp/packer/hcl2template/shim"
@@ -18,8 +21,32 @@ type DatasourceBlock struct {
 	Type string
 	Name string
 
+	// SensitiveOutputs are the names of the output attributes of the data
+	// source whose values are sensitive.
+	SensitiveOutputs []string
+	// CacheTTL is how long the outputs of the data source are cached, across
+	// runs, for its configuration. 0 means they are not cached.
+	CacheTTL time.Duration
+
 	value cty.Value
 	block *hcl.Block
+	// body is the configuration of the data source, without the attributes
+	// handled by Packer.
+	body hcl.Body
+}
+
+// sensitiveOutputsAttr declares the sensitive output attributes of a data
+// source.
+const sensitiveOutputsAttr = "sensitive_outputs"
+
+// cacheTTLAttr sets how long the outputs of a data source are cached.
+const cacheTTLAttr = "cache_ttl"
+
+var datasourceBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: sensitiveOutputsAttr},
+		{Name: cacheTTLAttr},
+	},
 }
 
 type DatasourceRef struct {
@@ -29,6 +56,10 @@ type DatasourceRef struct {
 
 type Datasources map[DatasourceRef]DatasourceBlock
 
+func (ref DatasourceRef) String() string {
+	return dataAccessor + "." + ref.Type + "." + ref.Name
+}
+
 func (data *DatasourceBlock) Ref() DatasourceRef {
 	return DatasourceRef{
 		Type: data.Type,
@@ -54,7 +85,7 @@ func (ds *Datasources) Values() (map[string]cty.Value, hcl.Diagnostics) {
 		if inner == nil {
 			inner = map[string]cty.Value{}
 		}
-		inner[ref.Name] = datasource.value
+		inner[ref.Name] = datasource.outputValue()
 		res[ref.Type] = cty.MapVal(inner)
 
 		// Keeps values of different datasources from same type
@@ -64,7 +95,25 @@ func (ds *Datasources) Values() (map[string]cty.Value, hcl.Diagnostics) {
 	return res, diags
 }
 
-func (cfg *PackerConfig) startDatasource(ds DatasourceBlock) (packersdk.Datasource, hcl.Diagnostics) {
+// outputValue returns the value of the data source, with its sensitive
+// outputs marked as sensitive.
+func (data *DatasourceBlock) outputValue() cty.Value {
+	value := data.value
+	if len(data.SensitiveOutputs) == 0 || !value.IsKnown() || value.IsNull() || !value.Type().IsObjectType() {
+		return value
+	}
+	attrs := value.AsValueMap()
+	for _, name := range data.SensitiveOutputs {
+		if attr, found := attrs[name]; found {
+			attrs[name] = markSensitive(attr)
+		}
+	}
+	return cty.ObjectVal(attrs)
+}
+
+// startDatasource starts the data source of ds, and configures it with its
+// body evaluated with ectx, which it returns as well.
+func (cfg *PackerConfig) startDatasource(ds DatasourceBlock, ectx *hcl.EvalContext) (packersdk.Datasource, cty.Value, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
 	block := ds.block
 
@@ -77,7 +126,7 @@ func (cfg *PackerConfig) startDatasource(ds DatasourceBlock) (packersdk.Datasour
 			Detail:   "packer does not currently know any data source.",
 			Severity: hcl.DiagError,
 		})
-		return nil, diags
+		return nil, cty.NilVal, diags
 	}
 
 	if !dataSourceStore.Has(ds.Type) {
@@ -87,7 +136,7 @@ func (cfg *PackerConfig) startDatasource(ds DatasourceBlock) (packersdk.Datasour
 			Detail:   fmt.Sprintf("known data sources: %v", dataSourceStore.List()),
 			Severity: hcl.DiagError,
 		})
-		return nil, diags
+		return nil, cty.NilVal, diags
 	}
 
 	datasource, err := dataSourceStore.Start(ds.Type)
@@ -106,14 +155,32 @@ func (cfg *PackerConfig) startDatasource(ds DatasourceBlock) (packersdk.Datasour
 		})
 	}
 
+	if datasource == nil {
+		return nil, cty.NilVal, diags
+	}
+
+	outputType := hcldec.ImpliedType(datasource.OutputSpec())
+	for _, name := range ds.SensitiveOutputs {
+		if !outputType.IsObjectType() || !outputType.HasAttribute(name) {
+			diags = append(diags, &hcl.Diagnostic{
+				Summary:  fmt.Sprintf("Unknown output %q in %s", name, sensitiveOutputsAttr),
+				Subject:  &block.DefRange,
+				Detail:   fmt.Sprintf("The %s data source has no %q output attribute.", ds.Type, name),
+				Severity: hcl.DiagError,
+			})
+		}
+	}
+	if diags.HasErrors() {
+		return nil, cty.NilVal, diags
+	}
+
 	var decoded cty.Value
 	var moreDiags hcl.Diagnostics
-	body := block.Body
-	decoded, moreDiags = decodeHCL2Spec(body, cfg.EvalContext(DatasourceContext, nil), datasource)
+	decoded, moreDiags = decodeHCL2Spec(ds.body, ectx, datasource)
 
 	diags = append(diags, moreDiags...)
 	if moreDiags.HasErrors() {
-		return nil, diags
+		return nil, cty.NilVal, diags
 	}
 
 	// In case of cty.Unknown values, this will write a equivalent placeholder
@@ -129,7 +196,28 @@ func (cfg *PackerConfig) startDatasource(ds DatasourceBlock) (packersdk.Datasour
 			Severity: hcl.DiagError,
 		})
 	}
-	return datasource, diags
+	return datasource, decoded, diags
+}
+
+func decodeCacheTTL(ttl string, subject hcl.Range) (time.Duration, hcl.Diagnostics) {
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return 0, hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to parse " + cacheTTLAttr + " duration",
+			Detail:   err.Error(),
+			Subject:  subject.Ptr(),
+		}}
+	}
+	if d <= 0 {
+		return 0, hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + cacheTTLAttr,
+			Detail:   "The " + cacheTTLAttr + " of a data source must be a positive duration, like \"1h\".",
+			Subject:  subject.Ptr(),
+		}}
+	}
+	return d, nil
 }
 
 func (p *Parser) decodeDataBlock(block *hcl.Block) (*DatasourceBlock, hcl.Diagnostics) {
@@ -140,6 +228,22 @@ func (p *Parser) decodeDataBlock(block *hcl.Block) (*DatasourceBlock, hcl.Diagno
 		block: block,
 	}
 
+	content, body, moreDiags := block.Body.PartialContent(datasourceBlockSchema)
+	diags = append(diags, moreDiags...)
+	r.body = body
+	if attr, found := content.Attributes[sensitiveOutputsAttr]; found {
+		diags = append(diags, gohcl.DecodeExpression(attr.Expr, nil, &r.SensitiveOutputs)...)
+	}
+	if attr, found := content.Attributes[cacheTTLAttr]; found {
+		var ttl string
+		moreDiags := gohcl.DecodeExpression(attr.Expr, nil, &ttl)
+		diags = append(diags, moreDiags...)
+		if !moreDiags.HasErrors() {
+			r.CacheTTL, moreDiags = decodeCacheTTL(ttl, attr.Expr.Range())
+			diags = append(diags, moreDiags...)
+		}
+	}
+
 	if !hclsyntax.ValidIdentifier(r.Type) {
 		diags = append(diags, &hcl.Diagnostic{
 			Severity: hcl.DiagError,
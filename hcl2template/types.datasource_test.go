@@ -5,11 +5,14 @@ package hcl2template
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer/builder/null"
 	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
 )
 
 func TestParse_datasource(t *testing.T) {
@@ -58,6 +61,7 @@ func TestParse_datasource(t *testing.T) {
 				&packer.CoreBuild{
 					Type:           "null.test",
 					Builder:        &null.Builder{},
+					Resumable:      true,
 					Provisioners:   []packer.CoreBuildProvisioner{},
 					PostProcessors: [][]packer.CoreBuildPostProcessor{},
 					Prepared:       true,
@@ -135,6 +139,7 @@ func TestParse_datasource(t *testing.T) {
 				&packer.CoreBuild{
 					Type:           "null.test",
 					Builder:        &null.Builder{},
+					Resumable:      true,
 					Provisioners:   []packer.CoreBuildProvisioner{},
 					PostProcessors: [][]packer.CoreBuildPostProcessor{},
 					Prepared:       true,
@@ -235,3 +240,115 @@ func TestParse_datasource(t *testing.T) {
 
 	testParse(t, tests)
 }
+
+func TestParse_datasource_dependencies(t *testing.T) {
+	for _, parallelism := range []int{0, 1, 4} {
+		cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/datasources/long_chain.pkr.hcl", packer.InitializeOptions{
+			DatasourceParallelism: parallelism,
+		})
+
+		datasources, _ := cfg.Datasources.Values()
+		joined := datasources["null"].Index(cty.StringVal("joined")).GetAttr("output")
+		expected := cty.StringVal("0-1-2-3-4-5-6-7-8-9-10-11-12+other")
+		if !joined.RawEquals(expected) {
+			t.Errorf("parallelism %d: expected %#v, got %#v", parallelism, expected, joined)
+		}
+	}
+}
+
+func TestParse_datasource_cycle(t *testing.T) {
+	cfg := testParseConfig(t, getBasicParser(), "testdata/datasources/dependency_cycle.pkr.hcl")
+	diags := cfg.Initialize(packer.InitializeOptions{})
+	if !strings.Contains(diags.Error(), "data.null.bear -> data.null.gummy -> data.null.bear") {
+		t.Fatalf("expected a data source dependency cycle error, got %s", diags)
+	}
+}
+
+func TestParse_datasource_failed_dependency(t *testing.T) {
+	cfg := testParseConfig(t, getBasicParser(), "testdata/datasources/failed_chain.pkr.hcl")
+	diags := cfg.Initialize(packer.InitializeOptions{})
+
+	var skipped []string
+	for _, diag := range diags {
+		if diag.Summary == "Data source not evaluated" {
+			skipped = append(skipped, diag.Detail)
+		}
+	}
+	expected := []string{
+		"data.null.child depends on data.null.failed, which failed to be evaluated.",
+		"data.null.grandchild depends on data.null.child, which depends on data.null.failed, which failed to be evaluated.",
+	}
+	if diff := cmp.Diff(expected, skipped); diff != "" {
+		t.Fatalf("unexpected diagnostics for the skipped data sources: %s\n%s", diff, diags)
+	}
+
+	if cfg.Datasources[DatasourceRef{Type: "null", Name: "unrelated"}].value == (cty.Value{}) {
+		t.Errorf("expected the unrelated data source to be evaluated")
+	}
+}
+
+func TestParse_datasource_cache(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("PACKER_CACHE_DIR", cacheDir)
+
+	initialize := func(refresh bool) cty.Value {
+		cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/datasources/cache.pkr.hcl", packer.InitializeOptions{
+			RefreshDatasources: refresh,
+		})
+		datasources, _ := cfg.Datasources.Values()
+		return datasources["null"]
+	}
+
+	if got := initialize(false).Index(cty.StringVal("cached")).GetAttr("output"); !got.RawEquals(cty.StringVal("chocolate")) {
+		t.Fatalf("expected the executed output, got %#v", got)
+	}
+	paths, err := filepath.Glob(filepath.Join(cacheDir, datasourceCacheDir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("expected only the outputs of the data source with a cache_ttl to be cached, got %v", paths)
+	}
+
+	// change the cached outputs, to tell them from the executed ones.
+	err = writeDatasourceCache(paths[0], "null", cty.ObjectVal(map[string]cty.Value{
+		"output": cty.StringVal("cached"),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := initialize(false).Index(cty.StringVal("cached")).GetAttr("output"); !got.RawEquals(cty.StringVal("cached")) {
+		t.Errorf("expected the cached output, got %#v", got)
+	}
+	if got := initialize(true).Index(cty.StringVal("cached")).GetAttr("output"); !got.RawEquals(cty.StringVal("chocolate")) {
+		t.Errorf("expected the refreshed output, got %#v", got)
+	}
+	if got := initialize(false).Index(cty.StringVal("cached")).GetAttr("output"); !got.RawEquals(cty.StringVal("chocolate")) {
+		t.Errorf("expected the refreshed output to be cached, got %#v", got)
+	}
+}
+
+func TestParse_datasource_cache_secrets(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("PACKER_CACHE_DIR", cacheDir)
+
+	_, diags := testInitializeConfig(t, getBasicParser(), "testdata/datasources/cache_secrets.pkr.hcl", packer.InitializeOptions{})
+	if len(diags) != 2 || !strings.Contains(diags.Error(), "not cached") {
+		t.Errorf("expected a warning for each data source, got %s", diags)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(cacheDir, datasourceCacheDir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 0 {
+		t.Fatalf("expected sensitive and ephemeral outputs not to be cached, got %v", paths)
+	}
+}
+
+func TestParse_datasource_invalid_cache_ttl(t *testing.T) {
+	_, diags := getBasicParser().Parse("testdata/datasources/invalid_cache_ttl.pkr.hcl", nil, nil)
+	if !strings.Contains(diags.Error(), "Invalid cache_ttl") {
+		t.Fatalf("expected an invalid cache_ttl error, got %s", diags)
+	}
+}
@@ -5,12 +5,13 @@ package hcl2template
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	hcl2shim "github.com/hashicorp/packer/hcl2template/shim"
-	"github.com/zclconf/go-cty/cty"
+	"github.com/hashicorp/packer/packer"
 )
 
 // HCL2PostProcessor has a reference to the part of the HCL2 body where it is
@@ -30,24 +31,9 @@ func (p *HCL2PostProcessor) ConfigSpec() hcldec.ObjectSpec {
 
 func (p *HCL2PostProcessor) HCL2Prepare(buildVars map[string]interface{}) error {
 	var diags hcl.Diagnostics
-	ectx := p.evalContext
-	if len(buildVars) > 0 {
-		ectx = p.evalContext.NewChild()
-		buildValues := map[string]cty.Value{}
-		if !p.evalContext.Variables[buildAccessor].IsNull() {
-			buildValues = p.evalContext.Variables[buildAccessor].AsValueMap()
-		}
-		for k, v := range buildVars {
-			val, err := ConvertPluginConfigValueToHCLValue(v)
-			if err != nil {
-				return err
-			}
-
-			buildValues[k] = val
-		}
-		ectx.Variables = map[string]cty.Value{
-			buildAccessor: cty.ObjectVal(buildValues),
-		}
+	ectx, err := buildEvalContext(p.evalContext, buildVars)
+	if err != nil {
+		return err
 	}
 
 	flatPostProcessorCfg, moreDiags := decodeHCL2Spec(p.postProcessorBlock.HCL2Ref.Rest, ectx, p.PostProcessor)
@@ -69,15 +55,31 @@ func (p *HCL2PostProcessor) Configure(args ...interface{}) error {
 	return p.PostProcessor.Configure(args...)
 }
 
-func (p *HCL2PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifact packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
-	generatedData := make(map[string]interface{})
-	if artifactStateData, ok := artifact.State("generated_data").(map[interface{}]interface{}); ok {
-		for k, v := range artifactStateData {
-			generatedData[k.(string)] = v
-		}
+var _ packer.ConditionalPostProcessor = new(HCL2PostProcessor)
+
+// ShouldRun evaluates the condition of the post-processor with the values of
+// the build that produced artifact, and with artifact itself.
+func (p *HCL2PostProcessor) ShouldRun(artifact packersdk.Artifact) (bool, error) {
+	ectx, err := buildEvalContext(p.evalContext, artifactGeneratedData(artifact))
+	if err != nil {
+		return false, err
+	}
+	ectx, err = artifactEvalContext(ectx, artifact)
+	if err != nil {
+		return false, err
+	}
+	run, known, diags := evaluateCondition(p.postProcessorBlock.Condition, ectx)
+	if diags.HasErrors() {
+		return false, diags
 	}
+	if !known {
+		return false, fmt.Errorf("the condition of %s depends on values that are not known", p.postProcessorBlock)
+	}
+	return run, nil
+}
 
-	err := p.HCL2Prepare(generatedData)
+func (p *HCL2PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifact packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	err := p.HCL2Prepare(artifactGeneratedData(artifact))
 	if err != nil {
 		return nil, false, false, err
 	}
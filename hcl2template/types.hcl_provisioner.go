@@ -5,12 +5,13 @@ package hcl2template
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	hcl2shim "github.com/hashicorp/packer/hcl2template/shim"
-	"github.com/zclconf/go-cty/cty"
+	"github.com/hashicorp/packer/packer"
 )
 
 // HCL2Provisioner has a reference to the part of the HCL2 body where it is
@@ -29,26 +30,17 @@ func (p *HCL2Provisioner) ConfigSpec() hcldec.ObjectSpec {
 	return p.Provisioner.ConfigSpec()
 }
 
+// Override returns the override of the provisioner configuration for the
+// build it is part of, if any.
+func (p *HCL2Provisioner) Override() map[string]interface{} {
+	return p.override
+}
+
 func (p *HCL2Provisioner) HCL2Prepare(buildVars map[string]interface{}) error {
 	var diags hcl.Diagnostics
-	ectx := p.evalContext
-	if len(buildVars) > 0 {
-		ectx = p.evalContext.NewChild()
-		buildValues := map[string]cty.Value{}
-		if !p.evalContext.Variables[buildAccessor].IsNull() {
-			buildValues = p.evalContext.Variables[buildAccessor].AsValueMap()
-		}
-		for k, v := range buildVars {
-			val, err := ConvertPluginConfigValueToHCLValue(v)
-			if err != nil {
-				return err
-			}
-
-			buildValues[k] = val
-		}
-		ectx.Variables = map[string]cty.Value{
-			buildAccessor: cty.ObjectVal(buildValues),
-		}
+	ectx, err := buildEvalContext(p.evalContext, buildVars)
+	if err != nil {
+		return err
 	}
 
 	flatProvisionerCfg, moreDiags := decodeHCL2Spec(p.provisionerBlock.HCL2Ref.Rest, ectx, p.Provisioner)
@@ -70,6 +62,25 @@ func (p *HCL2Provisioner) Prepare(args ...interface{}) error {
 	return p.Provisioner.Prepare(args...)
 }
 
+var _ packer.ConditionalProvisioner = new(HCL2Provisioner)
+
+// ShouldRun evaluates the condition of the provisioner with the values of
+// the build it is part of.
+func (p *HCL2Provisioner) ShouldRun(buildVars map[string]interface{}) (bool, error) {
+	ectx, err := buildEvalContext(p.evalContext, buildVars)
+	if err != nil {
+		return false, err
+	}
+	run, known, diags := evaluateCondition(p.provisionerBlock.Condition, ectx)
+	if diags.HasErrors() {
+		return false, diags
+	}
+	if !known {
+		return false, fmt.Errorf("the condition of %s depends on values that are not known", p.provisionerBlock)
+	}
+	return run, nil
+}
+
 func (p *HCL2Provisioner) Provision(ctx context.Context, ui packersdk.Ui, c packersdk.Communicator, vars map[string]interface{}) error {
 	err := p.HCL2Prepare(vars)
 	if err != nil {
@@ -0,0 +1,233 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+const mockDataLabel = "mock_data"
+
+var mockDataBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "outputs", Required: true},
+	},
+}
+
+// mockFileSchema is the schema of the files of the -mock-file option.
+var mockFileSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: mockDataLabel, LabelNames: []string{"type", "name"}},
+	},
+}
+
+// MockDataBlock references an HCL 'mock_data' block, setting the outputs of a
+// data source instead of executing it:
+//
+//	mock_data "amazon-ami" "ubuntu" {
+//	  outputs = {
+//	    id = "ami-0123456789"
+//	  }
+//	}
+type MockDataBlock struct {
+	Type string
+	Name string
+
+	// Outputs are the outputs of the mocked data source. Outputs that are
+	// not set are null.
+	Outputs cty.Value
+
+	Range hcl.Range
+}
+
+func (mock *MockDataBlock) Ref() DatasourceRef {
+	return DatasourceRef{
+		Type: mock.Type,
+		Name: mock.Name,
+	}
+}
+
+// MockData are mocked data sources, by reference.
+type MockData map[DatasourceRef]*MockDataBlock
+
+// merge returns the mocks of data and of other, the ones of other replacing
+// the ones of data.
+func (data MockData) merge(other MockData) MockData {
+	if len(other) == 0 {
+		return data
+	}
+	res := MockData{}
+	for ref, mock := range data {
+		res[ref] = mock
+	}
+	for ref, mock := range other {
+		res[ref] = mock
+	}
+	return res
+}
+
+// decodeMockDataBlocks decodes the mock_data blocks of blocks, other blocks
+// are ignored. The outputs of the mocks are evaluated with ectx.
+func decodeMockDataBlocks(blocks hcl.Blocks, ectx *hcl.EvalContext) (MockData, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	res := MockData{}
+	for _, block := range blocks {
+		if block.Type != mockDataLabel {
+			continue
+		}
+		mock, moreDiags := decodeMockDataBlock(block, ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		if other, found := res[mock.Ref()]; found {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate " + mockDataLabel + " block",
+				Detail: fmt.Sprintf("The data source %s.%s is already mocked at %s.",
+					mock.Type, mock.Name, other.Range),
+				Subject: block.DefRange.Ptr(),
+			})
+			continue
+		}
+		res[mock.Ref()] = mock
+	}
+	return res, diags
+}
+
+func decodeMockDataBlock(block *hcl.Block, ectx *hcl.EvalContext) (*MockDataBlock, hcl.Diagnostics) {
+	mock := &MockDataBlock{
+		Type:  block.Labels[0],
+		Name:  block.Labels[1],
+		Range: block.DefRange,
+	}
+
+	content, diags := block.Body.Content(mockDataBlockSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	attr := content.Attributes["outputs"]
+	outputs, moreDiags := attr.Expr.Value(ectx)
+	diags = append(diags, moreDiags...)
+	if moreDiags.HasErrors() {
+		return nil, diags
+	}
+	if outputs.IsNull() || !outputs.IsWhollyKnown() ||
+		!(outputs.Type().IsObjectType() || outputs.Type().IsMapType()) {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid mock outputs",
+			Detail:   "The outputs of a mocked data source must be an object, of known values.",
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+	}
+	mock.Outputs = outputs
+	return mock, diags
+}
+
+// outputValue returns the outputs of the mock as a value of outputType, the
+// type of the outputs of the data source.
+func (mock *MockDataBlock) outputValue(outputType cty.Type) (cty.Value, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	outputs := mock.Outputs.AsValueMap()
+
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !outputType.IsObjectType() || !outputType.HasAttribute(name) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported mock output",
+				Detail: fmt.Sprintf("The %s data source has no %q output.",
+					mock.Type, name),
+				Subject: mock.Range.Ptr(),
+			})
+		}
+	}
+	if diags.HasErrors() || !outputType.IsObjectType() {
+		return cty.NilVal, diags
+	}
+
+	attrs := map[string]cty.Value{}
+	for name, attrType := range outputType.AttributeTypes() {
+		value, found := outputs[name]
+		if !found {
+			attrs[name] = cty.NullVal(attrType)
+			continue
+		}
+		value, err := convert.Convert(value, attrType)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid mock output",
+				Detail: fmt.Sprintf("The value of the %q output of %s.%s is "+
+					"not compatible with its type: %s.", name, mock.Type, mock.Name, err),
+				Subject: mock.Range.Ptr(),
+			})
+			continue
+		}
+		attrs[name] = value
+	}
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	return cty.ObjectVal(attrs), diags
+}
+
+// parseMockFiles parses the mock_data blocks of the files of the -mock-file
+// option; the mocks of a file replace the ones of the files before it.
+func (p *Parser) parseMockFiles(filenames []string) (MockData, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	res := MockData{}
+	for _, filename := range filenames {
+		var f *hcl.File
+		var moreDiags hcl.Diagnostics
+		switch filepath.Ext(filename) {
+		case ".hcl":
+			f, moreDiags = p.ParseHCLFile(filename)
+		case ".json":
+			f, moreDiags = p.ParseJSONFile(filename)
+		default:
+			moreDiags = hcl.Diagnostics{&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Could not guess format of " + filename,
+				Detail:   "A mock file must be suffixed with `.hcl` or `.json`.",
+			}}
+		}
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+
+		content, moreDiags := f.Body.Content(mockFileSchema)
+		diags = append(diags, moreDiags...)
+		mocks, moreDiags := decodeMockDataBlocks(content.Blocks, &hcl.EvalContext{
+			Functions: Functions(filepath.Dir(filename)),
+		})
+		diags = append(diags, moreDiags...)
+		res = res.merge(mocks)
+	}
+	return res, diags
+}
+
+// setMockData sets the data sources of cfg mocked by the files of the
+// -mock-file option and by mocks, which replace them.
+func (p *Parser) setMockData(cfg *PackerConfig, mocks MockData) hcl.Diagnostics {
+	if cfg == nil || (len(p.MockFiles) == 0 && len(mocks) == 0) {
+		return nil
+	}
+	fileMocks, diags := p.parseMockFiles(p.MockFiles)
+	cfg.mockData = fileMocks.merge(mocks)
+	return diags
+}
@@ -0,0 +1,46 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParse_mock_data(t *testing.T) {
+	for _, skipExecution := range []bool{false, true} {
+		parser := getBasicParser()
+		parser.MockFiles = []string{"testdata/mock_data/mocks.hcl"}
+		cfg, _ := testInitializeConfig(t, parser, "testdata/mock_data", packer.InitializeOptions{
+			SkipDatasourcesExecution: skipExecution,
+		})
+
+		datasources, _ := cfg.Datasources.Values()
+		base := datasources["amazon-ami"].Index(cty.StringVal("base"))
+		if got := base.GetAttr("string"); !got.RawEquals(cty.StringVal("mocked")) {
+			t.Errorf("expected the mocked output, got %#v", got)
+		}
+		if got := base.GetAttr("int"); !got.IsNull() {
+			t.Errorf("expected the outputs that are not mocked to be null, got %#v", got)
+		}
+
+		other := datasources["amazon-ami"].Index(cty.StringVal("other"))
+		if got := other.GetAttr("string"); skipExecution == got.IsKnown() {
+			t.Errorf("expected the data source that is not mocked to be executed only when execution is not skipped, got %#v", got)
+		}
+	}
+}
+
+func TestParse_mock_data_unknown_output(t *testing.T) {
+	parser := getBasicParser()
+	parser.MockFiles = []string{"testdata/mock_data/invalid_mocks.hcl"}
+	cfg := testParseConfig(t, parser, "testdata/mock_data")
+	diags := cfg.Initialize(packer.InitializeOptions{})
+	if !strings.Contains(diags.Error(), "Unsupported mock output") {
+		t.Fatalf("expected an unsupported mock output error, got %s", diags)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const mockSourceLabel = "mock_source"
+
+// MockSourceBuilderId is the builder ID of the artifacts of mocked sources.
+const MockSourceBuilderId = "packer.mock"
+
+var mockSourceBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "artifact_id"},
+		{Name: "files"},
+		{Name: "generated_data"},
+	},
+}
+
+// MockSourceBlock references an HCL 'mock_source' block of a test file,
+// replacing the builder of a source: the builds of the source do not run
+// their builder, nor their provisioners, and produce the mocked artifact
+// instead. The builder is still configured, so a mocked build can be
+// planned like any other:
+//
+//	mock_source "amazon-ebs" "ubuntu" {
+//	  artifact_id = "ami-0123456789"
+//	  generated_data = {
+//	    SourceAMI = "ami-0000000000"
+//	  }
+//	}
+type MockSourceBlock struct {
+	// Type and Name of the mocked source, Name being the name of the source
+	// in the build, when the build renames it.
+	Type string
+	Name string
+
+	// ArtifactID, Files and GeneratedData make the artifact of the builds of
+	// the mocked source.
+	ArtifactID    string
+	Files         []string
+	GeneratedData map[string]string
+
+	Range hcl.Range
+}
+
+func (mock *MockSourceBlock) Ref() SourceRef {
+	return SourceRef{
+		Type: mock.Type,
+		Name: mock.Name,
+	}
+}
+
+// MockSources are mocked sources, by reference.
+type MockSources map[SourceRef]*MockSourceBlock
+
+// merge returns the mocks of sources and of other, the ones of other
+// replacing the ones of sources.
+func (sources MockSources) merge(other MockSources) MockSources {
+	if len(other) == 0 {
+		return sources
+	}
+	res := MockSources{}
+	for ref, mock := range sources {
+		res[ref] = mock
+	}
+	for ref, mock := range other {
+		res[ref] = mock
+	}
+	return res
+}
+
+// decodeMockSourceBlocks decodes the mock_source blocks of blocks, other
+// blocks are ignored. The attributes of the mocks are evaluated with ectx.
+func decodeMockSourceBlocks(blocks hcl.Blocks, ectx *hcl.EvalContext) (MockSources, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	res := MockSources{}
+	for _, block := range blocks {
+		if block.Type != mockSourceLabel {
+			continue
+		}
+		mock, moreDiags := decodeMockSourceBlock(block, ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		if other, found := res[mock.Ref()]; found {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate " + mockSourceLabel + " block",
+				Detail: fmt.Sprintf("The source %s is already mocked at %s.",
+					mock.Ref(), other.Range),
+				Subject: block.DefRange.Ptr(),
+			})
+			continue
+		}
+		res[mock.Ref()] = mock
+	}
+	return res, diags
+}
+
+func decodeMockSourceBlock(block *hcl.Block, ectx *hcl.EvalContext) (*MockSourceBlock, hcl.Diagnostics) {
+	mock := &MockSourceBlock{
+		Type:  block.Labels[0],
+		Name:  block.Labels[1],
+		Range: block.DefRange,
+	}
+
+	content, diags := block.Body.Content(mockSourceBlockSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if attr, exists := content.Attributes["artifact_id"]; exists {
+		diags = append(diags, gohcl.DecodeExpression(attr.Expr, ectx, &mock.ArtifactID)...)
+	}
+	if attr, exists := content.Attributes["files"]; exists {
+		diags = append(diags, gohcl.DecodeExpression(attr.Expr, ectx, &mock.Files)...)
+	}
+	if attr, exists := content.Attributes["generated_data"]; exists {
+		diags = append(diags, gohcl.DecodeExpression(attr.Expr, ectx, &mock.GeneratedData)...)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return mock, diags
+}
+
+// mockBuilder returns the builder of the builds of source: builder, or a
+// builder producing the artifact of its mock when the source is mocked.
+func (cfg *PackerConfig) mockBuilder(source SourceUseBlock, builder packersdk.Builder) packersdk.Builder {
+	mock, found := cfg.mockSources[SourceRef{Type: source.Type, Name: source.name()}]
+	if !found {
+		return builder
+	}
+	return &mockSourceBuilder{Builder: builder, mock: mock}
+}
+
+// mockSourceBuilder is the builder of a mocked source. It is configured by
+// the builder of the source, but never runs it.
+type mockSourceBuilder struct {
+	packersdk.Builder
+	mock *MockSourceBlock
+}
+
+func (b *mockSourceBuilder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
+	ui.Say(fmt.Sprintf("Using the artifact of %s mocked at %s", b.mock.Ref(), b.mock.Range))
+	return &mockSourceArtifact{mock: b.mock}, nil
+}
+
+// mockSourceArtifact is the artifact of a mocked source. Nothing was built,
+// so there is nothing to destroy.
+type mockSourceArtifact struct {
+	mock *MockSourceBlock
+}
+
+func (a *mockSourceArtifact) BuilderId() string { return MockSourceBuilderId }
+
+func (a *mockSourceArtifact) Files() []string { return a.mock.Files }
+
+func (a *mockSourceArtifact) Id() string { return a.mock.ArtifactID }
+
+func (a *mockSourceArtifact) String() string {
+	return fmt.Sprintf("Mocked artifact of %s: %s", a.mock.Ref(), a.mock.ArtifactID)
+}
+
+func (a *mockSourceArtifact) State(name string) interface{} {
+	if name != "generated_data" {
+		return nil
+	}
+	data := map[interface{}]interface{}{}
+	for k, v := range a.mock.GeneratedData {
+		data[k] = v
+	}
+	return data
+}
+
+func (a *mockSourceArtifact) Destroy() error { return nil }
@@ -0,0 +1,404 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+const moduleSourceAttr = "source"
+
+var moduleSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: moduleLabel, LabelNames: []string{"name"}},
+	},
+}
+
+// ModuleBlock references an HCL 'module' block, loading the configuration of
+// another directory so that its sources, provisioners and locals can be
+// reused:
+//
+//	module "hardening" {
+//	  source = "./modules/hardening"
+//
+//	  # input variables of the module
+//	  cis_level = 2
+//	}
+//
+//	build {
+//	  sources = ["module.hardening.source.amazon-ebs.base"]
+//
+//	  provisioners {
+//	    from = module.hardening.build.hardening
+//	  }
+//	}
+//
+// The expressions of the module are evaluated with its own variables, locals
+// and data sources.
+type ModuleBlock struct {
+	// Name of the module, used to reference it as module.<name>
+	Name string
+	// Source is where the module is fetched from.
+	Source string
+
+	// Config is the configuration of the module.
+	Config *PackerConfig
+
+	// inputs are the attributes of the block setting the input variables
+	// of the module.
+	inputs hcl.Attributes
+	block  *hcl.Block
+
+	// ectx is the evaluation context of the module, once initialized.
+	ectxOnce sync.Once
+	ectx     *hcl.EvalContext
+}
+
+type Modules map[string]*ModuleBlock
+
+// Values returns the values of the modules, exposed as module.<name>.
+func (ms Modules) Values() cty.Value {
+	res := map[string]cty.Value{}
+	for name, module := range ms {
+		res[name] = cty.ObjectVal(map[string]cty.Value{
+			localsAccessor: cty.ObjectVal(module.Config.LocalVariables.Values()),
+		})
+	}
+	return cty.ObjectVal(res)
+}
+
+func (ms Modules) names() []string {
+	names := make([]string, 0, len(ms))
+	for name := range ms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// decodeModules loads the configuration of the module blocks of file.
+func (p *Parser) decodeModules(file *hcl.File, cfg *PackerConfig) hcl.Diagnostics {
+	content, _, diags := file.Body.PartialContent(moduleSchema)
+
+	for _, block := range content.Blocks {
+		module, moreDiags := p.decodeModule(block, cfg)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+
+		if existing, found := cfg.Modules[module.Name]; found {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate " + moduleLabel + " block",
+				Detail: fmt.Sprintf("This "+moduleLabel+" block has the same "+
+					"name as a previous block declared at %s. Each "+moduleLabel+
+					" must have a unique name.", existing.block.DefRange.Ptr()),
+				Subject: block.DefRange.Ptr(),
+			})
+			continue
+		}
+		if cfg.Modules == nil {
+			cfg.Modules = Modules{}
+		}
+		cfg.Modules[module.Name] = module
+	}
+
+	return diags
+}
+
+func (p *Parser) decodeModule(block *hcl.Block, cfg *PackerConfig) (*ModuleBlock, hcl.Diagnostics) {
+	module := &ModuleBlock{
+		Name:  block.Labels[0],
+		block: block,
+	}
+	if !hclsyntax.ValidIdentifier(module.Name) {
+		return nil, hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + moduleLabel + " name",
+			Detail:   badIdentifierDetail,
+			Subject:  &block.LabelRanges[0],
+		}}
+	}
+
+	attrs, diags := block.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	sourceAttr, found := attrs[moduleSourceAttr]
+	if !found {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing " + moduleLabel + " source",
+			Detail:   "A " + moduleLabel + " block must set the source it is loaded from.",
+			Subject:  block.DefRange.Ptr(),
+		})
+	}
+	delete(attrs, moduleSourceAttr)
+	module.inputs = attrs
+
+	source, moreDiags := sourceAttr.Expr.Value(nil)
+	if moreDiags.HasErrors() || source.IsNull() || source.Type() != cty.String {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + moduleLabel + " source",
+			Detail:   "The source of a " + moduleLabel + " must be a literal string.",
+			Subject:  sourceAttr.Expr.Range().Ptr(),
+		})
+	}
+	module.Source = source.AsString()
+
+	dir, err := p.moduleFetcher().Fetch(module.Source, filepath.Dir(block.DefRange.Filename))
+	if err != nil {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Failed to fetch %s %q", moduleLabel, module.Name),
+			Detail:   err.Error(),
+			Subject:  sourceAttr.Expr.Range().Ptr(),
+		})
+	}
+
+	// A module loading itself, directly or not, would be loaded forever.
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		absDir = dir
+	}
+	for _, loading := range p.loadingModules {
+		if loading == absDir {
+			return nil, append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Module cycle",
+				Detail: fmt.Sprintf("The %s %q loads %s, which is already being loaded.",
+					moduleLabel, module.Name, dir),
+				Subject: sourceAttr.Expr.Range().Ptr(),
+			})
+		}
+	}
+	p.loadingModules = append(p.loadingModules, absDir)
+	config, moreDiags := p.parse([]string{dir}, nil, nil, nil, nil, nil)
+	p.loadingModules = p.loadingModules[:len(p.loadingModules)-1]
+	diags = append(diags, moreDiags...)
+	if moreDiags.HasErrors() {
+		return nil, diags
+	}
+	config.isModule = true
+	config.inputFiles = cfg.inputFiles
+	module.Config = config
+
+	return module, diags
+}
+
+// initializeModules sets the input variables of the modules, evaluated with
+// the variables and locals of cfg, and initializes them.
+func (cfg *PackerConfig) initializeModules(opts packer.InitializeOptions) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	ectx := cfg.EvalContext(LocalContext, nil)
+
+	for _, name := range cfg.Modules.names() {
+		module := cfg.Modules[name]
+		moreDiags := module.setInputs(ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		diags = append(diags, module.Config.Initialize(opts)...)
+	}
+
+	return diags
+}
+
+func (m *ModuleBlock) setInputs(ectx *hcl.EvalContext) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for name, attr := range m.inputs {
+		variable, found := m.Config.InputVariables[name]
+		if !found {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported " + moduleLabel + " input",
+				Detail: fmt.Sprintf("The %s %q does not declare a variable named %q.",
+					moduleLabel, m.Name, name),
+				Subject: attr.NameRange.Ptr(),
+			})
+			continue
+		}
+
+		value, moreDiags := attr.Expr.Value(ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		if variable.Type != cty.NilType {
+			var err error
+			value, err = convert.Convert(value, variable.Type)
+			if err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid value for " + moduleLabel + " input",
+					Detail: fmt.Sprintf("The value of %q does not match the type "+
+						"of the variable: %s.", name, err),
+					Subject: attr.Expr.Range().Ptr(),
+				})
+				continue
+			}
+		}
+
+		variable.Values = append(variable.Values, VariableAssignment{
+			From:  moduleLabel,
+			Value: value,
+			Expr:  attr.Expr,
+		})
+	}
+
+	return diags
+}
+
+// sourceBlock returns the definition of the source a build uses, which can be
+// a source of a module.
+func (cfg *PackerConfig) sourceBlock(source SourceUseBlock) (SourceBlock, bool) {
+	sources := cfg.Sources
+	if source.Module != "" {
+		module, found := cfg.Modules[source.Module]
+		if !found {
+			return SourceBlock{}, false
+		}
+		sources = module.Config.Sources
+	}
+	src, found := sources[source.SourceRef]
+	return src, found
+}
+
+// decodeModuleProvisioners reads a provisioners block of a build, returning
+// the provisioners of the module build block it references:
+//
+//	provisioners {
+//	  from = module.hardening.build.hardening
+//	}
+func (cfg *PackerConfig) decodeModuleProvisioners(block *hcl.Block) ([]*ProvisionerBlock, hcl.Diagnostics) {
+	var b struct {
+		From hcl.Expression `hcl:"from"`
+	}
+	diags := gohcl.DecodeBody(block.Body, nil, &b)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var moduleName, buildName string
+	if traversal, travDiags := hcl.AbsTraversalForExpr(b.From); !travDiags.HasErrors() &&
+		len(traversal) == 4 && traversal.RootName() == moduleAccessor {
+		module, moduleOk := traversal[1].(hcl.TraverseAttr)
+		kind, kindOk := traversal[2].(hcl.TraverseAttr)
+		build, buildOk := traversal[3].(hcl.TraverseAttr)
+		if moduleOk && kindOk && buildOk && kind.Name == buildLabel {
+			moduleName, buildName = module.Name, build.Name
+		}
+	}
+	if moduleName == "" {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + buildProvisionersLabel + " reference",
+			Detail: "The provisioners of a module are referenced by the name of " +
+				"their build block, like `" + moduleAccessor + ".<module name>.build.<build name>`.",
+			Subject: b.From.Range().Ptr(),
+		})
+	}
+
+	module, found := cfg.Modules[moduleName]
+	if !found {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Unknown %s %q", moduleLabel, moduleName),
+			Detail:   fmt.Sprintf("Known: %v", cfg.Modules.names()),
+			Subject:  b.From.Range().Ptr(),
+		})
+	}
+	for _, build := range module.Config.Builds {
+		if build.Name == buildName {
+			return module.scopeProvisioners(build.ProvisionerBlocks), diags
+		}
+	}
+	return nil, append(diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("Unknown %s %q", buildLabel, buildName),
+		Detail: fmt.Sprintf("The %s %q has no build block named %q.",
+			moduleLabel, moduleName, buildName),
+		Subject: b.From.Range().Ptr(),
+	})
+}
+
+// scopeProvisioners returns copies of the provisioner blocks of the module
+// whose expressions are evaluated in the module.
+func (m *ModuleBlock) scopeProvisioners(blocks []*ProvisionerBlock) []*ProvisionerBlock {
+	res := make([]*ProvisionerBlock, 0, len(blocks))
+	for _, pb := range blocks {
+		scoped := *pb
+		scoped.HCL2Ref.Rest = m.scopeBody(pb.HCL2Ref.Rest)
+		if pb.Condition != nil {
+			scoped.Condition = m.scopeExpr(pb.Condition)
+		}
+		if pb.Parallel != nil {
+			scoped.Parallel = m.scopeProvisioners(pb.Parallel)
+		}
+		res = append(res, &scoped)
+	}
+	return res
+}
+
+// moduleScopedAccessors are the values that expressions of a module get from
+// the module, rather than from the configuration using it.
+var moduleScopedAccessors = map[string]bool{
+	inputVariablesAccessor: true,
+	localsAccessor:         true,
+	dataAccessor:           true,
+	pathVariablesAccessor:  true,
+	moduleAccessor:         true,
+}
+
+// evalContext returns the context in which the expressions of the module are
+// evaluated: the variables, locals, data sources and functions are the ones of
+// the module; the other values, like source or build, come from outer.
+func (m *ModuleBlock) evalContext(outer *hcl.EvalContext) *hcl.EvalContext {
+	m.ectxOnce.Do(func() {
+		m.ectx = m.Config.EvalContext(BuildContext, nil)
+	})
+
+	ectx := &hcl.EvalContext{
+		Functions: m.ectx.Functions,
+		Variables: map[string]cty.Value{},
+	}
+	for k, v := range m.ectx.Variables {
+		ectx.Variables[k] = v
+	}
+	// The values of a context are shadowed by the ones of its children.
+	var chain []*hcl.EvalContext
+	for c := outer; c != nil; c = c.Parent() {
+		chain = append(chain, c)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for k, v := range chain[i].Variables {
+			if !moduleScopedAccessors[k] {
+				ectx.Variables[k] = v
+			}
+		}
+	}
+	return ectx
+}
+
+func (m *ModuleBlock) scopeBody(body hcl.Body) hcl.Body {
+	return newScopedBody(body, m.evalContext)
+}
+
+func (m *ModuleBlock) scopeExpr(expr hcl.Expression) hcl.Expression {
+	return &scopedExpr{Expression: expr, scope: m.evalContext}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParse_module(t *testing.T) {
+	cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/module/basic", packer.InitializeOptions{})
+	builds := testGetBuilds(t, cfg, packer.GetBuildsOptions{})
+	if len(builds) != 1 {
+		t.Fatalf("expected 1 build, got %d", len(builds))
+	}
+
+	cb := builds[0].(*packer.CoreBuild)
+	if cb.Type != "null.base" {
+		t.Errorf("unexpected build type %q", cb.Type)
+	}
+	if got := cb.HCLConfig.GetAttr("ssh_username"); !got.RawEquals(cty.StringVal("packer")) {
+		t.Errorf("expected the source to use the input of the module, got %#v", got)
+	}
+
+	var names []string
+	for _, p := range cb.Provisioners {
+		names = append(names, p.PName)
+	}
+	if diff := cmp.Diff([]string{"before", "harden"}, names); diff != "" {
+		t.Fatalf("unexpected provisioners: %s", diff)
+	}
+
+	wantStrings := []string{"hello packer", "hello packer at level 1"}
+	for i, p := range cb.Provisioners {
+		if got := p.HCLConfig.GetAttr("string"); !got.RawEquals(cty.StringVal(wantStrings[i])) {
+			t.Errorf("%s: expected %q, got %#v", p.PName, wantStrings[i], got)
+		}
+	}
+}
+
+func TestParse_module_communicator(t *testing.T) {
+	cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/module/communicator", packer.InitializeOptions{})
+	builds := testGetBuilds(t, cfg, packer.GetBuildsOptions{})
+	if len(builds) != 1 {
+		t.Fatalf("expected 1 build, got %d", len(builds))
+	}
+
+	config := builds[0].(*packer.CoreBuild).HCLConfig
+	if got := config.GetAttr("communicator"); !got.RawEquals(cty.StringVal("ssh")) {
+		t.Errorf("expected the ssh communicator, got %#v", got)
+	}
+	if got := config.GetAttr("ssh_username"); !got.RawEquals(cty.StringVal("packer")) {
+		t.Errorf("expected the communicator of the module, with its variables, got %#v", got)
+	}
+}
+
+func TestParse_module_errors(t *testing.T) {
+	t.Run("cycle", func(t *testing.T) {
+		_, diags := getBasicParser().Parse("testdata/module/cycle", nil, nil)
+		if !strings.Contains(diags.Error(), "Module cycle") {
+			t.Fatalf("expected a module cycle error, got %s", diags)
+		}
+	})
+
+	t.Run("unknown input", func(t *testing.T) {
+		cfg := testParseConfig(t, getBasicParser(), "testdata/module/unknown_input")
+		diags := cfg.Initialize(packer.InitializeOptions{})
+		if !strings.Contains(diags.Error(), `does not declare a variable named "colour"`) {
+			t.Fatalf("expected an unsupported input error, got %s", diags)
+		}
+	})
+}
+
+func TestLocalModuleFetcher(t *testing.T) {
+	fetcher := LocalModuleFetcher{}
+
+	dir, err := fetcher.Fetch("./modules/hardening", "testdata/module/basic")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := filepath.FromSlash("testdata/module/basic/modules/hardening"); dir != want {
+		t.Errorf("expected %q, got %q", want, dir)
+	}
+
+	for _, source := range []string{"git::https://example.com/modules.git", "modules/hardening", "./missing"} {
+		if _, err := fetcher.Fetch(source, "testdata/module/basic"); err == nil {
+			t.Errorf("%q should not be fetched", source)
+		}
+	}
+}
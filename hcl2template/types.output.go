@@ -0,0 +1,214 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+var outputBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "value", Required: true},
+		{Name: "type"},
+		{Name: "description"},
+		{Name: "sensitive"},
+	},
+}
+
+// OutputBlock references an HCL 'output' block, exporting a result of the
+// builds once they completed:
+//
+//	output "ami_id" {
+//	  type  = string
+//	  value = builds["ubuntu.amazon-ebs.base"].artifact_id
+//	}
+type OutputBlock struct {
+	// Name of the output
+	Name string
+	// Description of the output
+	Description string
+	// Type the value of the output is converted to, cty.DynamicPseudoType
+	// when the output is not typed.
+	Type cty.Type
+	// When Sensitive is set to true the value of the output is not shown in
+	// the build output.
+	Sensitive bool
+
+	// Expr is the expression of the value of the output, evaluated once the
+	// builds completed.
+	Expr hcl.Expression
+
+	Range hcl.Range
+}
+
+type Outputs []*OutputBlock
+
+func (outputs Outputs) get(name string) *OutputBlock {
+	for _, output := range outputs {
+		if output.Name == name {
+			return output
+		}
+	}
+	return nil
+}
+
+func decodeOutputBlock(block *hcl.Block) (*OutputBlock, hcl.Diagnostics) {
+	output := &OutputBlock{
+		Name:  block.Labels[0],
+		Type:  cty.DynamicPseudoType,
+		Range: block.DefRange,
+	}
+
+	content, diags := block.Body.Content(outputBlockSchema)
+	if !hclsyntax.ValidIdentifier(output.Name) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + outputLabel + " name",
+			Detail:   badIdentifierDetail,
+			Subject:  &block.LabelRanges[0],
+		})
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	output.Expr = content.Attributes["value"].Expr
+
+	if attr, exists := content.Attributes["description"]; exists {
+		diags = append(diags, gohcl.DecodeExpression(attr.Expr, nil, &output.Description)...)
+	}
+
+	if attr, exists := content.Attributes["type"]; exists {
+		tp, moreDiags := typeexpr.Type(attr.Expr)
+		diags = append(diags, moreDiags...)
+		output.Type = tp
+	}
+
+	if attr, exists := content.Attributes["sensitive"]; exists {
+		diags = append(diags, gohcl.DecodeExpression(attr.Expr, nil, &output.Sensitive)...)
+	}
+
+	return output, diags
+}
+
+// buildArtifactsValue returns the value of the `builds` accessor of outputs:
+// an object with an attribute per build that produced artifacts, named after
+// the build. Each build has the ID of its first artifact, the generated data
+// of its first artifact and all its artifacts.
+func buildArtifactsValue(artifacts map[string][]packersdk.Artifact) (cty.Value, error) {
+	builds := map[string]cty.Value{}
+	for name, buildArtifacts := range artifacts {
+		artifactID := cty.NullVal(cty.String)
+		generatedData := cty.EmptyObjectVal
+		var values []cty.Value
+		for _, artifact := range buildArtifacts {
+			if artifact == nil {
+				continue
+			}
+			value, err := artifactValue(artifact)
+			if err != nil {
+				return cty.NilVal, fmt.Errorf("build %q: %s", name, err)
+			}
+			if artifactID.IsNull() {
+				artifactID = value.GetAttr("id")
+				generatedData = value.GetAttr("generated_data")
+			}
+			values = append(values, value)
+		}
+		list := cty.EmptyTupleVal
+		if len(values) > 0 {
+			list = cty.TupleVal(values)
+		}
+		builds[name] = cty.ObjectVal(map[string]cty.Value{
+			"artifact_id":    artifactID,
+			"generated_data": generatedData,
+			"artifacts":      list,
+		})
+	}
+	return cty.ObjectVal(builds), nil
+}
+
+// EvaluateOutputs evaluates the output blocks of the configuration, in the
+// order they are declared, with the artifacts of the builds that completed.
+func (cfg *PackerConfig) EvaluateOutputs(artifacts map[string][]packersdk.Artifact) ([]packer.Output, hcl.Diagnostics) {
+	if len(cfg.Outputs) == 0 {
+		return nil, nil
+	}
+
+	builds, err := buildArtifactsValue(artifacts)
+	if err != nil {
+		return nil, hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read the artifacts of the builds",
+			Detail:   err.Error(),
+		}}
+	}
+	ectx := cfg.EvalContext(BuildContext, map[string]cty.Value{
+		buildsAccessor: builds,
+	})
+
+	var diags hcl.Diagnostics
+	var outputs []packer.Output
+	for _, output := range cfg.Outputs {
+		value, moreDiags := output.Expr.Value(ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+
+		value, err := convert.Convert(value, output.Type)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid value for output",
+				Detail: fmt.Sprintf("The value of output %q is not compatible "+
+					"with its type constraint: %s.", output.Name, err),
+				Subject: output.Expr.Range().Ptr(),
+			})
+			continue
+		}
+		if !value.IsWhollyKnown() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unknown output value",
+				Detail: fmt.Sprintf("The value of output %q depends on values "+
+					"that are only known while a build runs.", output.Name),
+				Subject: output.Expr.Range().Ptr(),
+			})
+			continue
+		}
+
+		if hasMark(value, ephemeralMark) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Ephemeral value in output",
+				Detail: fmt.Sprintf("The value of output %q is derived from an "+
+					"ephemeral variable, which cannot be written to outputs.", output.Name),
+				Subject: output.Expr.Range().Ptr(),
+			})
+			continue
+		}
+
+		// An output derived from a sensitive value is sensitive too.
+		sensitive := output.Sensitive || hasMark(value, sensitiveMark)
+		value, _ = value.UnmarkDeep()
+
+		outputs = append(outputs, packer.Output{
+			Name:        output.Name,
+			Description: output.Description,
+			Sensitive:   sensitive,
+			Value:       value,
+		})
+	}
+	return outputs, diags
+}
@@ -0,0 +1,65 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParse_output(t *testing.T) {
+	cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/outputs/basic", packer.InitializeOptions{})
+
+	outputs, diags := cfg.EvaluateOutputs(map[string][]packersdk.Artifact{
+		"images.null.base": {
+			&packersdk.MockArtifact{
+				IdValue:    "image-1",
+				FilesValue: []string{"disk.qcow2"},
+				StateValues: map[string]interface{}{
+					"generated_data": map[interface{}]interface{}{"Region": "eu-west-1"},
+				},
+			},
+			&packersdk.MockArtifact{
+				IdValue:    "image-2",
+				FilesValue: []string{"box.ovf"},
+			},
+		},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected error: %s", diags)
+	}
+
+	want := []packer.Output{
+		{Name: "image_id", Description: "ID of the image", Value: cty.StringVal("image-1")},
+		{Name: "region", Value: cty.StringVal("eu-west-1")},
+		{Name: "files", Value: cty.ListVal([]cty.Value{cty.StringVal("disk.qcow2"), cty.StringVal("box.ovf")})},
+		{Name: "password", Sensitive: true, Value: cty.StringVal("s3cr3t")},
+	}
+	if len(outputs) != len(want) {
+		t.Fatalf("expected %d outputs, got %#v", len(want), outputs)
+	}
+	for i, output := range outputs {
+		if output.Name != want[i].Name || output.Description != want[i].Description ||
+			output.Sensitive != want[i].Sensitive || !output.Value.RawEquals(want[i].Value) {
+			t.Errorf("expected output %#v, got %#v", want[i], output)
+		}
+	}
+
+	_, diags = cfg.EvaluateOutputs(nil)
+	if !diags.HasErrors() {
+		t.Fatalf("expected an error when the build did not complete")
+	}
+}
+
+func TestParse_output_duplicate(t *testing.T) {
+	cfg := testParseConfig(t, getBasicParser(), "testdata/outputs/duplicate")
+	diags := cfg.Initialize(packer.InitializeOptions{})
+	if !strings.Contains(diags.Error(), "Duplicate output block") {
+		t.Fatalf("expected a duplicate output error, got %s", diags)
+	}
+}
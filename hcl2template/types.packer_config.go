@@ -5,6 +5,8 @@ package hcl2template
 
 import (
 	"fmt"
+	"io"
+	"log"
 	"sort"
 	"strings"
 
@@ -16,6 +18,7 @@ import (
 	pkrfunction "github.com/hashicorp/packer/hcl2template/function"
 	"github.com/hashicorp/packer/packer"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
 	"github.com/zclconf/go-cty/cty/function"
 )
 
@@ -39,6 +42,12 @@ type PackerConfig struct {
 	// Available Source blocks
 	Sources map[SourceRef]SourceBlock
 
+	// Available Communicator blocks, that sources can reference
+	Communicators map[CommunicatorRef]CommunicatorBlock
+
+	// Modules are the configurations loaded by module blocks
+	Modules Modules
+
 	// InputVariables and LocalVariables are the list of defined input and
 	// local variables. They are of the same type but are not used in the same
 	// way. Local variables will not be decoded from any config file, env var,
@@ -55,12 +64,34 @@ type PackerConfig struct {
 	// Builds is the list of Build blocks defined in the config files.
 	Builds Builds
 
+	// Outputs are the output blocks, in the order they are declared.
+	Outputs Outputs
+
+	// Checks are the check blocks, in the order they are declared.
+	Checks Checks
+
 	// HCPVars is the list of HCP-set variables for use later in a template
 	HCPVars map[string]cty.Value
 
 	parser *Parser
 	files  []*hcl.File
 
+	// isModule is set for the configuration of a module, whose build blocks
+	// only hold provisioners for the configurations using it.
+	isModule bool
+
+	// mockData are the data sources whose outputs are mocked, instead of
+	// executing them.
+	mockData MockData
+
+	// mockSources are the sources whose builders are replaced by a mock,
+	// producing an artifact without building anything.
+	mockSources MockSources
+
+	// inputFiles are the local files matched by fileset() in the expressions
+	// evaluated so far, in this configuration and its modules.
+	inputFiles *inputFiles
+
 	// Fields passed as command line flags
 	except  []glob.Glob
 	only    []glob.Glob
@@ -81,6 +112,12 @@ const (
 	buildAccessor          = "build"
 	packerAccessor         = "packer"
 	dataAccessor           = "data"
+	upstreamAccessor       = "upstream"
+	moduleAccessor         = "module"
+	eachAccessor           = "each"
+	countAccessor          = "count"
+	artifactAccessor       = "artifact"
+	buildsAccessor         = "builds"
 )
 
 type BlockContext int
@@ -100,7 +137,7 @@ func (cfg *PackerConfig) EvalContext(ctx BlockContext, variables map[string]cty.
 	inputVariables := cfg.InputVariables.Values()
 	localVariables := cfg.LocalVariables.Values()
 	ectx := &hcl.EvalContext{
-		Functions: Functions(cfg.Basedir),
+		Functions: cfg.functions(cfg.Basedir),
 		Variables: map[string]cty.Value{
 			inputVariablesAccessor: cty.ObjectVal(inputVariables),
 			localsAccessor:         cty.ObjectVal(localVariables),
@@ -143,6 +180,9 @@ func (cfg *PackerConfig) EvalContext(ctx BlockContext, variables map[string]cty.
 		datasourceVariables, _ := cfg.Datasources.Values()
 		ectx.Variables[dataAccessor] = cty.ObjectVal(datasourceVariables)
 	}
+	if ctx == BuildContext && len(cfg.Modules) > 0 {
+		ectx.Variables[moduleAccessor] = cfg.Modules.Values()
+	}
 
 	for k, v := range variables {
 		ectx.Variables[k] = v
@@ -150,6 +190,38 @@ func (cfg *PackerConfig) EvalContext(ctx BlockContext, variables map[string]cty.
 	return ectx
 }
 
+// functions returns the functions of the expressions of the files of the dir
+// directory, the files matched by their fileset calls being recorded.
+func (cfg *PackerConfig) functions(dir string) map[string]function.Function {
+	funcs := Functions(dir)
+	if cfg.inputFiles != nil {
+		funcs["fileset"] = recordFileSet(funcs["fileset"], dir, cfg.inputFiles)
+	}
+	return funcs
+}
+
+// fileScope returns the scope of the files of the dir directory, when they
+// are merged into a configuration whose base directory is another one: their
+// path.root is dir, and their file functions are relative to it.
+func (cfg *PackerConfig) fileScope(dir string) func(*hcl.EvalContext) *hcl.EvalContext {
+	functions := cfg.functions(dir)
+	path := cty.ObjectVal(map[string]cty.Value{
+		"cwd":  cty.StringVal(strings.ReplaceAll(cfg.Cwd, `\`, `/`)),
+		"root": cty.StringVal(strings.ReplaceAll(dir, `\`, `/`)),
+	})
+	return func(ctx *hcl.EvalContext) *hcl.EvalContext {
+		if ctx == nil {
+			return nil
+		}
+		child := ctx.NewChild()
+		child.Functions = functions
+		child.Variables = map[string]cty.Value{
+			pathVariablesAccessor: path,
+		}
+		return child
+	}
+}
+
 // decodeInputVariables looks in the found blocks for 'variables' and
 // 'variable' blocks. It should be called firsthand so that other blocks can
 // use the variables.
@@ -265,18 +337,19 @@ func checkForDuplicateLocalDefinition(locals []*LocalBlock) hcl.Diagnostics {
 
 	// we could sort by name and then check contiguous names to use less memory,
 	// but using a map sounds good enough.
-	names := map[string]struct{}{}
+	names := map[string]*LocalBlock{}
 	for _, local := range locals {
-		if _, found := names[local.Name]; found {
+		if existing, found := names[local.Name]; found {
 			diags = append(diags, &hcl.Diagnostic{
 				Severity: hcl.DiagError,
 				Summary:  "Duplicate local definition",
-				Detail:   "Duplicate " + local.Name + " definition found.",
-				Subject:  local.Expr.Range().Ptr(),
+				Detail: fmt.Sprintf("Duplicate %s definition found, it was "+
+					"previously defined at %s.", local.Name, existing.Expr.Range().Ptr()),
+				Subject: local.Expr.Range().Ptr(),
 			})
 			continue
 		}
-		names[local.Name] = struct{}{}
+		names[local.Name] = local
 	}
 	return diags
 }
@@ -303,129 +376,323 @@ func (c *PackerConfig) evaluateLocalVariable(local *LocalBlock) hcl.Diagnostics
 	return diags
 }
 
-func (cfg *PackerConfig) evaluateDatasources(skipExecution bool) hcl.Diagnostics {
-	var diags hcl.Diagnostics
-
+// evaluateDatasources evaluates the data sources of the configuration, each
+// once the data sources it depends on are evaluated. Data sources that do not
+// depend on each other are evaluated concurrently, at most
+// opts.DatasourceParallelism at a time, 0 meaning no limit.
+func (cfg *PackerConfig) evaluateDatasources(opts packer.InitializeOptions) hcl.Diagnostics {
+	// Pre-examine the body of each data source to see if it uses other data
+	// sources in its input expressions; it can only be evaluated once they
+	// are, with them in its context.
 	dependencies := map[DatasourceRef][]DatasourceRef{}
 	for ref, ds := range cfg.Datasources {
 		if ds.value != (cty.Value{}) {
 			continue
 		}
-		// Pre-examine body of this data source to see if it uses another data
-		// source in any of its input expressions. If so, skip evaluating it for
-		// now, and add it to a list of datasources to evaluate again, later,
-		// with the datasources in its context.
-		dependencies[ref] = []DatasourceRef{}
+		dependencies[ref] = cfg.datasourceDependencies(ds)
+	}
 
-		// Note: when looking at the expressions, we only need to care about
-		// attributes, as HCL2 expressions are not allowed in a block's labels.
-		vars := GetVarsByType(ds.block, "data")
-		for _, v := range vars {
-			// construct, backwards, the data source type and name we
-			// need to evaluate before this one can be evaluated.
-			dependsOn := DatasourceRef{
-				Type: v[1].(hcl.TraverseAttr).Name,
-				Name: v[2].(hcl.TraverseAttr).Name,
+	diags := checkDatasourceCycles(cfg.Datasources, dependencies)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	// pending counts the dependencies of each data source that are not
+	// evaluated yet, a data source is ready once it has none.
+	pending := map[DatasourceRef]int{}
+	dependents := map[DatasourceRef][]DatasourceRef{}
+	for ref, deps := range dependencies {
+		for _, dep := range deps {
+			if _, unevaluated := dependencies[dep]; unevaluated {
+				pending[ref]++
+				dependents[dep] = append(dependents[dep], ref)
 			}
-			dependencies[ref] = append(dependencies[ref], dependsOn)
 		}
 	}
-
-	// Now that most of our data sources have been started and executed, we can
-	// try to execute the ones that depend on other data sources.
+	var ready []DatasourceRef
 	for ref := range dependencies {
-		_, moreDiags := cfg.recursivelyEvaluateDatasources(ref, dependencies, skipExecution, 0)
-		// Deduplicate diagnostics to prevent recursion messes.
-		cleanedDiags := map[string]*hcl.Diagnostic{}
-		for _, diag := range moreDiags {
-			cleanedDiags[diag.Summary] = diag
+		if pending[ref] == 0 {
+			ready = append(ready, ref)
+		}
+	}
+	sortDatasourceRefs(ready)
+
+	type result struct {
+		ref   DatasourceRef
+		value cty.Value
+		diags hcl.Diagnostics
+	}
+	results := make(chan result)
+	running := 0
+	skipped := map[DatasourceRef]bool{}
+	for len(ready) > 0 || running > 0 {
+		for len(ready) > 0 && (opts.DatasourceParallelism <= 0 || running < opts.DatasourceParallelism) {
+			ref := ready[0]
+			ready = ready[1:]
+			// The context is made here, as the data sources are only
+			// updated by this goroutine.
+			ds, ectx := cfg.Datasources[ref], cfg.EvalContext(DatasourceContext, nil)
+			running++
+			go func() {
+				value, diags := cfg.evaluateDatasource(ds, ectx, opts)
+				results <- result{ref: ref, value: value, diags: diags}
+			}()
 		}
 
-		for _, diag := range cleanedDiags {
-			diags = append(diags, diag)
+		res := <-results
+		running--
+		diags = append(diags, res.diags...)
+		if res.diags.HasErrors() {
+			// the data sources depending on it are never ready.
+			diags = append(diags, cfg.skipDatasourceDependents(res.ref, dependents, skipped)...)
+			continue
 		}
+
+		ds := cfg.Datasources[res.ref]
+		ds.value = res.value
+		cfg.Datasources[res.ref] = ds
+		filterSensitiveValues(ds.outputValue())
+
+		var nowReady []DatasourceRef
+		for _, dependent := range dependents[res.ref] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				nowReady = append(nowReady, dependent)
+			}
+		}
+		sortDatasourceRefs(nowReady)
+		ready = append(ready, nowReady...)
 	}
 
 	return diags
 }
 
-func (cfg *PackerConfig) recursivelyEvaluateDatasources(ref DatasourceRef, dependencies map[DatasourceRef][]DatasourceRef, skipExecution bool, depth int) (map[DatasourceRef][]DatasourceRef, hcl.Diagnostics) {
+// skipDatasourceDependents returns a diagnostic for each data source that is
+// not evaluated because it depends, directly or not, on the failed data
+// source. Data sources already in skipped are not reported again.
+func (cfg *PackerConfig) skipDatasourceDependents(failed DatasourceRef, dependents map[DatasourceRef][]DatasourceRef, skipped map[DatasourceRef]bool) hcl.Diagnostics {
 	var diags hcl.Diagnostics
-	var moreDiags hcl.Diagnostics
+	// chain is the path from a skipped data source to the failed one.
+	var skip func(ref DatasourceRef, chain []string)
+	skip = func(ref DatasourceRef, chain []string) {
+		refs := append([]DatasourceRef{}, dependents[ref]...)
+		sortDatasourceRefs(refs)
+		for _, dependent := range refs {
+			if skipped[dependent] {
+				continue
+			}
+			skipped[dependent] = true
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Data source not evaluated",
+				Detail: fmt.Sprintf("%s depends on %s, which failed to be evaluated.",
+					dependent, strings.Join(chain, ", which depends on ")),
+				Subject: cfg.Datasources[dependent].block.DefRange.Ptr(),
+			})
+			skip(dependent, append([]string{dependent.String()}, chain...))
+		}
+	}
+	skip(failed, []string{failed.String()})
+	return diags
+}
 
-	if depth > 10 {
-		// Add a comment about recursion.
-		diags = append(diags, &hcl.Diagnostic{
-			Severity: hcl.DiagError,
-			Summary:  "Max datasource recursion depth exceeded.",
-			Detail: "An error occured while recursively evaluating data " +
-				"sources. Either your data source depends on more than ten " +
-				"other data sources, or your data sources have a cyclic " +
-				"dependency. Please simplify your config to continue. ",
-			Subject: &(cfg.Datasources[ref]).block.DefRange,
-		})
-		return dependencies, diags
-	}
-
-	ds := cfg.Datasources[ref]
-	// Make sure everything ref depends on has already been evaluated.
-	for _, dep := range dependencies[ref] {
-		if _, ok := dependencies[dep]; ok {
-			depth += 1
-			// If this dependency is not in the map, it means we've already
-			// launched and executed this datasource. Otherwise, it means
-			// we still need to run it. RECURSION TIME!!
-			dependencies, moreDiags = cfg.recursivelyEvaluateDatasources(dep, dependencies, skipExecution, depth)
-			diags = append(diags, moreDiags...)
-			if moreDiags.HasErrors() {
-				diags = append(diags, moreDiags...)
-				return dependencies, diags
+// datasourceDependencies returns the data sources of the configuration that
+// ds uses in its input expressions. References to data sources that do not
+// exist are left out; they are reported when ds is decoded.
+func (cfg *PackerConfig) datasourceDependencies(ds DatasourceBlock) []DatasourceRef {
+	var deps []DatasourceRef
+	seen := map[DatasourceRef]bool{}
+	// Note: when looking at the expressions, we only need to care about
+	// attributes, as HCL2 expressions are not allowed in a block's labels.
+	for _, v := range GetVarsByType(ds.block, dataAccessor) {
+		if len(v) < 3 {
+			continue
+		}
+		typ, ok := v[1].(hcl.TraverseAttr)
+		if !ok {
+			continue
+		}
+		name, ok := v[2].(hcl.TraverseAttr)
+		if !ok {
+			continue
+		}
+		dep := DatasourceRef{Type: typ.Name, Name: name.Name}
+		if _, exists := cfg.Datasources[dep]; !exists || seen[dep] {
+			continue
+		}
+		seen[dep] = true
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+// checkDatasourceCycles makes sure that the data sources being evaluated do
+// not depend on themselves, reporting the full path of a cycle.
+func checkDatasourceCycles(datasources Datasources, dependencies map[DatasourceRef][]DatasourceRef) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	// Walk the dependency graph depth first, a data source we meet again
+	// while it is still on the path is part of a cycle.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[DatasourceRef]int{}
+	var path []DatasourceRef
+	var visit func(ref DatasourceRef) bool
+	visit = func(ref DatasourceRef) bool {
+		switch state[ref] {
+		case visited:
+			return true
+		case visiting:
+			var cycle []string
+			for i := len(path) - 1; i >= 0; i-- {
+				if path[i] == ref {
+					for _, r := range path[i:] {
+						cycle = append(cycle, r.String())
+					}
+					break
+				}
 			}
+			cycle = append(cycle, ref.String())
+			ds := datasources[ref]
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Data source dependency cycle",
+				Detail: fmt.Sprintf("Data sources cannot depend on themselves: %s.",
+					strings.Join(cycle, " -> ")),
+				Subject: ds.block.DefRange.Ptr(),
+			})
+			return false
 		}
+		state[ref] = visiting
+		path = append(path, ref)
+		for _, dep := range dependencies[ref] {
+			if _, unevaluated := dependencies[dep]; !unevaluated {
+				continue
+			}
+			if !visit(dep) {
+				return false
+			}
+		}
+		path = path[:len(path)-1]
+		state[ref] = visited
+		return true
 	}
-	// If we've gotten here, then it means ref doesn't seem to have any further
-	// dependencies we need to evaluate first. Evaluate it, with the cfg's full
-	// data source context.
-	datasource, startDiags := cfg.startDatasource(ds)
-	if startDiags.HasErrors() {
-		diags = append(diags, startDiags...)
-		return dependencies, diags
+
+	refs := make([]DatasourceRef, 0, len(dependencies))
+	for ref := range dependencies {
+		refs = append(refs, ref)
 	}
+	sortDatasourceRefs(refs)
+	for _, ref := range refs {
+		if !visit(ref) {
+			break
+		}
+	}
+	return diags
+}
 
-	if skipExecution {
-		placeholderValue := cty.UnknownVal(hcldec.ImpliedType(datasource.OutputSpec()))
-		ds.value = placeholderValue
-		cfg.Datasources[ref] = ds
-		return dependencies, diags
+func sortDatasourceRefs(refs []DatasourceRef) {
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].String() < refs[j].String()
+	})
+}
+
+// evaluateDatasource starts and configures the data source of ds, with ectx,
+// and returns its outputs: the ones of its mock when it is mocked, unknown
+// values when data sources are not executed, the cached ones when its
+// outputs are cached, or the ones of its execution.
+func (cfg *PackerConfig) evaluateDatasource(ds DatasourceBlock, ectx *hcl.EvalContext, opts packer.InitializeOptions) (cty.Value, hcl.Diagnostics) {
+	datasource, config, diags := cfg.startDatasource(ds, ectx)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	outputType := hcldec.ImpliedType(datasource.OutputSpec())
+
+	// A mocked data source is configured, but its outputs are the ones of
+	// the mock, whether data sources are executed or not.
+	if mock, found := cfg.mockData[ds.Ref()]; found {
+		value, moreDiags := mock.outputValue(outputType)
+		return value, append(diags, moreDiags...)
+	}
+
+	if opts.SkipDatasourcesExecution {
+		return cty.UnknownVal(outputType), diags
 	}
 
-	opts, _ := decodeHCL2Spec(ds.block.Body, cfg.EvalContext(DatasourceContext, nil), datasource)
-	sp := packer.CheckpointReporter.AddSpan(ref.Type, "datasource", opts)
-	realValue, err := datasource.Execute()
+	var cachePath string
+	if ds.CacheTTL > 0 {
+		if reason := datasourceNotCacheable(ds, datasource.ConfigSpec(), ectx); reason != "" {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Outputs of " + ds.Ref().String() + " not cached",
+				Detail: fmt.Sprintf("The %s of %s is ignored, as %s: its outputs "+
+					"must not be written to disk.", cacheTTLAttr, ds.Ref(), reason),
+				Subject: &ds.block.DefRange,
+			})
+		} else {
+			path, err := datasourceCachePath(ds.Type, config)
+			if err != nil {
+				log.Printf("[WARN] not caching the outputs of %s: %s", ds.Ref(), err)
+			}
+			cachePath = path
+		}
+	}
+	if cachePath != "" && !opts.RefreshDatasources {
+		if value, found := readDatasourceCache(cachePath, ds.CacheTTL, outputType); found {
+			log.Printf("[INFO] using the cached outputs of %s", ds.Ref())
+			return value, diags
+		}
+	}
+
+	sp := packer.CheckpointReporter.AddSpan(ds.Type, "datasource", config)
+	value, err := datasource.Execute()
 	sp.End(err)
 	if err != nil {
-		diags = append(diags, &hcl.Diagnostic{
+		return cty.NilVal, append(diags, &hcl.Diagnostic{
 			Summary:  err.Error(),
-			Subject:  &cfg.Datasources[ref].block.DefRange,
+			Subject:  &ds.block.DefRange,
 			Severity: hcl.DiagError,
 		})
-		return dependencies, diags
+	}
+	// The outputs of a plugin do not always have the types of its output
+	// spec, a duration can be a number. They are converted so that they can
+	// be listed with mocked, cached or unknown outputs of the same type.
+	if converted, err := convert.Convert(value, outputType); err == nil {
+		value = converted
 	}
 
-	ds.value = realValue
-	cfg.Datasources[ref] = ds
-	// remove ref from the dependencies map.
-	delete(dependencies, ref)
-	return dependencies, diags
+	if cachePath != "" {
+		if err := writeDatasourceCache(cachePath, ds.Type, value); err != nil {
+			log.Printf("[WARN] failed to cache the outputs of %s: %s", ds.Ref(), err)
+		}
+	}
+	return value, diags
 }
 
 // getCoreBuildProvisioners takes a list of provisioner block, starts according
-// provisioners and sends parsed HCL2 over to it.
-func (cfg *PackerConfig) getCoreBuildProvisioners(source SourceUseBlock, blocks []*ProvisionerBlock, ectx *hcl.EvalContext) ([]packer.CoreBuildProvisioner, hcl.Diagnostics) {
+// provisioners and sends parsed HCL2 over to it. The build variables in
+// unknown are only known once the build runs.
+func (cfg *PackerConfig) getCoreBuildProvisioners(source SourceUseBlock, blocks []*ProvisionerBlock, ectx *hcl.EvalContext, unknown unknownBuildKeys) ([]packer.CoreBuildProvisioner, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
 	res := []packer.CoreBuildProvisioner{}
 	for _, pb := range blocks {
-		if pb.OnlyExcept.Skip(source.String()) {
+		if pb.Parallel != nil {
+			group, ok, moreDiags := cfg.getCoreBuildProvisionersParallel(source, pb, ectx, unknown)
+			diags = append(diags, moreDiags...)
+			if ok {
+				res = append(res, group)
+			}
+			continue
+		}
+		if source.skippedBy(&pb.OnlyExcept) {
+			continue
+		}
+		run, moreDiags := runOnCondition(pb.Condition, ectx, unknown)
+		diags = append(diags, moreDiags...)
+		if !run {
 			continue
 		}
 
@@ -465,6 +732,7 @@ func (cfg *PackerConfig) getCoreBuildProvisioner(source SourceUseBlock, pb *Prov
 		provisioner = &packer.RetriedProvisioner{
 			MaxRetries:  pb.MaxRetries,
 			Provisioner: provisioner,
+			Retry:       pb.Retry,
 		}
 	}
 
@@ -478,13 +746,18 @@ func (cfg *PackerConfig) getCoreBuildProvisioner(source SourceUseBlock, pb *Prov
 
 // getCoreBuildProvisioners takes a list of post processor block, starts
 // according provisioners and sends parsed HCL2 over to it.
-func (cfg *PackerConfig) getCoreBuildPostProcessors(source SourceUseBlock, blocksList [][]*PostProcessorBlock, ectx *hcl.EvalContext, exceptMatches *int) ([][]packer.CoreBuildPostProcessor, hcl.Diagnostics) {
+func (cfg *PackerConfig) getCoreBuildPostProcessors(source SourceUseBlock, blocksList [][]*PostProcessorBlock, ectx *hcl.EvalContext, unknown unknownBuildKeys, exceptMatches *int) ([][]packer.CoreBuildPostProcessor, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
 	res := [][]packer.CoreBuildPostProcessor{}
 	for _, blocks := range blocksList {
 		pps := []packer.CoreBuildPostProcessor{}
 		for _, ppb := range blocks {
-			if ppb.OnlyExcept.Skip(source.String()) {
+			if source.skippedBy(&ppb.OnlyExcept) {
+				continue
+			}
+			run, moreDiags := runOnCondition(ppb.Condition, postProcessorConditionEvalContext(ectx), unknown)
+			diags = append(diags, moreDiags...)
+			if !run {
 				continue
 			}
 
@@ -511,8 +784,24 @@ func (cfg *PackerConfig) getCoreBuildPostProcessors(source SourceUseBlock, block
 				continue
 			}
 
+			if ppb.PType == manifestPostProcessorType {
+				moreDiags = checkEphemeralManifest(ppb, ectx, postProcessor)
+				diags = append(diags, moreDiags...)
+				if moreDiags.HasErrors() {
+					continue
+				}
+			}
+
 			flatPostProcessorCfg, moreDiags := decodeHCL2Spec(ppb.HCL2Ref.Rest, ectx, postProcessor)
 
+			if ppb.MaxRetries != 0 {
+				postProcessor = &packer.RetriedPostProcessor{
+					MaxRetries:    ppb.MaxRetries,
+					Retry:         ppb.Retry,
+					PostProcessor: postProcessor,
+				}
+			}
+
 			pps = append(pps, packer.CoreBuildPostProcessor{
 				PostProcessor:     postProcessor,
 				PName:             ppb.PName,
@@ -529,6 +818,53 @@ func (cfg *PackerConfig) getCoreBuildPostProcessors(source SourceUseBlock, block
 	return res, diags
 }
 
+// upstreamPreparer returns the function that configures pcb with the
+// artifacts of the builds it depends on, once those completed: the builder is
+// started again with the now known upstream values, replacing the one started
+// with unknown values, and they are set in the context the provisioners and
+// post-processors are configured with. The warnings of the new builder are
+// returned.
+func (cfg *PackerConfig) upstreamPreparer(pcb *packer.CoreBuild, srcUsage SourceUseBlock, deps []BuildDependency, buildEctx *hcl.EvalContext) func(map[string][]packersdk.Artifact) ([]string, error) {
+	return func(artifacts map[string][]packersdk.Artifact) ([]string, error) {
+		upstream := upstreamValues(deps, artifacts)
+		variables := map[string]cty.Value{
+			upstreamAccessor: upstream,
+		}
+		for k, v := range srcUsage.instanceVariables {
+			variables[k] = v
+		}
+		ectx := cfg.EvalContext(BuildContext, variables)
+		builder, diags, _ := cfg.startBuilder(srcUsage, ectx)
+		if diags.HasErrors() {
+			closeBuilder(builder)
+			return nil, diags
+		}
+		var warnings []string
+		for _, diag := range diags {
+			warnings = append(warnings, diag.Summary)
+		}
+
+		closeBuilder(pcb.Builder)
+		pcb.Builder = cfg.mockBuilder(srcUsage, builder)
+		pcb.HCLConfig, _ = decodeHCL2Spec(srcUsage.Body, ectx, builder)
+		buildEctx.Variables[upstreamAccessor] = upstream
+		return warnings, nil
+	}
+}
+
+// closeBuilder stops the plugin running builder, if any. It is used to stop
+// the builders that are replaced before they were run.
+func closeBuilder(builder packersdk.Builder) {
+	if mock, ok := builder.(*mockSourceBuilder); ok {
+		builder = mock.Builder
+	}
+	if closer, ok := builder.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("[WARN] failed to stop builder: %s", err)
+		}
+	}
+}
+
 // GetBuilds returns a list of packer Build based on the HCL2 parsed build
 // blocks. All Builders, Provisioners and Post Processors will be started and
 // configured.
@@ -551,7 +887,7 @@ func (cfg *PackerConfig) GetBuilds(opts packer.GetBuildsOptions) ([]packersdk.Bu
 
 	for _, build := range cfg.Builds {
 		for _, srcUsage := range build.Sources {
-			src, found := cfg.Sources[srcUsage.SourceRef]
+			src, found := cfg.sourceBlock(srcUsage)
 			if !found {
 				diags = append(diags, &hcl.Diagnostic{
 					Summary:  "Unknown " + sourceLabel + " " + srcUsage.String(),
@@ -614,14 +950,33 @@ func (cfg *PackerConfig) GetBuilds(opts packer.GetBuildsOptions) ([]packersdk.Bu
 				}
 			}
 
-			builder, moreDiags, generatedVars := cfg.startBuilder(srcUsage, cfg.EvalContext(BuildContext, nil))
+			// Builds depending on other builds can use their artifacts through
+			// the upstream accessor; these are unknown until the upstream
+			// builds ran.
+			var sourceVariables map[string]cty.Value
+			if len(build.DependsOn) > 0 {
+				sourceVariables = map[string]cty.Value{
+					upstreamAccessor: upstreamValues(build.DependsOn, nil),
+				}
+			}
+			// The instances of a source used with for_each or count can use
+			// each or count.
+			for k, v := range srcUsage.instanceVariables {
+				if sourceVariables == nil {
+					sourceVariables = map[string]cty.Value{}
+				}
+				sourceVariables[k] = v
+			}
+
+			builder, moreDiags, generatedVars := cfg.startBuilder(srcUsage, cfg.EvalContext(BuildContext, sourceVariables))
 			diags = append(diags, moreDiags...)
 			if moreDiags.HasErrors() {
 				continue
 			}
 
-			decoded, _ := decodeHCL2Spec(srcUsage.Body, cfg.EvalContext(BuildContext, nil), builder)
+			decoded, _ := decodeHCL2Spec(srcUsage.Body, cfg.EvalContext(BuildContext, sourceVariables), builder)
 			pcb.HCLConfig = decoded
+			generatedVars, pcb.Resumable = packer.ResumableGeneratedVars(generatedVars)
 
 			// If the builder has provided a list of to-be-generated variables that
 			// should be made accessible to provisioners, pass that list into
@@ -629,30 +984,48 @@ func (cfg *PackerConfig) GetBuilds(opts packer.GetBuildsOptions) ([]packersdk.Bu
 			// validate user input against what will become available. Otherwise,
 			// only pass the default variables, using the basic placeholder data.
 			unknownBuildValues := map[string]cty.Value{}
+			unknown := unknownBuildKeys{}
 			for _, k := range append(packer.BuilderDataCommonKeys, generatedVars...) {
 				unknownBuildValues[k] = cty.StringVal("<unknown>")
+				unknown[k] = true
 			}
 			unknownBuildValues["name"] = cty.StringVal(build.Name)
+			delete(unknown, "name")
 
 			variables := map[string]cty.Value{
 				sourcesAccessor: cty.ObjectVal(srcUsage.ctyValues()),
 				buildAccessor:   cty.ObjectVal(unknownBuildValues),
 			}
+			for k, v := range sourceVariables {
+				variables[k] = v
+			}
+			// Provisioners and post-processors are configured again right
+			// before they run, with this context; so that upstream values
+			// can be set in it once known.
+			buildEctx := cfg.EvalContext(BuildContext, variables)
 
-			provisioners, moreDiags := cfg.getCoreBuildProvisioners(srcUsage, build.ProvisionerBlocks, cfg.EvalContext(BuildContext, variables))
+			provisioners, moreDiags := cfg.getCoreBuildProvisioners(srcUsage, build.ProvisionerBlocks, buildEctx, unknown)
 			diags = append(diags, moreDiags...)
 			if moreDiags.HasErrors() {
 				continue
 			}
-			pps, moreDiags := cfg.getCoreBuildPostProcessors(srcUsage, build.PostProcessorsLists, cfg.EvalContext(BuildContext, variables), &opts.ExceptMatches)
+			pps, moreDiags := cfg.getCoreBuildPostProcessors(srcUsage, build.PostProcessorsLists, buildEctx, unknown, &opts.ExceptMatches)
 			diags = append(diags, moreDiags...)
 			if moreDiags.HasErrors() {
 				continue
 			}
 
+			runErrorCleanupProv := false
 			if build.ErrorCleanupProvisionerBlock != nil &&
-				!build.ErrorCleanupProvisionerBlock.OnlyExcept.Skip(srcUsage.String()) {
-				errorCleanupProv, moreDiags := cfg.getCoreBuildProvisioner(srcUsage, build.ErrorCleanupProvisionerBlock, cfg.EvalContext(BuildContext, variables))
+				!srcUsage.skippedBy(&build.ErrorCleanupProvisionerBlock.OnlyExcept) {
+				runErrorCleanupProv, moreDiags = runOnCondition(build.ErrorCleanupProvisionerBlock.Condition, buildEctx, unknown)
+				diags = append(diags, moreDiags...)
+				if moreDiags.HasErrors() {
+					continue
+				}
+			}
+			if runErrorCleanupProv {
+				errorCleanupProv, moreDiags := cfg.getCoreBuildProvisioner(srcUsage, build.ErrorCleanupProvisionerBlock, buildEctx)
 				diags = append(diags, moreDiags...)
 				if moreDiags.HasErrors() {
 					continue
@@ -660,11 +1033,19 @@ func (cfg *PackerConfig) GetBuilds(opts packer.GetBuildsOptions) ([]packersdk.Bu
 				pcb.CleanupProvisioner = errorCleanupProv
 			}
 
-			pcb.Builder = builder
+			pcb.Builder = cfg.mockBuilder(srcUsage, builder)
 			pcb.Provisioners = provisioners
 			pcb.PostProcessors = pps
+			pcb.Timeout = build.Timeout
 			pcb.Prepared = true
 
+			if len(build.DependsOn) > 0 {
+				for _, dep := range build.DependsOn {
+					pcb.DependsOn = append(pcb.DependsOn, dep.Name)
+				}
+				pcb.PrepareUpstream = cfg.upstreamPreparer(pcb, srcUsage, build.DependsOn, buildEctx)
+			}
+
 			// Prepare just sets the "prepareCalled" flag on CoreBuild, since
 			// we did all the prep here.
 			_, err := pcb.Prepare()
@@ -681,6 +1062,16 @@ func (cfg *PackerConfig) GetBuilds(opts packer.GetBuildsOptions) ([]packersdk.Bu
 			res = append(res, pcb)
 		}
 	}
+	diags = append(diags, checkSelectedDependencies(cfg.Builds, res)...)
+	if cfg.inputFiles != nil {
+		// The configurations of the builds were all evaluated, except for
+		// those of the builds depending on other builds.
+		if files := cfg.inputFiles.list(); len(files) > 0 {
+			for _, b := range res {
+				b.(*packer.CoreBuild).InputFiles = files
+			}
+		}
+	}
 	if len(opts.Only) > opts.OnlyMatches {
 		diags = append(diags, &hcl.Diagnostic{
 			Severity: hcl.DiagWarning,
@@ -739,22 +1130,36 @@ func (p *PackerConfig) printVariables() string {
 	out.WriteString("> input-variables:\n\n")
 	keys := p.InputVariables.Keys()
 	sort.Strings(keys)
+	values := p.InputVariables.Values()
 	for _, key := range keys {
 		v := p.InputVariables[key]
-		val := v.Value()
-		fmt.Fprintf(out, "var.%s: %q\n", v.Name, PrintableCtyValue(val))
+		fmt.Fprintf(out, "var.%s: %q", v.Name, printableVariableValue(values[key]))
+		if n := len(v.Values); n > 0 && strings.HasPrefix(v.Values[n-1].From, varSourceFromPrefix) {
+			// tell which variable source set the value
+			fmt.Fprintf(out, " (from %s)", v.Values[n-1].From)
+		}
+		out.WriteString("\n")
 	}
 	out.WriteString("\n> local-variables:\n\n")
 	keys = p.LocalVariables.Keys()
 	sort.Strings(keys)
+	values = p.LocalVariables.Values()
 	for _, key := range keys {
 		v := p.LocalVariables[key]
-		val := v.Value()
-		fmt.Fprintf(out, "local.%s: %q\n", v.Name, PrintableCtyValue(val))
+		fmt.Fprintf(out, "local.%s: %q\n", v.Name, printableVariableValue(values[key]))
 	}
 	return out.String()
 }
 
+// printableVariableValue returns how the value of a variable or local is
+// printed: ephemeral values, and the ones derived from them, are not.
+func printableVariableValue(v cty.Value) string {
+	if hasMark(v, ephemeralMark) {
+		return "<ephemeral>"
+	}
+	return PrintableCtyValue(v)
+}
+
 func (p *PackerConfig) printBuilds() string {
 	out := &strings.Builder{}
 	out.WriteString("> builds:\n")
@@ -779,6 +1184,17 @@ func (p *PackerConfig) printBuilds() string {
 			fmt.Fprintf(out, "      <no provisioner>\n")
 		}
 		for _, prov := range build.ProvisionerBlocks {
+			if prov.Parallel != nil {
+				fmt.Fprintf(out, "      %s:\n", prov.PType)
+				for _, prov := range prov.Parallel {
+					str := prov.PType
+					if prov.PName != "" {
+						str = strings.Join([]string{prov.PType, prov.PName}, ".")
+					}
+					fmt.Fprintf(out, "        %s\n", str)
+				}
+				continue
+			}
 			str := prov.PType
 			if prov.PName != "" {
 				str = strings.Join([]string{prov.PType, prov.PName}, ".")
@@ -818,7 +1234,9 @@ func (p *PackerConfig) handleEval(line string) (out string, exit bool, diags hcl
 		return "", false, diags
 	}
 
-	return PrintableCtyValue(val), false, diags
+	// values derived from sensitive values are redacted when printed
+	filterSensitiveValues(val)
+	return printableVariableValue(val), false, diags
 }
 
 func (p *PackerConfig) FixConfig(_ packer.FixConfigOptions) (diags hcl.Diagnostics) {
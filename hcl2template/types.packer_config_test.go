@@ -5,9 +5,11 @@ package hcl2template
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/hashicorp/go-version"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
@@ -665,3 +667,97 @@ func mustVersionConstraints(vs version.Constraints, err error) version.Constrain
 	}
 	return vs
 }
+
+func TestParser_ParsePaths(t *testing.T) {
+	t.Run("merge", func(t *testing.T) {
+		cfg, diags := getBasicParser().ParsePaths([]string{"testdata/merge/base", "testdata/merge/extra"}, nil, nil)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected parse error: %s", diags)
+		}
+		testInitialize(t, cfg, packer.InitializeOptions{})
+		builds := testGetBuilds(t, cfg, packer.GetBuildsOptions{})
+
+		// path.root is the directory of the file an expression is in.
+		want := map[string]string{
+			"null.base":       "testdata/merge/base",
+			"extra.null.base": "testdata/merge/extra testdata/merge/extra packer",
+		}
+		got := map[string]string{}
+		for _, b := range builds {
+			cb := b.(*packer.CoreBuild)
+			if len(cb.Provisioners) != 1 {
+				t.Fatalf("%s: expected 1 provisioner, got %d", cb.Name(), len(cb.Provisioners))
+			}
+			got[cb.Name()] = cb.Provisioners[0].HCLConfig.GetAttr("string").AsString()
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected provisioner strings: %s", diff)
+		}
+	})
+
+	t.Run("duplicate source", func(t *testing.T) {
+		cfg, diags := getBasicParser().ParsePaths([]string{"testdata/merge/base", "testdata/merge/duplicate"}, nil, nil)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected parse error: %s", diags)
+		}
+		diags = cfg.Initialize(packer.InitializeOptions{})
+		if !diags.HasErrors() {
+			t.Fatal("expected a duplicate source error")
+		}
+		if diags[0].Subject == nil || diags[0].Subject.Filename != filepath.Join("testdata/merge/duplicate", "duplicate.pkr.hcl") {
+			t.Errorf("expected the error to point at the duplicate block, got %#v", diags[0].Subject)
+		}
+		if !strings.Contains(diags[0].Detail, filepath.Join("testdata/merge/base", "build.pkr.hcl")) {
+			t.Errorf("expected the error to point at the first block, got %q", diags[0].Detail)
+		}
+	})
+}
+
+func TestParser_stdin(t *testing.T) {
+	t.Run("hcl", func(t *testing.T) {
+		parser := getBasicParser()
+		parser.Stdin = strings.NewReader(`
+locals {
+  root = path.root
+}
+`)
+		cfg, _ := testInitializeConfig(t, parser, "-", packer.InitializeOptions{})
+		if got := cfg.LocalVariables["root"].Value(); !got.RawEquals(cty.StringVal(".")) {
+			t.Errorf("expected path.root to be the current directory, got %#v", got)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		parser := getBasicParser()
+		parser.Stdin = strings.NewReader(`{"locals": {"root": "${path.root}"}}`)
+		cfg, _ := testInitializeConfig(t, parser, "-", packer.InitializeOptions{})
+		if got := cfg.LocalVariables["root"].Value(); !got.RawEquals(cty.StringVal(".")) {
+			t.Errorf("expected path.root to be the current directory, got %#v", got)
+		}
+	})
+
+	t.Run("diagnostics", func(t *testing.T) {
+		parser := getBasicParser()
+		parser.Stdin = strings.NewReader("locals {\n")
+		_, diags := parser.Parse("-", nil, nil)
+		if !diags.HasErrors() {
+			t.Fatal("expected a syntax error")
+		}
+		if diags[0].Subject == nil || diags[0].Subject.Filename != "<stdin>" {
+			t.Errorf("expected the error to reference <stdin>, got %#v", diags[0].Subject)
+		}
+	})
+}
+
+func TestParser_inputFiles(t *testing.T) {
+	cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/input_files", packer.InitializeOptions{})
+	builds := testGetBuilds(t, cfg, packer.GetBuildsOptions{})
+
+	want := []string{
+		filepath.Join("testdata", "input_files", "scripts", "one.sh"),
+		filepath.Join("testdata", "input_files", "scripts", "two.sh"),
+	}
+	if diff := cmp.Diff(want, builds[0].(*packer.CoreBuild).InputFiles); diff != "" {
+		t.Fatalf("unexpected input files: %s", diff)
+	}
+}
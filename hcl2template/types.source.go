@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/packer-plugin-sdk/didyoumean"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	hcl2shim "github.com/hashicorp/packer/hcl2template/shim"
 	"github.com/zclconf/go-cty/cty"
@@ -25,11 +27,25 @@ type SourceBlock struct {
 
 	block *hcl.Block
 
+	// body is the body of the block, without its extends attribute.
+	body hcl.Body
+	// extends is the extends attribute of the block, referencing the source
+	// it extends, if any.
+	extends *hcl.Attribute
+
 	// LocalName can be set in a singular source block from a build block, it
 	// allows to give a special name to a build in the logs.
 	LocalName string
 }
 
+const sourceExtendsAttr = "extends"
+
+var sourceSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: sourceExtendsAttr},
+	},
+}
+
 // SourceUseBlock is a SourceBlock 'usage' from a config stand point.
 // For example when one uses `build.sources = ["..."]` or
 // `build.source "..." {...}`.
@@ -37,6 +53,10 @@ type SourceUseBlock struct {
 	// reference to an actual source block definition, or SourceBlock.
 	SourceRef
 
+	// Module is set when the source is one of a module, referenced as
+	// `module.<module>.source.<type>.<name>`.
+	Module string
+
 	// LocalName can be set in a singular source block from a build block, it
 	// allows to give a special name to a build in the logs.
 	LocalName string
@@ -45,6 +65,12 @@ type SourceUseBlock struct {
 	// content
 	// Body can be expanded by a dynamic tag.
 	Body hcl.Body
+
+	// key is set on the instances of a source used with for_each or count,
+	// like `["eu-west-1"]` or `[0]`; it ends their name.
+	key string
+	// instanceVariables are the each or count variables of an instance.
+	instanceVariables map[string]cty.Value
 }
 
 func (b *SourceUseBlock) name() string {
@@ -55,7 +81,21 @@ func (b *SourceUseBlock) name() string {
 }
 
 func (b *SourceUseBlock) String() string {
-	return fmt.Sprintf("%s.%s", b.Type, b.name())
+	return fmt.Sprintf("%s.%s%s", b.Type, b.name(), b.key)
+}
+
+// skippedBy says whether o skips the source. An instance of a source used
+// with for_each or count is skipped by its own name, like
+// `amazon-ebs.ubuntu["eu-west-1"]`, or by the name of the source.
+func (b *SourceUseBlock) skippedBy(o *OnlyExcept) bool {
+	if b.key == "" {
+		return o.Skip(b.String())
+	}
+	sourceName := fmt.Sprintf("%s.%s", b.Type, b.name())
+	if len(o.Only) > 0 {
+		return o.Skip(b.String()) && o.Skip(sourceName)
+	}
+	return o.Skip(b.String()) || o.Skip(sourceName)
 }
 
 // EvalContext adds the values of the source to the passed eval context.
@@ -66,6 +106,18 @@ func (b *SourceUseBlock) ctyValues() map[string]cty.Value {
 	}
 }
 
+const (
+	buildSourceForEachAttr = "for_each"
+	buildSourceCountAttr   = "count"
+)
+
+var buildSourceSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: buildSourceForEachAttr},
+		{Name: buildSourceCountAttr},
+	},
+}
+
 // decodeBuildSource reads a used source block from a build:
 //
 //	build {
@@ -73,20 +125,142 @@ func (b *SourceUseBlock) ctyValues() map[string]cty.Value {
 //	    name = "local_name"
 //	  }
 //	}
-func (p *Parser) decodeBuildSource(block *hcl.Block) (SourceUseBlock, hcl.Diagnostics) {
-	ref := sourceRefFromString(block.Labels[0])
-	out := SourceUseBlock{SourceRef: ref}
+//
+// A source used with for_each or count is decoded into one instance per
+// element, each becoming a build of its own.
+func (p *Parser) decodeBuildSource(block *hcl.Block, ectx *hcl.EvalContext) ([]SourceUseBlock, hcl.Diagnostics) {
+	out := sourceUseFromString(block.Labels[0])
 	var b struct {
 		Name string   `hcl:"name,optional"`
 		Rest hcl.Body `hcl:",remain"`
 	}
 	diags := gohcl.DecodeBody(block.Body, nil, &b)
 	if diags.HasErrors() {
-		return out, diags
+		return nil, diags
 	}
 	out.LocalName = b.Name
-	out.Body = b.Rest
-	return out, nil
+
+	content, rest, diags := b.Rest.PartialContent(buildSourceSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	out.Body = rest
+
+	forEach, hasForEach := content.Attributes[buildSourceForEachAttr]
+	count, hasCount := content.Attributes[buildSourceCountAttr]
+	switch {
+	case hasForEach && hasCount:
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid combination of " + buildSourceForEachAttr + " and " + buildSourceCountAttr,
+			Detail: "The " + buildSourceForEachAttr + " and " + buildSourceCountAttr +
+				" arguments cannot be set together.",
+			Subject: count.NameRange.Ptr(),
+		})
+	case hasForEach:
+		return sourceForEachInstances(out, forEach, ectx)
+	case hasCount:
+		return sourceCountInstances(out, count, ectx)
+	}
+	return []SourceUseBlock{out}, diags
+}
+
+// sourceForEachInstances returns the instances of source, one per element
+// of its for_each map or set of strings, with each.key and each.value set.
+func sourceForEachInstances(source SourceUseBlock, attr *hcl.Attribute, ectx *hcl.EvalContext) ([]SourceUseBlock, hcl.Diagnostics) {
+	value, diags := attr.Expr.Value(ectx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	invalid := func(detail string) hcl.Diagnostics {
+		return append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + buildSourceForEachAttr + " argument",
+			Detail:   detail,
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+	}
+	if value.IsMarked() {
+		return nil, invalid("Sensitive values cannot be used in " + buildSourceForEachAttr +
+			", as they would be disclosed in the build names.")
+	}
+	if !value.IsWhollyKnown() {
+		return nil, invalid("The " + buildSourceForEachAttr + " value must be known " +
+			"before the builds start.")
+	}
+	if value.IsNull() {
+		return nil, invalid("The " + buildSourceForEachAttr + " value cannot be null.")
+	}
+
+	ty := value.Type()
+	isMap := ty.IsMapType() || ty.IsObjectType()
+	isSet := ty.IsSetType() || ty.IsListType() || ty.IsTupleType()
+	if !isMap && !isSet {
+		return nil, invalid(fmt.Sprintf("The %s value must be a map, or a set of "+
+			"strings, and you have provided a value of type %s.",
+			buildSourceForEachAttr, ty.FriendlyName()))
+	}
+
+	var instances []SourceUseBlock
+	seen := map[string]bool{}
+	for it := value.ElementIterator(); it.Next(); {
+		k, v := it.Element()
+		if isSet {
+			if v.IsNull() || v.Type() != cty.String {
+				return nil, invalid("The elements of a " + buildSourceForEachAttr +
+					" list or set must be strings.")
+			}
+			k = v
+		}
+		key := k.AsString()
+		if seen[key] {
+			return nil, invalid(fmt.Sprintf("The %s value holds %q more than once.",
+				buildSourceForEachAttr, key))
+		}
+		seen[key] = true
+
+		instance := source
+		instance.key = fmt.Sprintf("[%q]", key)
+		instance.instanceVariables = map[string]cty.Value{
+			eachAccessor: cty.ObjectVal(map[string]cty.Value{
+				"key":   k,
+				"value": v,
+			}),
+		}
+		instances = append(instances, instance)
+	}
+	return instances, diags
+}
+
+// sourceCountInstances returns the count instances of source, with
+// count.index set.
+func sourceCountInstances(source SourceUseBlock, attr *hcl.Attribute, ectx *hcl.EvalContext) ([]SourceUseBlock, hcl.Diagnostics) {
+	var count int
+	diags := gohcl.DecodeExpression(attr.Expr, unmarkedEvalContext(ectx), &count)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if count < 0 {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + buildSourceCountAttr + " argument",
+			Detail:   "The " + buildSourceCountAttr + " value cannot be negative.",
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+	}
+
+	instances := make([]SourceUseBlock, 0, count)
+	for i := 0; i < count; i++ {
+		instance := source
+		instance.key = fmt.Sprintf("[%d]", i)
+		instance.instanceVariables = map[string]cty.Value{
+			countAccessor: cty.ObjectVal(map[string]cty.Value{
+				"index": cty.NumberIntVal(int64(i)),
+			}),
+		}
+		instances = append(instances, instance)
+	}
+	return instances, diags
 }
 
 func (p *Parser) decodeSource(block *hcl.Block) (SourceBlock, hcl.Diagnostics) {
@@ -95,11 +269,97 @@ func (p *Parser) decodeSource(block *hcl.Block) (SourceBlock, hcl.Diagnostics) {
 		Name:  block.Labels[1],
 		block: block,
 	}
-	var diags hcl.Diagnostics
+
+	content, body, diags := block.Body.PartialContent(sourceSchema)
+	source.body = body
+	source.extends = content.Attributes[sourceExtendsAttr]
 
 	return source, diags
 }
 
+// sourceBody returns the body of source, deep-merged over the body of the
+// source it extends, if any: the attributes it sets replace the ones of the
+// extended source, and a nested block set once in both is merged the same
+// way.
+func (cfg *PackerConfig) sourceBody(source SourceBlock) (hcl.Body, hcl.Diagnostics) {
+	return cfg.extendSourceBody(source, nil)
+}
+
+func (cfg *PackerConfig) extendSourceBody(source SourceBlock, extending []SourceRef) (hcl.Body, hcl.Diagnostics) {
+	if source.extends == nil {
+		return source.body, nil
+	}
+	attr := source.extends
+
+	var ref SourceRef
+	traversal, diags := hcl.AbsTraversalForExpr(attr.Expr)
+	if !diags.HasErrors() && traversal.RootName() == sourceLabel && len(traversal) == 3 {
+		typ, typOk := traversal[1].(hcl.TraverseAttr)
+		name, nameOk := traversal[2].(hcl.TraverseAttr)
+		if typOk && nameOk {
+			ref = SourceRef{Type: typ.Name, Name: name.Name}
+		}
+	}
+	if ref == NoSource {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + sourceExtendsAttr + " reference",
+			Detail: "A " + sourceLabel + " can only extend another " + sourceLabel +
+				", referenced like `" + sourceLabel + ".amazon-ebs.base`.",
+			Subject: attr.Expr.Range().Ptr(),
+		}}
+	}
+	if ref.Type != source.Type {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + sourceExtendsAttr + " reference",
+			Detail: fmt.Sprintf("The %s %s cannot extend %s: a %s can only "+
+				"extend a %s of the same type.", sourceLabel, source.Ref(), ref,
+				sourceLabel, sourceLabel),
+			Subject: attr.Expr.Range().Ptr(),
+		}}
+	}
+
+	extending = append(extending, source.Ref())
+	for i, r := range extending {
+		if r != ref {
+			continue
+		}
+		var cycle []string
+		for _, r := range extending[i:] {
+			cycle = append(cycle, r.String())
+		}
+		cycle = append(cycle, ref.String())
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Source " + sourceExtendsAttr + " cycle",
+			Detail:   "The sources extend each other: " + strings.Join(cycle, " -> ") + ".",
+			Subject:  attr.Expr.Range().Ptr(),
+		}}
+	}
+
+	parent, found := cfg.Sources[ref]
+	if !found {
+		availableSrcs := listAvailableSourceNames(cfg.Sources)
+		detail := fmt.Sprintf("Known: %v", availableSrcs)
+		if sugg := didyoumean.NameSuggestion(ref.String(), availableSrcs); sugg != "" {
+			detail = fmt.Sprintf("Did you mean to use %q?", sugg)
+		}
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Unknown " + sourceLabel + " " + ref.String(),
+			Detail:   detail,
+			Subject:  attr.Expr.Range().Ptr(),
+		}}
+	}
+
+	base, diags := cfg.extendSourceBody(parent, extending)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return &overrideBody{base: base, override: source.body, mergeBlocks: true}, diags
+}
+
 func (cfg *PackerConfig) startBuilder(source SourceUseBlock, ectx *hcl.EvalContext) (packersdk.Builder, hcl.Diagnostics, []string) {
 	var diags hcl.Diagnostics
 
@@ -141,7 +401,8 @@ func (cfg *PackerConfig) startBuilder(source SourceUseBlock, ectx *hcl.EvalConte
 	builderVars["packer_on_error"] = cfg.onError
 
 	generatedVars, warning, err := builder.Prepare(builderVars, decoded)
-	moreDiags = warningErrorsToDiags(cfg.Sources[source.SourceRef].block, warning, err)
+	src, _ := cfg.sourceBlock(source)
+	moreDiags = warningErrorsToDiags(src.block, warning, err)
 	diags = append(diags, moreDiags...)
 	return builder, diags, generatedVars
 }
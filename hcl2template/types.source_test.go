@@ -5,11 +5,14 @@ package hcl2template
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/hashicorp/hcl/v2"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer/builder/null"
 	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
 )
 
 func TestParse_source(t *testing.T) {
@@ -56,6 +59,7 @@ func TestParse_source(t *testing.T) {
 				&packer.CoreBuild{
 					Type:           "null.test",
 					Builder:        &null.Builder{},
+					Resumable:      true,
 					Provisioners:   []packer.CoreBuildProvisioner{},
 					PostProcessors: [][]packer.CoreBuildPostProcessor{},
 					Prepared:       true,
@@ -146,3 +150,74 @@ func TestParse_source(t *testing.T) {
 	}
 	testParse(t, tests)
 }
+
+func TestParse_source_extends(t *testing.T) {
+	cfg, _ := testInitializeConfig(t, getBasicParser(), "testdata/sources/extends.pkr.hcl", packer.InitializeOptions{})
+	builds := testGetBuilds(t, cfg, packer.GetBuildsOptions{})
+	if len(builds) != 2 {
+		t.Fatalf("expected 2 builds, got %d", len(builds))
+	}
+
+	tests := []struct {
+		build     string
+		str       string
+		num       int64
+		nestedStr string
+		nestedNum int64
+	}{
+		{"amazon-ebs.child", "child", 42, "nested base", 2},
+		{"amazon-ebs.grandchild", "child", 43, "nested base", 2},
+	}
+	for i, tt := range tests {
+		cb := builds[i].(*packer.CoreBuild)
+		if cb.Type != tt.build {
+			t.Fatalf("expected build %q, got %q", tt.build, cb.Type)
+		}
+		nested := cb.HCLConfig.GetAttr("nested")
+		got := map[string]cty.Value{
+			"string":        cb.HCLConfig.GetAttr("string"),
+			"int":           cb.HCLConfig.GetAttr("int"),
+			"nested.string": nested.GetAttr("string"),
+			"nested.int":    nested.GetAttr("int"),
+		}
+		want := map[string]cty.Value{
+			"string":        cty.StringVal(tt.str),
+			"int":           cty.NumberIntVal(tt.num),
+			"nested.string": cty.StringVal(tt.nestedStr),
+			"nested.int":    cty.NumberIntVal(tt.nestedNum),
+		}
+		for name := range want {
+			if !got[name].RawEquals(want[name]) {
+				t.Errorf("%s: expected %s to be %#v, got %#v", tt.build, name, want[name], got[name])
+			}
+		}
+	}
+}
+
+func TestParse_source_extends_errors(t *testing.T) {
+	tests := []struct {
+		file      string
+		summary   string
+		subjectAt hcl.Pos
+	}{
+		{"extends_cycle.pkr.hcl", "Source extends cycle", hcl.Pos{Line: 6, Column: 13}},
+		{"extends_invalid_value.pkr.hcl", "Incorrect attribute value type", hcl.Pos{Line: 7, Column: 13}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			cfg := testParseConfig(t, getBasicParser(), filepath.Join("testdata/sources", tt.file))
+			diags := cfg.Initialize(packer.InitializeOptions{})
+			if !diags.HasErrors() {
+				_, diags = cfg.GetBuilds(packer.GetBuildsOptions{})
+			}
+			if !strings.Contains(diags.Error(), tt.summary) {
+				t.Fatalf("expected a %q error, got %s", tt.summary, diags)
+			}
+			if subject := diags[0].Subject; subject == nil ||
+				subject.Start.Line != tt.subjectAt.Line || subject.Start.Column != tt.subjectAt.Column {
+				t.Errorf("expected the error to point at %d:%d, got %#v",
+					tt.subjectAt.Line, tt.subjectAt.Column, subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,443 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	hcl2TestFileExt     = ".pkrtest.hcl"
+	hcl2TestJsonFileExt = ".pkrtest.json"
+
+	// testsDir is the sub-directory of a configuration where test files are
+	// looked up too.
+	testsDir = "tests"
+
+	runLabel          = "run"
+	runVariablesLabel = "variables"
+)
+
+// Commands of run blocks.
+const (
+	// RunCommandPlan resolves the builds of the configuration, starting and
+	// configuring their builders without running them.
+	RunCommandPlan = "plan"
+	// RunCommandBuild runs the builds of the configuration.
+	RunCommandBuild = "build"
+)
+
+var testFileSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: runLabel, LabelNames: []string{"name"}},
+		{Type: mockDataLabel, LabelNames: []string{"type", "name"}},
+		{Type: mockSourceLabel, LabelNames: []string{"type", "name"}},
+	},
+}
+
+var runBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "command"},
+		{Name: "only"},
+		{Name: "except"},
+		{Name: "skip_datasources"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: runVariablesLabel},
+		{Type: checkAssertLabel},
+		{Type: mockDataLabel, LabelNames: []string{"type", "name"}},
+		{Type: mockSourceLabel, LabelNames: []string{"type", "name"}},
+	},
+}
+
+// TestFile is a .pkrtest.hcl file, testing the configuration of its
+// directory with run blocks.
+type TestFile struct {
+	Filename string
+
+	// MockData are the data sources mocked for all the runs of the file.
+	MockData MockData
+	// MockSources are the sources mocked for all the runs of the file.
+	MockSources MockSources
+
+	Runs []*RunBlock
+}
+
+// RunBlock references an HCL 'run' block of a test file. A run evaluates the
+// configuration with its variables, resolves the builds it selects, runs them
+// when its command is build, and then checks its assertions:
+//
+//	run "defaults" {
+//	  command = "plan"
+//
+//	  variables {
+//	    image_name = "test"
+//	  }
+//
+//	  assert {
+//	    condition     = builds["null.example"].config.communicator == "none"
+//	    error_message = "The example build must not connect to the instance."
+//	  }
+//	}
+type RunBlock struct {
+	// Name of the run
+	Name string
+	// Command is either RunCommandPlan, the default, or RunCommandBuild.
+	Command string
+
+	// Variables is the body of the variables block of the run, setting input
+	// variables like a var file; nil when the run has no variables block.
+	Variables hcl.Body
+
+	// Only and Except select the builds of the run, like the -only and
+	// -except options.
+	Only, Except []string
+
+	// When SkipDatasources is set the data sources are not executed, the
+	// outputs of the ones that are not mocked by MockData are unknown.
+	SkipDatasources bool
+
+	// MockData are the data sources mocked for the run, with the mocks of
+	// the test file; the mocks of the run replace the ones of the file.
+	MockData MockData
+	// MockSources are the sources mocked for the run, with the mocks of the
+	// test file; the mocks of the run replace the ones of the file.
+	MockSources MockSources
+
+	// Asserts are the assertions of the run, all must be true.
+	Asserts []*CheckAssertion
+
+	Range hcl.Range
+}
+
+// VarFile returns a var file setting the variables of the run.
+func (run *RunBlock) VarFile() *hcl.File {
+	if run.Variables == nil {
+		return nil
+	}
+	return &hcl.File{Body: run.Variables}
+}
+
+// ParseTestFiles parses the test files of the configuration at path: the
+// .pkrtest.hcl files of its directory and of its tests sub-directory.
+func (p *Parser) ParseTestFiles(path string) ([]*TestFile, hcl.Diagnostics) {
+	dir := path
+	if isDir, err := isDir(path); err == nil && !isDir {
+		dir = filepath.Dir(path)
+	}
+
+	var diags hcl.Diagnostics
+	var files []*TestFile
+	for _, testDir := range []string{dir, filepath.Join(dir, testsDir)} {
+		if _, err := os.Stat(testDir); os.IsNotExist(err) {
+			continue
+		}
+		hclFiles, jsonFiles, moreDiags := GetHCL2Files(testDir, hcl2TestFileExt, hcl2TestJsonFileExt)
+		diags = append(diags, moreDiags...)
+		for _, filename := range append(hclFiles, jsonFiles...) {
+			var f *hcl.File
+			if filepath.Ext(filename) == ".json" {
+				f, moreDiags = p.ParseJSONFile(filename)
+			} else {
+				f, moreDiags = p.ParseHCLFile(filename)
+			}
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+			file, moreDiags := decodeTestFile(filename, f)
+			diags = append(diags, moreDiags...)
+			if file != nil {
+				files = append(files, file)
+			}
+		}
+	}
+	return files, diags
+}
+
+func decodeTestFile(filename string, f *hcl.File) (*TestFile, hcl.Diagnostics) {
+	content, diags := f.Body.Content(testFileSchema)
+	file := &TestFile{Filename: filename}
+
+	// the outputs of mocks can be read from files next to the test file.
+	ectx := &hcl.EvalContext{
+		Functions: Functions(filepath.Dir(filename)),
+	}
+	mocks, moreDiags := decodeMockDataBlocks(content.Blocks, ectx)
+	diags = append(diags, moreDiags...)
+	file.MockData = mocks
+	sourceMocks, moreDiags := decodeMockSourceBlocks(content.Blocks, ectx)
+	diags = append(diags, moreDiags...)
+	file.MockSources = sourceMocks
+
+	for _, block := range content.Blocks {
+		if block.Type != runLabel {
+			continue
+		}
+		run, moreDiags := decodeRunBlock(block, ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		for _, other := range file.Runs {
+			if other.Name == run.Name {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate " + runLabel + " block",
+					Detail: fmt.Sprintf("This run block has the same name as one "+
+						"previously declared at %s. Each run must have a unique name.",
+						other.Range),
+					Subject: block.DefRange.Ptr(),
+				})
+			}
+		}
+		run.MockData = file.MockData.merge(run.MockData)
+		run.MockSources = file.MockSources.merge(run.MockSources)
+		file.Runs = append(file.Runs, run)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return file, diags
+}
+
+func decodeRunBlock(block *hcl.Block, ectx *hcl.EvalContext) (*RunBlock, hcl.Diagnostics) {
+	run := &RunBlock{
+		Name:    block.Labels[0],
+		Command: RunCommandPlan,
+		Range:   block.DefRange,
+	}
+
+	content, diags := block.Body.Content(runBlockSchema)
+	if !hclsyntax.ValidIdentifier(run.Name) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + runLabel + " name",
+			Detail:   badIdentifierDetail,
+			Subject:  &block.LabelRanges[0],
+		})
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	if attr, exists := content.Attributes["command"]; exists {
+		diags = append(diags, gohcl.DecodeExpression(attr.Expr, nil, &run.Command)...)
+		if run.Command != RunCommandPlan && run.Command != RunCommandBuild {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid run command",
+				Detail: fmt.Sprintf("The command of a run must be either %q or %q.",
+					RunCommandPlan, RunCommandBuild),
+				Subject: attr.Expr.Range().Ptr(),
+			})
+		}
+	}
+	if attr, exists := content.Attributes["only"]; exists {
+		diags = append(diags, gohcl.DecodeExpression(attr.Expr, nil, &run.Only)...)
+	}
+	if attr, exists := content.Attributes["except"]; exists {
+		diags = append(diags, gohcl.DecodeExpression(attr.Expr, nil, &run.Except)...)
+	}
+	if attr, exists := content.Attributes["skip_datasources"]; exists {
+		diags = append(diags, gohcl.DecodeExpression(attr.Expr, nil, &run.SkipDatasources)...)
+	}
+
+	mocks, moreDiags := decodeMockDataBlocks(content.Blocks, ectx)
+	diags = append(diags, moreDiags...)
+	run.MockData = mocks
+	sourceMocks, moreDiags := decodeMockSourceBlocks(content.Blocks, ectx)
+	diags = append(diags, moreDiags...)
+	run.MockSources = sourceMocks
+
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case runVariablesLabel:
+			if run.Variables != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate " + runVariablesLabel + " block",
+					Detail:   "A run can only have one " + runVariablesLabel + " block.",
+					Subject:  block.DefRange.Ptr(),
+				})
+				continue
+			}
+			run.Variables = block.Body
+		case checkAssertLabel:
+			assertion := &CheckAssertion{
+				DeclRange: block.DefRange,
+			}
+			assertContent, moreDiags := block.Body.Content(checkAssertBlockSchema)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+			assertion.Condition = assertContent.Attributes["condition"].Expr
+			assertion.ErrorMessage, moreDiags = decodeValidationErrorMessage(assertContent.Attributes["error_message"])
+			diags = append(diags, moreDiags...)
+			run.Asserts = append(run.Asserts, assertion)
+		}
+	}
+
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return run, diags
+}
+
+// ParseRun parses the configuration at path, with the variables of run set
+// after the ones of varFiles. Values set with the var sources of the parser
+// and with argVars have precedence over the variables of the run. The data
+// source mocks of the run replace the ones of the mock files of the parser,
+// and the builders of the sources it mocks are replaced.
+func (p *Parser) ParseRun(path string, run *RunBlock, varFiles []string, argVars map[string]string) (*PackerConfig, hcl.Diagnostics) {
+	var runVarFiles []*hcl.File
+	if f := run.VarFile(); f != nil {
+		runVarFiles = append(runVarFiles, f)
+	}
+	cfg, diags := p.parse([]string{path}, varFiles, runVarFiles, p.VarSources, argVars, os.Environ())
+	if cfg != nil {
+		cfg.mockSources = run.MockSources
+	}
+	return cfg, append(diags, p.setMockData(cfg, run.MockData)...)
+}
+
+// EvaluateRunAssertions evaluates the assertions of run, once the builds it
+// selected are resolved and, for build runs, completed with artifacts, by
+// build name.
+//
+// On top of input variables, locals and data sources, assertions can access
+// the builds of the run with the `builds` accessor.
+func (cfg *PackerConfig) EvaluateRunAssertions(run *RunBlock, builds []packersdk.Build, artifacts map[string][]packersdk.Artifact) hcl.Diagnostics {
+	buildsValue, err := runBuildsValue(builds, artifacts)
+	if err != nil {
+		return hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read the builds of the run",
+			Detail:   err.Error(),
+			Subject:  run.Range.Ptr(),
+		}}
+	}
+	ectx := cfg.EvalContext(BuildContext, map[string]cty.Value{
+		buildsAccessor: buildsValue,
+	})
+
+	var diags hcl.Diagnostics
+	for _, assertion := range run.Asserts {
+		result, moreDiags := assertion.evaluate(ectx)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+
+		if !result.IsKnown() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unknown assertion result",
+				Detail: "The condition of the assertion depends on values that " +
+					"are not known, like the outputs of mocked data sources, " +
+					"or the artifacts of builds that did not run.",
+				Subject: assertion.Condition.Range().Ptr(),
+			})
+			continue
+		}
+		if result.False() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Assertion of run %q failed", run.Name),
+				Detail: fmt.Sprintf("%s\n\nThis was checked by the assertion at %s.",
+					assertion.ErrorMessage, assertion.DeclRange.String()),
+				Subject: assertion.Condition.Range().Ptr(),
+			})
+		}
+	}
+	return diags
+}
+
+// runBuildsValue returns the value of the `builds` accessor of the
+// assertions of runs: an object with an attribute per build, named after the
+// build. Each build has its builder type, the resolved configuration of its
+// builder, provisioners and post-processors, and, once it ran, its artifacts
+// like in outputs.
+func runBuildsValue(builds []packersdk.Build, artifacts map[string][]packersdk.Artifact) (cty.Value, error) {
+	artifactValues, err := buildArtifactsValue(artifacts)
+	if err != nil {
+		return cty.NilVal, err
+	}
+
+	res := map[string]cty.Value{}
+	for _, b := range builds {
+		cb, ok := b.(*packer.CoreBuild)
+		if !ok {
+			continue
+		}
+		plan := cb.Plan()
+
+		var provisioners []cty.Value
+		for _, p := range plan.Provisioners {
+			provisioners = append(provisioners, pluginPlanValue(p.Type, p.Name, p.Config))
+		}
+		var postProcessors []cty.Value
+		for _, ppSeq := range plan.PostProcessors {
+			var seq []cty.Value
+			for _, pp := range ppSeq {
+				seq = append(seq, pluginPlanValue(pp.Type, pp.Name, pp.Config))
+			}
+			postProcessors = append(postProcessors, tupleVal(seq))
+		}
+
+		attrs := map[string]cty.Value{
+			"type":            cty.StringVal(plan.BuilderType),
+			"config":          planConfigValue(plan.Config),
+			"provisioners":    tupleVal(provisioners),
+			"post_processors": tupleVal(postProcessors),
+			"artifact_id":     cty.NullVal(cty.String),
+			"generated_data":  cty.EmptyObjectVal,
+			"artifacts":       cty.EmptyTupleVal,
+		}
+		if artifactValues.Type().HasAttribute(plan.Name) {
+			for name, value := range artifactValues.GetAttr(plan.Name).AsValueMap() {
+				attrs[name] = value
+			}
+		}
+		res[plan.Name] = cty.ObjectVal(attrs)
+	}
+	return cty.ObjectVal(res), nil
+}
+
+// pluginPlanValue returns the value describing a provisioner or a
+// post-processor of a build.
+func pluginPlanValue(pType, pName string, config cty.Value) cty.Value {
+	if pName == "" {
+		pName = pType
+	}
+	return cty.ObjectVal(map[string]cty.Value{
+		"type":   cty.StringVal(pType),
+		"name":   cty.StringVal(pName),
+		"config": planConfigValue(config),
+	})
+}
+
+func planConfigValue(config cty.Value) cty.Value {
+	if config == cty.NilVal {
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+	return config
+}
+
+func tupleVal(values []cty.Value) cty.Value {
+	if len(values) == 0 {
+		return cty.EmptyTupleVal
+	}
+	return cty.TupleVal(values)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestParser_ParseTestFiles(t *testing.T) {
+	const dir = "testdata/test_files/basic"
+	parser := getBasicParser()
+	files, diags := parser.ParseTestFiles(dir)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected parse error: %s", diags)
+	}
+	if len(files) != 1 || files[0].Filename != filepath.Join(dir, "tests", "config.pkrtest.hcl") {
+		t.Fatalf("expected the test file of the tests directory, got %v", files)
+	}
+
+	runs := files[0].Runs
+	if len(runs) != 5 {
+		t.Fatalf("expected 5 runs, got %d", len(runs))
+	}
+	if runs[1].Command != RunCommandPlan || len(runs[1].Only) != 1 || runs[1].Variables == nil {
+		t.Errorf("unexpected named run: %#v", runs[1])
+	}
+	if !runs[2].SkipDatasources {
+		t.Errorf("expected the datasources of the skip_datasources run to be skipped")
+	}
+	if len(runs[3].MockData) != 1 {
+		t.Errorf("expected the data source of the mocked_data run to be mocked")
+	}
+	if runs[4].Command != RunCommandBuild || len(runs[4].MockSources) != 1 {
+		t.Errorf("unexpected mocked_source run: %#v", runs[4])
+	}
+
+	for _, tc := range []struct {
+		run     *RunBlock
+		failure string
+	}{
+		{run: runs[0]},
+		{run: runs[1], failure: `Assertion of run "named" failed`},
+		{run: runs[2]},
+		{run: runs[3]},
+	} {
+		t.Run(tc.run.Name, func(t *testing.T) {
+			cfg, diags := parser.ParseRun(dir, tc.run, nil, nil)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected parse error: %s", diags)
+			}
+			testInitialize(t, cfg, packer.InitializeOptions{
+				SkipDatasourcesExecution: tc.run.SkipDatasources,
+			})
+			builds := testGetBuilds(t, cfg, packer.GetBuildsOptions{
+				Only:   tc.run.Only,
+				Except: tc.run.Except,
+			})
+
+			diags = cfg.EvaluateRunAssertions(tc.run, builds, nil)
+			if tc.failure == "" && diags.HasErrors() {
+				t.Fatalf("unexpected assertion failure: %s", diags)
+			}
+			if tc.failure != "" && !strings.Contains(diags.Error(), tc.failure) {
+				t.Fatalf("expected %q, got %s", tc.failure, diags)
+			}
+		})
+	}
+}
+
+func TestParser_ParseRun_mock_source(t *testing.T) {
+	const dir = "testdata/test_files/basic"
+	parser := getBasicParser()
+	files, diags := parser.ParseTestFiles(dir)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected parse error: %s", diags)
+	}
+	run := files[0].Runs[4]
+
+	cfg, diags := parser.ParseRun(dir, run, nil, nil)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected parse error: %s", diags)
+	}
+	testInitialize(t, cfg, packer.InitializeOptions{})
+	builds := testGetBuilds(t, cfg, packer.GetBuildsOptions{})
+
+	cb := builds[0].(*packer.CoreBuild)
+	if _, ok := cb.Builder.(*mockSourceBuilder); !ok {
+		t.Fatalf("expected the builder of the source to be mocked, got %T", cb.Builder)
+	}
+	artifact, err := cb.Builder.Run(context.Background(), packersdk.TestUi(t), nil)
+	if err != nil {
+		t.Fatalf("unexpected error running the mocked builder: %s", err)
+	}
+	if artifact.BuilderId() != MockSourceBuilderId || artifact.Id() != "vm-mocked" {
+		t.Fatalf("expected the mocked artifact, got %s", artifact)
+	}
+
+	diags = cfg.EvaluateRunAssertions(run, builds, map[string][]packersdk.Artifact{
+		cb.Name(): {artifact},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected assertion failure: %s", diags)
+	}
+}
+
+func TestParser_ParseTestFiles_invalid(t *testing.T) {
+	_, diags := getBasicParser().ParseTestFiles("testdata/test_files/invalid")
+	var summaries []string
+	for _, diag := range diags {
+		summaries = append(summaries, diag.Summary)
+	}
+	for _, expected := range []string{
+		"Invalid run command",
+		"Duplicate run block",
+	} {
+		if !strings.Contains(strings.Join(summaries, "\n"), expected) {
+			t.Errorf("expected %q, got %s", expected, diags)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package hcl2template
 import (
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"unicode"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/hashicorp/hcl/v2/ext/typeexpr"
 	"github.com/hashicorp/hcl/v2/gohcl"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer/hcl2template/addrs"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/convert"
@@ -36,7 +38,8 @@ type LocalBlock struct {
 // setting it and the value of that expression. It helps pinpoint were
 // something was set in diagnostics.
 type VariableAssignment struct {
-	// From tells were it was taken from, command/varfile/env/default
+	// From tells were it was taken from, command/varfile/env/default, or
+	// "var-source kind:path" for a variable source
 	From  string
 	Value cty.Value
 	Expr  hcl.Expression
@@ -69,6 +72,16 @@ type Variable struct {
 	// When Sensitive is set to true Packer will try it best to hide/obfuscate
 	// the variable from the output stream. By replacing the text.
 	Sensitive bool
+	// When Nullable is false the variable cannot be set to null. Variables are
+	// nullable when it is unset.
+	Nullable config.Trilean
+	// When Deprecated is set, a warning telling it is emitted whenever a value
+	// is supplied for the variable.
+	Deprecated string
+	// When Ephemeral is set to true the value of the variable, and the values
+	// derived from it, cannot be persisted: in manifests, HCP Packer metadata,
+	// output files or the output of `packer inspect`.
+	Ephemeral bool
 
 	Range hcl.Range
 }
@@ -83,28 +96,34 @@ func (v *Variable) GoString() string {
 	return b.String()
 }
 
-// validateValue ensures that all of the configured custom validations for a
-// variable value are passing.
-func (v *Variable) validateValue(val VariableAssignment) (diags hcl.Diagnostics) {
-	if len(v.Validations) == 0 {
+// validateValue ensures that all of the given custom validations for a
+// variable value are passing. Conditions are evaluated in hclCtx, which holds
+// the input variables and locals of the configuration, or in a context only
+// holding the variable when hclCtx is nil.
+func (v *Variable) validateValue(val VariableAssignment, validations []*VariableValidation, hclCtx *hcl.EvalContext) (diags hcl.Diagnostics) {
+	if len(validations) == 0 {
 		log.Printf("[TRACE] validateValue: not active for %s, so skipping", v.Name)
 		return nil
 	}
 
-	hclCtx := &hcl.EvalContext{
-		Variables: map[string]cty.Value{
-			"var": cty.ObjectVal(map[string]cty.Value{
-				v.Name: val.Value,
-			}),
-		},
-		Functions: Functions(""),
+	if hclCtx == nil {
+		hclCtx = &hcl.EvalContext{
+			Variables: map[string]cty.Value{
+				"var": cty.ObjectVal(map[string]cty.Value{
+					v.Name: val.Value,
+				}),
+			},
+			Functions: Functions(""),
+		}
 	}
 
-	for _, validation := range v.Validations {
+	for _, validation := range validations {
 		const errInvalidCondition = "Invalid variable validation result"
 
 		result, moreDiags := validation.Condition.Value(hclCtx)
 		diags = append(diags, moreDiags...)
+		// the condition can be derived from sensitive values
+		result, _ = result.Unmark()
 		if moreDiags.HasErrors() {
 			log.Printf("[TRACE] evalVariableValidations: %s rule %s condition expression failed: %s", v.Name, validation.DeclRange, moreDiags.Error())
 		}
@@ -166,18 +185,64 @@ func (v *Variable) Value() cty.Value {
 // ValidateValue tells if the selected value for the Variable is valid according
 // to its validation settings.
 func (v *Variable) ValidateValue() hcl.Diagnostics {
+	return v.validateValueWith(nil, v.Validations)
+}
+
+// validateValueWith tells if the selected value for the Variable is valid,
+// checking the given validation rules in hclCtx.
+func (v *Variable) validateValueWith(hclCtx *hcl.EvalContext, validations []*VariableValidation) hcl.Diagnostics {
+	diags := v.deprecationWarnings()
 	if len(v.Values) == 0 {
-		return hcl.Diagnostics{&hcl.Diagnostic{
+		return append(diags, &hcl.Diagnostic{
 			Severity: hcl.DiagError,
 			Summary:  fmt.Sprintf("Unset variable %q", v.Name),
 			Detail: "A used variable must be set or have a default value; see " +
 				"https://packer.io/docs/templates/hcl_templates/syntax for " +
 				"details.",
 			Context: v.Range.Ptr(),
-		}}
+		})
 	}
 
-	return v.validateValue(v.Values[len(v.Values)-1])
+	val := v.Values[len(v.Values)-1]
+	if v.Nullable.False() && val.Value.IsNull() {
+		subj := v.Range.Ptr()
+		if val.From != "default" && val.Expr != nil {
+			subj = val.Expr.Range().Ptr()
+		}
+		return append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid null value for variable %q", v.Name),
+			Detail:   "This variable is not nullable: it must be set to a non-null value.",
+			Subject:  subj,
+		})
+	}
+
+	return append(diags, v.validateValue(val, validations, hclCtx)...)
+}
+
+// deprecationWarnings returns a warning for every value supplied for a
+// deprecated variable.
+func (v *Variable) deprecationWarnings() hcl.Diagnostics {
+	if v.Deprecated == "" {
+		return nil
+	}
+	var diags hcl.Diagnostics
+	for _, val := range v.Values {
+		if val.From == "default" {
+			continue
+		}
+		diag := &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  fmt.Sprintf("Deprecated variable %q", v.Name),
+			Detail: fmt.Sprintf("A value for the deprecated variable %q was set from %s: %s",
+				v.Name, val.From, v.Deprecated),
+		}
+		if val.Expr != nil && val.Expr.Range().Filename != "" {
+			diag.Subject = val.Expr.Range().Ptr()
+		}
+		diags = append(diags, diag)
+	}
+	return diags
 }
 
 type Variables map[string]*Variable
@@ -190,23 +255,63 @@ func (variables Variables) Keys() []string {
 	return keys
 }
 
+// Values returns the values of variables, by name. The values of sensitive
+// and ephemeral variables are marked as such.
 func (variables Variables) Values() map[string]cty.Value {
 	res := map[string]cty.Value{}
 	for k, v := range variables {
 		value := v.Value()
+		if v.Sensitive {
+			value = markSensitive(value)
+		}
+		if v.Ephemeral {
+			value = markEphemeral(value)
+		}
 		res[k] = value
 	}
 	return res
 }
 
-func (variables Variables) ValidateValues() hcl.Diagnostics {
+// validateInputVariables validates the values of the input variables, with
+// their validation rules evaluated with all the input variables and locals.
+// Rules referencing locals can only be checked once locals are evaluated: they
+// are checked when withLocals is true, and the other rules when it is false.
+func (cfg *PackerConfig) validateInputVariables(withLocals bool) hcl.Diagnostics {
 	var diags hcl.Diagnostics
-	for _, v := range variables {
-		diags = append(diags, v.ValidateValue()...)
+	hclCtx := cfg.EvalContext(InputVariableContext, nil)
+
+	names := cfg.InputVariables.Keys()
+	sort.Strings(names)
+	for _, name := range names {
+		v := cfg.InputVariables[name]
+		var validations []*VariableValidation
+		for _, validation := range v.Validations {
+			if referencesLocals(validation.Condition) == withLocals {
+				validations = append(validations, validation)
+			}
+		}
+
+		if !withLocals {
+			diags = append(diags, v.validateValueWith(hclCtx, validations)...)
+			continue
+		}
+		if len(v.Values) > 0 {
+			diags = append(diags, v.validateValue(v.Values[len(v.Values)-1], validations, hclCtx)...)
+		}
 	}
 	return diags
 }
 
+// referencesLocals tells if expr references locals.
+func referencesLocals(expr hcl.Expression) bool {
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() == localsAccessor {
+			return true
+		}
+	}
+	return false
+}
+
 // decodeVariable decodes a variable key and value into Variables
 func (variables *Variables) decodeVariable(key string, attr *hcl.Attribute, ectx *hcl.EvalContext) hcl.Diagnostics {
 	var diags hcl.Diagnostics
@@ -215,12 +320,13 @@ func (variables *Variables) decodeVariable(key string, attr *hcl.Attribute, ectx
 		(*variables) = Variables{}
 	}
 
-	if _, found := (*variables)[key]; found {
+	if existing, found := (*variables)[key]; found {
 		diags = append(diags, &hcl.Diagnostic{
 			Severity: hcl.DiagError,
 			Summary:  "Duplicate variable",
-			Detail:   "Duplicate " + key + " variable definition found.",
-			Subject:  attr.NameRange.Ptr(),
+			Detail: fmt.Sprintf("Duplicate %s variable definition found, "+
+				"it was previously defined at %s.", key, existing.Range.Ptr()),
+			Subject: attr.NameRange.Ptr(),
 		})
 		return diags
 	}
@@ -259,6 +365,15 @@ var variableBlockSchema = &hcl.BodySchema{
 		{
 			Name: "sensitive",
 		},
+		{
+			Name: "nullable",
+		},
+		{
+			Name: "deprecated",
+		},
+		{
+			Name: "ephemeral",
+		},
 	},
 	Blocks: []hcl.BlockHeaderSchema{
 		{
@@ -314,12 +429,13 @@ func (variables *Variables) decodeVariableBlock(block *hcl.Block, ectx *hcl.Eval
 		(*variables) = Variables{}
 	}
 
-	if _, found := (*variables)[block.Labels[0]]; found {
+	if existing, found := (*variables)[block.Labels[0]]; found {
 		return []*hcl.Diagnostic{{
 			Severity: hcl.DiagError,
 			Summary:  "Duplicate variable",
-			Detail:   "Duplicate " + block.Labels[0] + " variable definition found.",
-			Context:  block.DefRange.Ptr(),
+			Detail: fmt.Sprintf("Duplicate %s variable definition found, "+
+				"it was previously defined at %s.", block.Labels[0], existing.Range.Ptr()),
+			Subject: block.DefRange.Ptr(),
 		}}
 	}
 
@@ -361,6 +477,23 @@ func (variables *Variables) decodeVariableBlock(block *hcl.Block, ectx *hcl.Eval
 		diags = append(diags, valDiags...)
 	}
 
+	if attr, exists := content.Attributes["nullable"]; exists {
+		var nullable bool
+		valDiags := gohcl.DecodeExpression(attr.Expr, nil, &nullable)
+		diags = append(diags, valDiags...)
+		v.Nullable = config.TrileanFromBool(nullable)
+	}
+
+	if attr, exists := content.Attributes["deprecated"]; exists {
+		valDiags := gohcl.DecodeExpression(attr.Expr, nil, &v.Deprecated)
+		diags = append(diags, valDiags...)
+	}
+
+	if attr, exists := content.Attributes["ephemeral"]; exists {
+		valDiags := gohcl.DecodeExpression(attr.Expr, nil, &v.Ephemeral)
+		diags = append(diags, valDiags...)
+	}
+
 	if def, ok := content.Attributes["default"]; ok {
 		defaultValue, moreDiags := def.Expr.Value(ectx)
 		diags = append(diags, moreDiags...)
@@ -457,19 +590,22 @@ func decodeVariableValidationBlock(varName string, block *hcl.Block) (*VariableV
 	if attr, exists := content.Attributes["condition"]; exists {
 		vv.Condition = attr.Expr
 
-		// The validation condition must refer to the variable itself and
-		// nothing else; to ensure that the variable declaration can't create
-		// additional edges in the dependency graph.
+		// The validation condition must refer to the variable itself, and can
+		// refer to other input variables and to locals, to validate the
+		// variable according to them.
 		goodRefs := 0
 		for _, traversal := range vv.Condition.Variables() {
 
 			ref, moreDiags := addrs.ParseRef(traversal)
 			if !moreDiags.HasErrors() {
-				if addr, ok := ref.Subject.(addrs.InputVariable); ok {
+				switch addr := ref.Subject.(type) {
+				case addrs.InputVariable:
 					if addr.Name == varName {
 						goodRefs++
-						continue // Reference is valid
 					}
+					continue // Reference is valid
+				case addrs.LocalValue:
+					continue // Reference is valid
 				}
 			}
 
@@ -477,7 +613,7 @@ func decodeVariableValidationBlock(varName string, block *hcl.Block) (*VariableV
 			diags = diags.Append(&hcl.Diagnostic{
 				Severity: hcl.DiagError,
 				Summary:  "Invalid reference in variable validation",
-				Detail:   fmt.Sprintf("The condition for variable %q can only refer to the variable itself, using var.%s.", varName, varName),
+				Detail:   fmt.Sprintf("The condition for variable %q can only refer to input variables, using var.<NAME>, and to locals, using local.<NAME>.", varName),
 				Subject:  traversal.SourceRange().Ptr(),
 			})
 		}
@@ -492,42 +628,51 @@ func decodeVariableValidationBlock(varName string, block *hcl.Block) (*VariableV
 	}
 
 	if attr, exists := content.Attributes["error_message"]; exists {
-		moreDiags := gohcl.DecodeExpression(attr.Expr, nil, &vv.ErrorMessage)
+		vv.ErrorMessage, moreDiags = decodeValidationErrorMessage(attr)
 		diags = append(diags, moreDiags...)
-		if !moreDiags.HasErrors() {
-			const errSummary = "Invalid validation error message"
-			switch {
-			case vv.ErrorMessage == "":
-				diags = diags.Append(&hcl.Diagnostic{
-					Severity: hcl.DiagError,
-					Summary:  errSummary,
-					Detail:   "An empty string is not a valid nor useful error message.",
-					Subject:  attr.Expr.Range().Ptr(),
-				})
-			case !looksLikeSentences(vv.ErrorMessage):
-				// Because we're going to include this string verbatim as part
-				// of a bigger error message written in our usual style, we'll
-				// require the given error message to conform to that. We might
-				// relax this in future if e.g. we start presenting these error
-				// messages in a different way, or if Packer starts supporting
-				// producing error messages in other human languages, etc. For
-				// pragmatism we also allow sentences ending with exclamation
-				// points, but we don't mention it explicitly here because
-				// that's not really consistent with the Packer UI writing
-				// style.
-				diags = diags.Append(&hcl.Diagnostic{
-					Severity: hcl.DiagError,
-					Summary:  errSummary,
-					Detail:   "Validation error message must be at least one full sentence starting with an uppercase letter ( if the alphabet permits it ) and ending with a period or question mark.",
-					Subject:  attr.Expr.Range().Ptr(),
-				})
-			}
-		}
 	}
 
 	return vv, diags
 }
 
+// decodeValidationErrorMessage decodes the error_message attribute of a
+// validation rule, which must be made of full sentences.
+func decodeValidationErrorMessage(attr *hcl.Attribute) (string, hcl.Diagnostics) {
+	var errorMessage string
+	diags := gohcl.DecodeExpression(attr.Expr, nil, &errorMessage)
+	if !diags.HasErrors() {
+		const errSummary = "Invalid validation error message"
+		switch {
+		case errorMessage == "":
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  errSummary,
+				Detail:   "An empty string is not a valid nor useful error message.",
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+		case !looksLikeSentences(errorMessage):
+			// Because we're going to include this string verbatim as part
+			// of a bigger error message written in our usual style, we'll
+			// require the given error message to conform to that. We might
+			// relax this in future if e.g. we start presenting these error
+			// messages in a different way, or if Packer starts supporting
+			// producing error messages in other human languages, etc. For
+			// pragmatism we also allow sentences ending with exclamation
+			// points, but we don't mention it explicitly here because
+			// that's not really consistent with the Packer UI writing
+			// style.
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  errSummary,
+				Detail:   "Validation error message must be at least one full sentence starting with an uppercase letter ( if the alphabet permits it ) and ending with a period or question mark.",
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+		}
+	}
+
+	return errorMessage, diags
+}
+
 // looksLikeSentence is a simple heuristic that encourages writing error
 // messages that will be presentable when included as part of a larger error
 // diagnostic whose other text is written in the UI writing style.
@@ -561,7 +706,7 @@ func looksLikeSentences(s string) bool {
 // them.
 const VarEnvPrefix = "PKR_VAR_"
 
-func (cfg *PackerConfig) collectInputVariableValues(env []string, files []*hcl.File, argv map[string]string) hcl.Diagnostics {
+func (cfg *PackerConfig) collectInputVariableValues(env []string, files []*hcl.File, sources []*varSource, argv map[string]string) hcl.Diagnostics {
 	var diags hcl.Diagnostics
 	variables := cfg.InputVariables
 
@@ -707,6 +852,60 @@ func (cfg *PackerConfig) collectInputVariableValues(env []string, files []*hcl.F
 		}
 	}
 
+	// Then the values of the variable sources, in the order they were given.
+	for _, source := range sources {
+		names := make([]string, 0, len(source.values))
+		for name := range source.values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			expr := source.values[name]
+			variable, found := variables[name]
+			if !found {
+				if !cfg.ValidationOptions.WarnOnUndeclaredVar {
+					continue
+				}
+
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Undefined variable",
+					Detail: fmt.Sprintf("The variable %q was set by the %s:%s "+
+						"variable source but was not declared as an input variable.",
+						name, source.Kind, source.Path),
+					Context: expr.Range().Ptr(),
+				})
+				continue
+			}
+
+			val, moreDiags := expr.Value(nil)
+			diags = append(diags, moreDiags...)
+
+			if variable.Type != cty.NilType {
+				var err error
+				val, err = convert.Convert(val, variable.Type)
+				if err != nil {
+					diags = append(diags, &hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  "Invalid value for variable",
+						Detail: fmt.Sprintf("The value for %s set by the %s:%s variable source "+
+							"is not compatible with the variable's type constraint: %s.",
+							name, source.Kind, source.Path, err),
+						Subject: expr.Range().Ptr(),
+					})
+					val = cty.DynamicVal
+				}
+			}
+
+			variable.Values = append(variable.Values, VariableAssignment{
+				From:  source.From(),
+				Value: val,
+				Expr:  expr,
+			})
+		}
+	}
+
 	// Finally we process values given explicitly on the command line.
 	for name, value := range argv {
 		variable, found := variables[name]
@@ -6,6 +6,8 @@ package hcl2template
 import (
 	"fmt"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -130,6 +132,7 @@ func TestParse_variables(t *testing.T) {
 				&packer.CoreBuild{
 					Type:           "null.test",
 					Builder:        &null.Builder{},
+					Resumable:      true,
 					Provisioners:   []packer.CoreBuildProvisioner{},
 					PostProcessors: [][]packer.CoreBuildPostProcessor{},
 					Prepared:       true,
@@ -294,6 +297,7 @@ func TestParse_variables(t *testing.T) {
 				&packer.CoreBuild{
 					Type:           "null",
 					Builder:        &null.Builder{},
+					Resumable:      true,
 					Provisioners:   []packer.CoreBuildProvisioner{},
 					PostProcessors: [][]packer.CoreBuildPostProcessor{},
 					Prepared:       true,
@@ -380,6 +384,7 @@ func TestParse_variables(t *testing.T) {
 				&packer.CoreBuild{
 					Type:           "null.test",
 					Builder:        &null.Builder{},
+					Resumable:      true,
 					Provisioners:   []packer.CoreBuildProvisioner{},
 					PostProcessors: [][]packer.CoreBuildPostProcessor{},
 					Prepared:       true,
@@ -443,6 +448,7 @@ func TestParse_variables(t *testing.T) {
 				&packer.CoreBuild{
 					Type:           "null.test",
 					Builder:        &null.Builder{},
+					Resumable:      true,
 					Provisioners:   []packer.CoreBuildProvisioner{},
 					PostProcessors: [][]packer.CoreBuildPostProcessor{},
 					Prepared:       true,
@@ -484,6 +490,7 @@ func TestParse_variables(t *testing.T) {
 				&packer.CoreBuild{
 					Type:           "null.test",
 					Builder:        &null.Builder{},
+					Resumable:      true,
 					Provisioners:   []packer.CoreBuildProvisioner{},
 					PostProcessors: [][]packer.CoreBuildPostProcessor{},
 					Prepared:       true,
@@ -538,9 +545,10 @@ func TestParse_variables(t *testing.T) {
 			},
 			false, false,
 			[]packersdk.Build{&packer.CoreBuild{
-				Type:     "null.null-builder",
-				Prepared: true,
-				Builder:  &null.Builder{},
+				Type:      "null.null-builder",
+				Prepared:  true,
+				Builder:   &null.Builder{},
+				Resumable: true,
 				Provisioners: []packer.CoreBuildProvisioner{
 					{
 						PType: "shell",
@@ -628,6 +636,7 @@ func TestParse_variables(t *testing.T) {
 				&packer.CoreBuild{
 					Type:           "null.test",
 					Builder:        &null.Builder{},
+					Resumable:      true,
 					Provisioners:   []packer.CoreBuildProvisioner{},
 					PostProcessors: [][]packer.CoreBuildPostProcessor{},
 					Prepared:       true,
@@ -1004,7 +1013,7 @@ func TestVariables_collectVariableValues(t *testing.T) {
 				InputVariables:    tt.variables,
 				ValidationOptions: tt.validationOptions,
 			}
-			gotDiags := cfg.collectInputVariableValues(tt.args.env, files, tt.args.argv)
+			gotDiags := cfg.collectInputVariableValues(tt.args.env, files, nil, tt.args.argv)
 			if (gotDiags == nil) == tt.wantDiags {
 				t.Fatalf("Variables.collectVariableValues() = %v, want %v", gotDiags, tt.wantDiags)
 			}
@@ -1040,3 +1049,149 @@ func stringListVal(strings ...string) cty.Value {
 	}
 	return list
 }
+
+func TestParse_var_sources(t *testing.T) {
+	dir := "testdata/variables/var_sources"
+	sources := []string{
+		"json:" + filepath.Join(dir, "values.json"),
+		"yaml:" + filepath.Join(dir, "values.yml"),
+		"dotenv:" + filepath.Join(dir, "values.env"),
+	}
+	wantOwner := cty.StringVal("packer")
+	if runtime.GOOS != "windows" {
+		sources = append(sources, "exec:"+filepath.Join(dir, "values.sh"))
+		wantOwner = cty.StringVal("ci")
+	}
+
+	parser := getBasicParser()
+	parser.VarSources = sources
+	cfg, diags := parser.Parse(dir, nil, map[string]string{"instance_type": "m5.xlarge"})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected error: %s", diags)
+	}
+
+	want := map[string]cty.Value{
+		"region":        cty.StringVal("eu-west-3"),
+		"instance_type": cty.StringVal("m5.xlarge"),
+		"tags":          cty.MapVal(map[string]cty.Value{"team": cty.StringVal("images")}),
+		"zones":         cty.ListVal([]cty.Value{cty.StringVal("eu-central-1a")}),
+		"owner":         wantOwner,
+	}
+	for name, value := range want {
+		if got := cfg.InputVariables[name].Value(); !got.RawEquals(value) {
+			t.Errorf("var.%s: expected %#v, got %#v", name, value, got)
+		}
+	}
+
+	region := cfg.InputVariables["region"]
+	var from []string
+	for _, value := range region.Values {
+		from = append(from, value.From)
+	}
+	wantFrom := []string{
+		"default",
+		"var-source json:" + filepath.Join(dir, "values.json"),
+		"var-source yaml:" + filepath.Join(dir, "values.yml"),
+	}
+	if diff := cmp.Diff(wantFrom, from); diff != "" {
+		t.Errorf("unexpected assignments of var.region: %s", diff)
+	}
+
+	for _, source := range []string{"toml:values.toml", "values.json", "json:" + filepath.Join(dir, "missing.json")} {
+		parser := getBasicParser()
+		parser.VarSources = []string{source}
+		if _, diags := parser.Parse(dir, nil, nil); !diags.HasErrors() {
+			t.Errorf("%s: expected an error", source)
+		}
+	}
+}
+
+func TestParseDotenvLine(t *testing.T) {
+	tests := []struct {
+		line, name, value string
+		ok, err           bool
+	}{
+		{"", "", "", false, false},
+		{"# comment", "", "", false, false},
+		{"region=eu-west-1", "region", "eu-west-1", true, false},
+		{"export region = eu-west-1 ", "region", "eu-west-1", true, false},
+		{`region="eu\twest"`, "region", "eu\twest", true, false},
+		{`region='eu\twest'`, "region", `eu\twest`, true, false},
+		{"region", "", "", false, true},
+		{`region="eu`, "region", `"eu`, true, false},
+	}
+	for _, tt := range tests {
+		name, value, ok, err := parseDotenvLine(tt.line)
+		if name != tt.name || value != tt.value || ok != tt.ok || (err != nil) != tt.err {
+			t.Errorf("parseDotenvLine(%q) = %q, %q, %t, %v", tt.line, name, value, ok, err)
+		}
+	}
+}
+
+func TestParse_variable_metadata(t *testing.T) {
+	dir := "testdata/variables/metadata"
+
+	cfg := testParseConfig(t, getBasicParser(), dir)
+	diags := cfg.Initialize(packer.InitializeOptions{})
+	if !strings.Contains(diags.Error(), `Invalid null value for variable "region"`) {
+		t.Fatalf("expected a null value error for the non-nullable variable, got %s", diags)
+	}
+
+	cfg = testParseConfigVars(t, getBasicParser(), dir, map[string]string{
+		"old_region": "eu-west-1",
+		"region":     "eu-west-3",
+	})
+	diags = cfg.Initialize(packer.InitializeOptions{})
+	if len(diags) != 1 || diags[0].Severity != hcl.DiagWarning ||
+		diags[0].Summary != `Deprecated variable "old_region"` ||
+		!strings.Contains(diags[0].Detail, "Use var.region instead.") {
+		t.Fatalf("expected a deprecation warning, got %s", diags)
+	}
+
+	printed := cfg.printVariables()
+	for _, want := range []string{`var.token: "<ephemeral>"`, `local.authorization: "<ephemeral>"`} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("expected printed variables to contain %s, got:\n%s", want, printed)
+		}
+	}
+
+	_, diags = cfg.GetBuilds(packer.GetBuildsOptions{})
+	if !strings.Contains(diags.Error(), "Ephemeral value in manifest") {
+		t.Fatalf("expected an ephemeral manifest error, got %s", diags)
+	}
+}
+
+func TestParse_cross_variable_validation(t *testing.T) {
+	dir := "testdata/variables/cross_validation"
+	tests := []struct {
+		name    string
+		argVars map[string]string
+		errs    []string
+	}{
+		{"defaults", nil, nil},
+		{"encrypted", map[string]string{"encrypt": "true", "kms_key_id": "key", "disk_size": "30"}, nil},
+		{"missing kms key", map[string]string{"encrypt": "true", "disk_size": "30"},
+			[]string{"A KMS key must be set to encrypt images."}},
+		{"disk size over local", map[string]string{"disk_size": "50"},
+			[]string{"The disk size cannot exceed the size of the base image."}},
+		{"failing check", map[string]string{"encrypt": "true", "kms_key_id": "key"},
+			[]string{`Check "disk_encryption" failed`, "Encrypted images need a disk of at least 30GB."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testParseConfigVars(t, getBasicParser(), dir, tt.argVars)
+			diags := cfg.Initialize(packer.InitializeOptions{})
+			if len(tt.errs) == 0 {
+				if diags.HasErrors() {
+					t.Fatalf("unexpected initialize error: %s", diags)
+				}
+				return
+			}
+			for _, err := range tt.errs {
+				if !strings.Contains(diags.Error(), err) {
+					t.Errorf("expected error %q, got %s", err, diags)
+				}
+			}
+		})
+	}
+}
@@ -112,16 +112,33 @@ func convertFilterOption(patterns []string, optionName string) ([]glob.Glob, hcl
 				Severity: hcl.DiagError,
 			})
 		}
-		globs = append(globs, g)
+		globs = append(globs, literalOrGlob{Glob: g, pattern: pattern})
 	}
 
 	return globs, diags
 }
 
+// literalOrGlob matches the names equal to its pattern, as well as the ones
+// its glob matches: the name of an instance of a source used with for_each,
+// like `amazon-ebs.ubuntu["eu-west-1"]`, would otherwise be read as a glob
+// character class.
+type literalOrGlob struct {
+	glob.Glob
+	pattern string
+}
+
+func (g literalOrGlob) Match(name string) bool {
+	if name == g.pattern {
+		return true
+	}
+	return g.Glob != nil && g.Glob.Match(name)
+}
+
 func PrintableCtyValue(v cty.Value) string {
 	if !v.IsWhollyKnown() {
 		return "<unknown>"
 	}
+	v, _ = v.UnmarkDeep()
 	gval := hcl2shim.ConfigValueFromHCL2(v)
 	str := repl.FormatResult(gval)
 	return str
@@ -0,0 +1,254 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package hcl2template
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	ctyyaml "github.com/zclconf/go-cty-yaml"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Kinds of variable sources, set with the -var-source=kind:path flag.
+const (
+	// A JSON document whose attributes set variables.
+	varSourceJSON = "json"
+	// A YAML document whose top-level keys set variables.
+	varSourceYAML = "yaml"
+	// A .env file whose KEY=value lines set variables, with or without the
+	// PKR_VAR_ prefix; values are read like the ones of env variables.
+	varSourceDotenv = "dotenv"
+	// An executable printing a JSON document on its standard output.
+	varSourceExec = "exec"
+)
+
+// varSourceFromPrefix prefixes the From of the variable assignments of
+// variable sources.
+const varSourceFromPrefix = "var-source "
+
+var varSourceKinds = []string{varSourceJSON, varSourceYAML, varSourceDotenv, varSourceExec}
+
+// varSource is a source of input variable values, read from the
+// -var-source=kind:path flag. Values of variable sources have precedence over
+// the ones of var files, values set with -var have precedence over them.
+type varSource struct {
+	Kind string
+	Path string
+
+	// values are the expressions setting variables, by variable name.
+	values map[string]hcl.Expression
+}
+
+// From returns how assignments from the source are recorded.
+func (s *varSource) From() string {
+	return varSourceFromPrefix + s.Kind + ":" + s.Path
+}
+
+// readVarSources reads the values of the -var-source flags in sources.
+// variables are the declared input variables, the values of a dotenv source
+// are parsed according to their type.
+func (p *Parser) readVarSources(sources []string, variables Variables) ([]*varSource, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var res []*varSource
+	for _, raw := range sources {
+		kind, path, found := strings.Cut(raw, ":")
+		if !found || path == "" {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid -var-source " + raw,
+				Detail: "A variable source must be set as kind:path, " +
+					"for example json:variables.json.",
+			})
+			continue
+		}
+		source := &varSource{Kind: kind, Path: path}
+
+		var moreDiags hcl.Diagnostics
+		switch kind {
+		case varSourceJSON:
+			moreDiags = p.readJSONVarSource(source)
+		case varSourceYAML:
+			moreDiags = readYAMLVarSource(source)
+		case varSourceDotenv:
+			moreDiags = readDotenvVarSource(source, variables)
+		case varSourceExec:
+			moreDiags = p.readExecVarSource(source)
+		default:
+			moreDiags = hcl.Diagnostics{&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unknown -var-source kind " + strconv.Quote(kind),
+				Detail: fmt.Sprintf("The kind of a variable source must be one of %s.",
+					strings.Join(varSourceKinds, ", ")),
+			}}
+		}
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		res = append(res, source)
+	}
+	return res, diags
+}
+
+func (p *Parser) readJSONVarSource(source *varSource) hcl.Diagnostics {
+	f, diags := p.ParseJSONFile(source.Path)
+	if diags.HasErrors() {
+		return diags
+	}
+	return append(diags, source.setAttributes(f)...)
+}
+
+func (p *Parser) readExecVarSource(source *varSource) hcl.Diagnostics {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(source.Path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		detail := err.Error()
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			detail += ":\n" + msg
+		}
+		return hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to run variable source " + source.Path,
+			Detail:   detail,
+		}}
+	}
+
+	f, diags := p.ParseJSON(stdout.Bytes(), fmt.Sprintf("<output of %s>", source.Path))
+	if diags.HasErrors() {
+		return diags
+	}
+	return append(diags, source.setAttributes(f)...)
+}
+
+// setAttributes sets the values of source to the attributes of f.
+func (s *varSource) setAttributes(f *hcl.File) hcl.Diagnostics {
+	attrs, diags := f.Body.JustAttributes()
+	s.values = map[string]hcl.Expression{}
+	for name, attr := range attrs {
+		s.values[name] = attr.Expr
+	}
+	return diags
+}
+
+func readYAMLVarSource(source *varSource) hcl.Diagnostics {
+	src, err := os.ReadFile(source.Path)
+	if err != nil {
+		return hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read variable source " + source.Path,
+			Detail:   err.Error(),
+		}}
+	}
+	value, err := ctyyaml.Standard.Unmarshal(src, cty.DynamicPseudoType)
+	if err == nil && !value.IsNull() && !value.Type().IsObjectType() && !value.Type().IsMapType() {
+		err = fmt.Errorf("the document must be a mapping of variable names to values")
+	}
+	if err != nil {
+		return hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid YAML variable source " + source.Path,
+			Detail:   err.Error(),
+		}}
+	}
+
+	source.values = map[string]hcl.Expression{}
+	if value.IsNull() {
+		return nil
+	}
+	rng := hcl.Range{Filename: source.Path}
+	for name, v := range value.AsValueMap() {
+		source.values[name] = hcl.StaticExpr(v, rng)
+	}
+	return nil
+}
+
+func readDotenvVarSource(source *varSource, variables Variables) hcl.Diagnostics {
+	f, err := os.Open(source.Path)
+	if err != nil {
+		return hcl.Diagnostics{&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read variable source " + source.Path,
+			Detail:   err.Error(),
+		}}
+	}
+	defer f.Close()
+
+	var diags hcl.Diagnostics
+	source.values = map[string]hcl.Expression{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		name, value, ok, err := parseDotenvLine(scanner.Text())
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid dotenv variable source",
+				Detail:   fmt.Sprintf("%s:%d: %s.", source.Path, line, err),
+			})
+			continue
+		}
+		if !ok {
+			continue
+		}
+		name = strings.TrimPrefix(name, VarEnvPrefix)
+
+		variableType := cty.DynamicPseudoType
+		if variable, found := variables[name]; found {
+			variableType = variable.Type
+		}
+		expr, moreDiags := expressionFromVariableDefinition(
+			fmt.Sprintf("<value for var.%s from %s:%d>", name, source.Path, line),
+			value, variableType)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		source.values[name] = expr
+	}
+	if err := scanner.Err(); err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read variable source " + source.Path,
+			Detail:   err.Error(),
+		})
+	}
+	return diags
+}
+
+// parseDotenvLine parses a KEY=value line of a .env file; ok is false for
+// empty lines and comments. Values can be quoted: double quoted values are
+// unescaped, single quoted values are taken as is.
+func parseDotenvLine(line string) (name, value string, ok bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false, nil
+	}
+	line = strings.TrimPrefix(line, "export ")
+
+	name, value, found := strings.Cut(line, "=")
+	name = strings.TrimSpace(name)
+	if !found || name == "" {
+		return "", "", false, fmt.Errorf("expected KEY=value, got %q", line)
+	}
+
+	value = strings.TrimSpace(value)
+	switch {
+	case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+		value, err = strconv.Unquote(value)
+		if err != nil {
+			return "", "", false, fmt.Errorf("invalid quoted value for %s: %s", name, err)
+		}
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		value = value[1 : len(value)-1]
+	}
+	return name, value, true, nil
+}
@@ -130,6 +130,10 @@ func NewHCLRegistry(config *hcl2template.PackerConfig, ui sdkpacker.Ui) (*HCLReg
 	if dsDiags != nil {
 		diags = append(diags, dsDiags...)
 	}
+	for name, val := range vals {
+		// the outputs of data sources can be marked as sensitive
+		vals[name], _ = val.UnmarkDeep()
+	}
 
 	build := config.Builds[0]
 	bucket, bucketDiags := createConfiguredBucket(
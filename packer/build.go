@@ -7,7 +7,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -41,10 +43,39 @@ type CoreBuild struct {
 	CleanupProvisioner CoreBuildProvisioner
 	TemplatePath       string
 	Variables          map[string]string
+	// InputFiles are the local files read by the configuration of the
+	// build, beyond the ones named in the configuration of its provisioners:
+	// for HCL2 templates, the files matched by fileset().
+	InputFiles []string
 
 	// Indicates whether the build is already initialized before calling Prepare(..)
 	Prepared bool
 
+	// DependsOn lists the names of the build blocks whose builds must
+	// complete before this build can start.
+	DependsOn []string
+	// PrepareUpstream, when set, is called with the artifacts of the builds
+	// of each build block listed in DependsOn, once they all completed and
+	// before this build is run, so that they can be used in its
+	// configuration. It returns the warnings of the builder configured this
+	// way.
+	PrepareUpstream func(map[string][]packersdk.Artifact) ([]string, error)
+
+	// State, when set, is where the completed provisioners and
+	// post-processor sequences of this build are recorded; when the builder
+	// can re-attach to the instance of a previous run, the steps recorded
+	// there are skipped.
+	State *BuildState
+	// Resumable is set when the builder re-attaches to the instance of a
+	// previous run, which it tells by declaring the ResumableBuilderVar
+	// generated variable.
+	Resumable bool
+
+	// Timeout, when set, is how long the build can run. Once it is reached,
+	// the provisioners and post-processors are stopped, and the builder is
+	// given buildTimeoutGracePeriod to clean up before it is cancelled too.
+	Timeout time.Duration
+
 	debug         bool
 	force         bool
 	onError       string
@@ -52,6 +83,27 @@ type CoreBuild struct {
 	prepareCalled bool
 }
 
+// buildTimeoutGracePeriod is how long the builder of a build that timed out
+// is given to stop by itself: stopping the provisioners makes the
+// provisioning step fail, so that the builder cleans up as it does for any
+// error, running the error-cleanup-provisioner.
+const buildTimeoutGracePeriod = 30 * time.Second
+
+// BuildTimeoutError is the error of a build that did not complete within its
+// Timeout.
+type BuildTimeoutError struct {
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *BuildTimeoutError) Error() string {
+	return fmt.Sprintf("build timed out after %s: %s", e.Timeout, e.Err)
+}
+
+func (e *BuildTimeoutError) Unwrap() error {
+	return e.Err
+}
+
 // CoreBuildPostProcessor Keeps track of the post-processor and the
 // configuration of the post-processor used within a build.
 type CoreBuildPostProcessor struct {
@@ -69,6 +121,22 @@ type CoreBuildPostProcessor struct {
 	KeepInputArtifact *bool
 }
 
+// ConditionalPostProcessor is implemented by post-processors that only run
+// when a condition is met. The condition is evaluated right before the
+// post-processor would run, with the artifact it would process.
+type ConditionalPostProcessor interface {
+	ShouldRun(artifact packersdk.Artifact) (bool, error)
+}
+
+// shouldRun tells whether the post-processor should process artifact.
+func (pp *CoreBuildPostProcessor) shouldRun(artifact packersdk.Artifact) (bool, error) {
+	conditional, ok := pp.PostProcessor.(ConditionalPostProcessor)
+	if !ok {
+		return true, nil
+	}
+	return conditional.ShouldRun(artifact)
+}
+
 // CoreBuildProvisioner keeps track of the provisioner and the configuration of
 // the provisioner within the build.
 type CoreBuildProvisioner struct {
@@ -132,6 +200,7 @@ func (b *CoreBuild) Prepare() (warn []string, err error) {
 		log.Printf("Build '%s' prepare failure: %s\n", b.Type, err)
 		return
 	}
+	generatedVars, b.Resumable = ResumableGeneratedVars(generatedVars)
 
 	// If the builder has provided a list of to-be-generated variables that
 	// should be made accessible to provisioners, pass that list into
@@ -186,6 +255,31 @@ func (b *CoreBuild) Run(ctx context.Context, originalUi packersdk.Ui) ([]packers
 		panic("Prepare must be called first")
 	}
 
+	// The builder just has a normal Ui, but targeted
+	builderUi := &TargetedUI{
+		Target: b.Name(),
+		Ui:     originalUi,
+	}
+
+	// The builder context outlives the build deadline a little, so that the
+	// builder can clean up.
+	builderCtx := ctx
+	var deadline time.Time
+	if b.Timeout > 0 {
+		deadline = time.Now().Add(b.Timeout)
+		var cancel context.CancelFunc
+		builderCtx, cancel = context.WithDeadline(ctx, deadline.Add(buildTimeoutGracePeriod))
+		defer cancel()
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	if !b.State.Empty() && !b.canResume() {
+		builderUi.Say(fmt.Sprintf("The %s builder cannot re-attach to the "+
+			"instance of a previous run, all steps will be run again.", b.builderType()))
+		b.State.Reset()
+	}
+
 	// Copy the hooks
 	hooks := make(map[string][]packersdk.Hook)
 	for hookName, hookList := range b.hooks {
@@ -224,6 +318,8 @@ func (b *CoreBuild) Run(ctx context.Context, originalUi packersdk.Ui) ([]packers
 
 		hooks[packersdk.HookProvision] = append(hooks[packersdk.HookProvision], &ProvisionHook{
 			Provisioners: hookedProvisioners,
+			State:        b.State,
+			Deadline:     deadline,
 		})
 	}
 
@@ -241,12 +337,6 @@ func (b *CoreBuild) Run(ctx context.Context, originalUi packersdk.Ui) ([]packers
 	hook := &packersdk.DispatchHook{Mapping: hooks}
 	artifacts := make([]packersdk.Artifact, 0, 1)
 
-	// The builder just has a normal Ui, but targeted
-	builderUi := &TargetedUI{
-		Target: b.Name(),
-		Ui:     originalUi,
-	}
-
 	var ts *TelemetrySpan
 	log.Printf("Running builder: %s", b.BuilderType)
 	if b.BuilderConfig != nil {
@@ -254,16 +344,16 @@ func (b *CoreBuild) Run(ctx context.Context, originalUi packersdk.Ui) ([]packers
 	} else {
 		ts = CheckpointReporter.AddSpan(b.Type, "builder", b.HCLConfig)
 	}
-	builderArtifact, err := b.Builder.Run(ctx, builderUi, hook)
+	builderArtifact, err := b.Builder.Run(builderCtx, builderUi, hook)
 	ts.End(err)
 	if err != nil {
-		return nil, err
+		return nil, b.timeoutError(deadline, err)
 	}
 
 	// If there was no result, don't worry about running post-processors
 	// because there is nothing they can do, just return.
 	if builderArtifact == nil {
-		return nil, nil
+		return nil, b.timeoutError(deadline, nil)
 	}
 
 	errors := make([]error, 0)
@@ -272,25 +362,59 @@ func (b *CoreBuild) Run(ctx context.Context, originalUi packersdk.Ui) ([]packers
 	select {
 	case <-ctx.Done():
 		log.Println("Build was cancelled. Skipping post-processors.")
-		return nil, ctx.Err()
+		return nil, b.timeoutError(deadline, ctx.Err())
 	default:
 	}
 
 	// Run the post-processors
 PostProcessorRunSeqLoop:
-	for _, ppSeq := range b.PostProcessors {
-		priorArtifact := builderArtifact
+	for seqIdx, ppSeq := range b.PostProcessors {
+		ppTypes := make([]string, len(ppSeq))
 		for i, corePP := range ppSeq {
+			ppTypes[i] = corePP.PType
+		}
+		if b.State.PostProcessorsDone(seqIdx, ppTypes) {
+			builderUi.Say(fmt.Sprintf("Skipping post-processors %v: already completed in a previous run", ppTypes))
+			seqArtifacts, keepInput := b.State.PostProcessorsArtifacts(seqIdx, ppTypes)
+			artifacts = append(artifacts, seqArtifacts...)
+			if keepInput {
+				keepOriginalArtifact = true
+			}
+			continue
+		}
+
+		priorArtifact := builderArtifact
+		// ran counts the post-processors of the sequence that ran, the
+		// ones whose condition is not met being skipped.
+		ran := 0
+		// seqStart and seqKeepInput record the artifacts of the sequence,
+		// and whether it keeps the artifact of the builder, to replay them
+		// when a resumed run skips it.
+		seqStart := len(artifacts)
+		seqKeepInput := false
+		for _, corePP := range ppSeq {
 			ppUi := &TargetedUI{
 				Target: fmt.Sprintf("%s (%s)", b.Name(), corePP.PType),
 				Ui:     originalUi,
 			}
 
+			run, err := corePP.shouldRun(priorArtifact)
+			if err != nil {
+				errors = append(errors, fmt.Errorf("Post-processor failed: %s", err))
+				continue PostProcessorRunSeqLoop
+			}
+			if !run {
+				builderUi.Say(fmt.Sprintf("Skipping post-processor %s: its condition is not met", corePP.PType))
+				continue
+			}
+
 			if corePP.PName == corePP.PType {
 				builderUi.Say(fmt.Sprintf("Running post-processor: %s", corePP.PType))
 			} else {
 				builderUi.Say(fmt.Sprintf("Running post-processor: %s (type %s)", corePP.PName, corePP.PType))
 			}
+			builderUi.Machine("post-processor-start", corePP.PType, corePP.PName)
+			start := time.Now()
 			var ts *TelemetrySpan
 			if corePP.config != nil {
 				ts = CheckpointReporter.AddSpan(corePP.PType, "post-processor", corePP.config)
@@ -299,6 +423,8 @@ PostProcessorRunSeqLoop:
 			}
 			artifact, defaultKeep, forceOverride, err := corePP.PostProcessor.PostProcess(ctx, ppUi, priorArtifact)
 			ts.End(err)
+			builderUi.Machine("post-processor-end", corePP.PType, corePP.PName,
+				machineDuration(time.Since(start)), machineError(err))
 			if err != nil {
 				errors = append(errors, fmt.Errorf("Post-processor failed: %s", err))
 				continue PostProcessorRunSeqLoop
@@ -328,10 +454,11 @@ PostProcessorRunSeqLoop:
 					keep = *corePP.KeepInputArtifact
 				}
 			}
-			if i == 0 {
+			if ran == 0 {
 				// This is the first post-processor. We handle deleting
 				// previous artifacts a bit different because multiple
 				// post-processors may be using the original and need it.
+				seqKeepInput = keep
 				if !keepOriginalArtifact && keep {
 					log.Printf(
 						"Flagging to keep original artifact from post-processor '%s'",
@@ -353,12 +480,19 @@ PostProcessorRunSeqLoop:
 			}
 
 			priorArtifact = artifact
+			ran++
 		}
 
-		// Add on the last artifact to the results
-		if priorArtifact != nil {
+		if ran == 0 {
+			// None of the post-processors ran, the original artifact is
+			// the result of the sequence.
+			keepOriginalArtifact = true
+			seqKeepInput = true
+		} else if priorArtifact != nil {
+			// Add on the last artifact to the results
 			artifacts = append(artifacts, priorArtifact)
 		}
+		b.State.SetPostProcessorsDone(seqIdx, ppTypes, artifacts[seqStart:], seqKeepInput)
 	}
 
 	if keepOriginalArtifact {
@@ -374,12 +508,42 @@ PostProcessorRunSeqLoop:
 
 	if len(errors) > 0 {
 		err = &packersdk.MultiError{Errors: errors}
-		return artifacts, err
+		return artifacts, b.timeoutError(deadline, err)
 	}
 
 	return artifacts, nil
 }
 
+// timeoutError returns err, as a BuildTimeoutError when the build deadline
+// was reached. The clock is checked rather than the context of the build, as
+// the provisioners are stopped by a context of their own, which can be done
+// first.
+func (b *CoreBuild) timeoutError(deadline time.Time, err error) error {
+	if deadline.IsZero() || time.Now().Before(deadline) {
+		return err
+	}
+	if err == nil {
+		err = context.DeadlineExceeded
+	}
+	return &BuildTimeoutError{Timeout: b.Timeout, Err: err}
+}
+
+// builderType returns the type of builder used for this build.
+func (b *CoreBuild) builderType() string {
+	if b.BuilderType != "" {
+		return b.BuilderType
+	}
+	// HCL2 builds are named after their source: `type.name`.
+	return strings.SplitN(b.Type, ".", 2)[0]
+}
+
+// canResume tells whether the builder of this build re-attaches to an
+// existing instance, making it safe to skip the steps a previous run
+// completed.
+func (b *CoreBuild) canResume() bool {
+	return b.Resumable
+}
+
 func (b *CoreBuild) SetDebug(val bool) {
 	if b.prepareCalled {
 		panic("prepare has already been called")
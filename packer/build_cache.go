@@ -0,0 +1,343 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package packer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// BuildCache remembers the builds that completed successfully, by
+// fingerprint, so that a build whose inputs did not change since can be
+// skipped, its recorded artifacts being reused instead.
+//
+// The fingerprint of a build covers its fully resolved configuration (see
+// BuildPlan), the versions of the plugins it uses, its user variables and the
+// content of the local files and directories its provisioners upload or run,
+// and of its InputFiles, the files matched by fileset(). Files read with
+// file() are covered through the configuration, as their content is part of
+// it.
+type BuildCache struct {
+	// Dir is the directory where the cache entries are stored.
+	Dir string
+	// Plugins are used to get the versions of the plugins of a build.
+	Plugins *PluginConfig
+}
+
+// buildCacheEntry is what is recorded in the cache for a build that
+// completed successfully.
+type buildCacheEntry struct {
+	Build     string                `json:"build"`
+	Artifacts []cachedArtifactEntry `json:"artifacts"`
+}
+
+type cachedArtifactEntry struct {
+	BuilderID string   `json:"builder_id"`
+	ID        string   `json:"id"`
+	String    string   `json:"string"`
+	Files     []string `json:"files"`
+}
+
+// Fingerprint computes the fingerprint of b. Builds depending on other builds
+// cannot be fingerprinted, as their configuration is only known once the
+// builds they depend on ran.
+func (c *BuildCache) Fingerprint(b packersdk.Build) (string, error) {
+	cb, ok := b.(*CoreBuild)
+	if !ok {
+		return "", fmt.Errorf("cannot fingerprint a %T build", b)
+	}
+	if len(cb.DependsOn) > 0 {
+		return "", fmt.Errorf("build %q depends on other builds", cb.Name())
+	}
+
+	h := sha256.New()
+	plan := cb.Plan()
+	fmt.Fprintf(h, "build %q\n", plan.Name)
+
+	files := map[string]bool{}
+	writeComponent := func(kind, name string, config cty.Value) {
+		version := ""
+		if c.Plugins != nil {
+			version = c.Plugins.ComponentVersion(kind, name)
+		}
+		fmt.Fprintf(h, "%s %q %q\n", kind, name, version)
+		writeCtyValue(h, config)
+		fmt.Fprintln(h)
+		if kind == "provisioner" {
+			provisionerFiles(config, files)
+		}
+	}
+
+	var writeProvisioners func(provisioners []ProvisionerPlan)
+	writeProvisioners = func(provisioners []ProvisionerPlan) {
+		for _, p := range provisioners {
+			writeComponent("provisioner", p.Type, p.Config)
+			fmt.Fprintf(h, "%q %s %s %d\n", p.Name, p.PauseBefore, p.Timeout, p.MaxRetries)
+			if p.Parallel != nil {
+				fmt.Fprintf(h, "parallel %d\n", p.Concurrency)
+				writeProvisioners(p.Parallel)
+				fmt.Fprintln(h, "end")
+			}
+		}
+	}
+
+	writeComponent("builder", plan.BuilderType, plan.Config)
+	writeProvisioners(plan.Provisioners)
+	if p := plan.CleanupProvisioner; p != nil {
+		writeComponent("provisioner", p.Type, p.Config)
+	}
+	for _, ppSeq := range plan.PostProcessors {
+		fmt.Fprintln(h, "post-processors")
+		for _, pp := range ppSeq {
+			writeComponent("post-processor", pp.Type, pp.Config)
+			keep := "default"
+			if pp.KeepInputArtifact != nil {
+				keep = strconv.FormatBool(*pp.KeepInputArtifact)
+			}
+			fmt.Fprintf(h, "%q %s\n", pp.Name, keep)
+		}
+	}
+
+	variables := make([]string, 0, len(cb.Variables))
+	for k := range cb.Variables {
+		variables = append(variables, k)
+	}
+	sort.Strings(variables)
+	for _, k := range variables {
+		fmt.Fprintf(h, "var %q %q\n", k, cb.Variables[k])
+	}
+
+	for _, path := range cb.InputFiles {
+		files[filepath.Clean(path)] = true
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(h, "file %q\n", path)
+		if err := writeFiles(h, path); err != nil {
+			return "", fmt.Errorf("failed to read %q: %s", path, err)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Lookup returns the artifacts recorded for the fingerprint, and whether the
+// fingerprint was found in the cache.
+func (c *BuildCache) Lookup(fingerprint string) ([]packersdk.Artifact, bool) {
+	content, err := os.ReadFile(c.entryPath(fingerprint))
+	if err != nil {
+		return nil, false
+	}
+	var entry buildCacheEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return nil, false
+	}
+
+	artifacts := make([]packersdk.Artifact, 0, len(entry.Artifacts))
+	for _, a := range entry.Artifacts {
+		artifacts = append(artifacts, &CachedArtifact{
+			BuilderIdValue: a.BuilderID,
+			IdValue:        a.ID,
+			StringValue:    a.String,
+			FilesValue:     a.Files,
+		})
+	}
+	return artifacts, true
+}
+
+// Store records the artifacts of the named build that just completed
+// successfully, under its fingerprint.
+func (c *BuildCache) Store(fingerprint, name string, artifacts []packersdk.Artifact) error {
+	entry := buildCacheEntry{Build: name}
+	for _, a := range artifacts {
+		if a == nil {
+			continue
+		}
+		entry.Artifacts = append(entry.Artifacts, cachedArtifactEntry{
+			BuilderID: a.BuilderId(),
+			ID:        a.Id(),
+			String:    a.String(),
+			Files:     a.Files(),
+		})
+	}
+	content, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that concurrent builds never read
+	// a partial entry.
+	path := c.entryPath(fingerprint)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (c *BuildCache) entryPath(fingerprint string) string {
+	return filepath.Join(c.Dir, fingerprint+".json")
+}
+
+// CachedArtifact is an artifact recorded in a BuildCache by a previous run.
+// Destroying it does nothing, as it still belongs to the run that created it.
+type CachedArtifact struct {
+	BuilderIdValue string
+	IdValue        string
+	StringValue    string
+	FilesValue     []string
+}
+
+var _ packersdk.Artifact = new(CachedArtifact)
+
+func (a *CachedArtifact) BuilderId() string {
+	return a.BuilderIdValue
+}
+
+func (a *CachedArtifact) Files() []string {
+	return a.FilesValue
+}
+
+func (a *CachedArtifact) Id() string {
+	return a.IdValue
+}
+
+func (a *CachedArtifact) String() string {
+	return a.StringValue
+}
+
+func (a *CachedArtifact) State(name string) interface{} {
+	return nil
+}
+
+func (a *CachedArtifact) Destroy() error {
+	return nil
+}
+
+// provisionerFileAttributes are the provisioner configuration attributes
+// that name local files or directories to upload or run.
+var provisionerFileAttributes = []string{"source", "sources", "script", "scripts"}
+
+// provisionerFiles adds the existing local files and directories named in the
+// provisionerFileAttributes of config to files.
+func provisionerFiles(config cty.Value, files map[string]bool) {
+	if config == cty.NilVal {
+		return
+	}
+	config, _ = config.UnmarkDeep()
+	if !config.IsKnown() || config.IsNull() || !config.Type().IsObjectType() {
+		return
+	}
+	for _, attr := range provisionerFileAttributes {
+		if !config.Type().HasAttribute(attr) {
+			continue
+		}
+		v := config.GetAttr(attr)
+		var paths []cty.Value
+		switch {
+		case !v.IsKnown() || v.IsNull():
+		case v.Type() == cty.String:
+			paths = []cty.Value{v}
+		case v.CanIterateElements():
+			for it := v.ElementIterator(); it.Next(); {
+				_, ev := it.Element()
+				paths = append(paths, ev)
+			}
+		}
+		for _, path := range paths {
+			if !path.IsKnown() || path.IsNull() || path.Type() != cty.String {
+				continue
+			}
+			if _, err := os.Stat(path.AsString()); err == nil {
+				files[filepath.Clean(path.AsString())] = true
+			}
+		}
+	}
+}
+
+// writeCtyValue writes a canonical representation of v to w.
+func writeCtyValue(w io.Writer, v cty.Value) {
+	if v == cty.NilVal {
+		fmt.Fprint(w, "nil")
+		return
+	}
+	v, _ = v.Unmark()
+	switch {
+	case !v.IsKnown():
+		fmt.Fprint(w, "?")
+		return
+	case v.IsNull():
+		fmt.Fprint(w, "null")
+		return
+	}
+
+	t := v.Type()
+	switch {
+	case t == cty.String:
+		fmt.Fprint(w, strconv.Quote(v.AsString()))
+	case t == cty.Number:
+		fmt.Fprint(w, v.AsBigFloat().Text('g', -1))
+	case t == cty.Bool:
+		fmt.Fprint(w, v.True())
+	case t.IsObjectType() || t.IsMapType():
+		fmt.Fprint(w, "{")
+		for it := v.ElementIterator(); it.Next(); {
+			k, ev := it.Element()
+			fmt.Fprintf(w, "%q=", k.AsString())
+			writeCtyValue(w, ev)
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprint(w, "}")
+	case t.IsListType() || t.IsSetType() || t.IsTupleType():
+		fmt.Fprint(w, "[")
+		for it := v.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			writeCtyValue(w, ev)
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprint(w, "]")
+	default:
+		fmt.Fprintf(w, "%#v", v)
+	}
+}
+
+// writeFiles writes the content of the file at path to h; or, for a
+// directory, the names and contents of all the files in it.
+func writeFiles(h hash.Hash, path string) error {
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(h, "%q\n", p)
+		_, err = io.Copy(h, f)
+		return err
+	})
+}
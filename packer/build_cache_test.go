@@ -0,0 +1,108 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package packer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func testCacheBuild(image, script string) *CoreBuild {
+	return &CoreBuild{
+		Type:        "docker.test",
+		BuilderType: "docker",
+		HCLConfig: cty.ObjectVal(map[string]cty.Value{
+			"image": cty.StringVal(image),
+		}),
+		Provisioners: []CoreBuildProvisioner{
+			{
+				PType: "shell",
+				HCLConfig: cty.ObjectVal(map[string]cty.Value{
+					"script": cty.StringVal(script),
+				}),
+			},
+		},
+	}
+}
+
+func TestBuildCache_Fingerprint(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.sh")
+	if err := os.WriteFile(script, []byte("echo one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := &BuildCache{Dir: filepath.Join(dir, "cache")}
+
+	fingerprint := func(b *CoreBuild) string {
+		fp, err := cache.Fingerprint(b)
+		if err != nil {
+			t.Fatalf("failed to fingerprint build: %s", err)
+		}
+		return fp
+	}
+
+	base := fingerprint(testCacheBuild("ubuntu", script))
+	if fp := fingerprint(testCacheBuild("ubuntu", script)); fp != base {
+		t.Fatal("the fingerprint of an unchanged build should be stable")
+	}
+	if fp := fingerprint(testCacheBuild("debian", script)); fp == base {
+		t.Fatal("changing the source config should change the fingerprint")
+	}
+
+	if err := os.WriteFile(script, []byte("echo two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if fp := fingerprint(testCacheBuild("ubuntu", script)); fp == base {
+		t.Fatal("changing a provisioner script should change the fingerprint")
+	}
+
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	withInput := testCacheBuild("ubuntu", script)
+	withInput.InputFiles = []string{input}
+	base = fingerprint(withInput)
+	if err := os.WriteFile(input, []byte("two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if fp := fingerprint(withInput); fp == base {
+		t.Fatal("changing an input file should change the fingerprint")
+	}
+
+	b := testCacheBuild("ubuntu", script)
+	b.DependsOn = []string{"base"}
+	if _, err := cache.Fingerprint(b); err == nil {
+		t.Fatal("builds depending on other builds should not be fingerprinted")
+	}
+}
+
+func TestBuildCache_StoreLookup(t *testing.T) {
+	cache := &BuildCache{Dir: t.TempDir()}
+
+	if _, found := cache.Lookup("abc"); found {
+		t.Fatal("nothing should be found in an empty cache")
+	}
+
+	artifact := &packersdk.MockArtifact{
+		BuilderIdValue: "bid",
+		IdValue:        "id",
+		FilesValue:     []string{"a", "b"},
+	}
+	if err := cache.Store("abc", "docker.test", []packersdk.Artifact{artifact}); err != nil {
+		t.Fatalf("failed to store: %s", err)
+	}
+
+	artifacts, found := cache.Lookup("abc")
+	if !found || len(artifacts) != 1 {
+		t.Fatalf("expected one cached artifact, got %#v", artifacts)
+	}
+	if a := artifacts[0]; a.BuilderId() != "bid" || a.Id() != "id" || len(a.Files()) != 2 || a.String() != artifact.String() {
+		t.Fatalf("bad cached artifact: %#v", a)
+	}
+}
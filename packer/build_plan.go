@@ -0,0 +1,166 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package packer
+
+import (
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/hcl2helper"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// BuildPlan describes what a build will do once run, with its configuration
+// fully resolved: variables are interpolated, provisioners and
+// post-processors that do not apply to the build (only/except) are left out
+// and overrides are applied.
+type BuildPlan struct {
+	Name        string
+	BuilderType string
+	DependsOn   []string
+	Timeout     time.Duration
+
+	// Config is the configuration of the builder.
+	Config cty.Value
+
+	Provisioners       []ProvisionerPlan
+	CleanupProvisioner *ProvisionerPlan
+	PostProcessors     [][]PostProcessorPlan
+}
+
+// ProvisionerPlan describes a provisioner of a BuildPlan.
+type ProvisionerPlan struct {
+	Type string
+	Name string
+
+	// Config is the configuration of the provisioner, with the override for
+	// the build applied.
+	Config cty.Value
+
+	PauseBefore time.Duration
+	Timeout     time.Duration
+	MaxRetries  int
+
+	// Parallel lists the provisioners of a group of provisioners running
+	// concurrently, at most Concurrency at a time.
+	Parallel    []ProvisionerPlan
+	Concurrency int
+}
+
+// PostProcessorPlan describes a post-processor of a BuildPlan.
+type PostProcessorPlan struct {
+	Type   string
+	Name   string
+	Config cty.Value
+
+	// KeepInputArtifact is nil when it is not set in the template, the
+	// post-processor then decides whether to keep its input artifact.
+	KeepInputArtifact *bool
+}
+
+// An overriddenProvisioner is a provisioner that has an override configured
+// for the build it is part of.
+type overriddenProvisioner interface {
+	Override() map[string]interface{}
+}
+
+// Plan describes what b will do once run.
+func (b *CoreBuild) Plan() *BuildPlan {
+	plan := &BuildPlan{
+		Name:        b.Name(),
+		BuilderType: b.builderType(),
+		DependsOn:   b.DependsOn,
+		Timeout:     b.Timeout,
+		Config:      b.HCLConfig,
+	}
+	if b.BuilderConfig != nil {
+		plan.Config = hcl2helper.HCL2ValueFromConfigValue(b.BuilderConfig)
+	}
+
+	for _, p := range b.Provisioners {
+		plan.Provisioners = append(plan.Provisioners, p.plan())
+	}
+	if b.CleanupProvisioner.PType != "" {
+		cleanup := b.CleanupProvisioner.plan()
+		plan.CleanupProvisioner = &cleanup
+	}
+
+	for _, ppSeq := range b.PostProcessors {
+		var seq []PostProcessorPlan
+		for _, pp := range ppSeq {
+			ppPlan := PostProcessorPlan{
+				Type:              pp.PType,
+				Name:              pp.PName,
+				Config:            pp.HCLConfig,
+				KeepInputArtifact: pp.KeepInputArtifact,
+			}
+			if pp.config != nil {
+				ppPlan.Config = hcl2helper.HCL2ValueFromConfigValue(pp.config)
+			}
+			seq = append(seq, ppPlan)
+		}
+		plan.PostProcessors = append(plan.PostProcessors, seq)
+	}
+
+	return plan
+}
+
+func (p *CoreBuildProvisioner) plan() ProvisionerPlan {
+	plan := ProvisionerPlan{
+		Type:   p.PType,
+		Name:   p.PName,
+		Config: p.HCLConfig,
+	}
+
+	var override map[string]interface{}
+	if len(p.config) > 0 {
+		// JSON templates: the configuration comes first, then the override
+		// for the build, if any.
+		plan.Config = hcl2helper.HCL2ValueFromConfigValue(p.config[0])
+		if len(p.config) > 1 {
+			override, _ = p.config[1].(map[string]interface{})
+		}
+	}
+
+	// Unwrap the provisioner to find out how it is run.
+	provisioner := p.Provisioner
+	for provisioner != nil {
+		switch wrapped := provisioner.(type) {
+		case *PausedProvisioner:
+			plan.PauseBefore = wrapped.PauseBefore
+			provisioner = wrapped.Provisioner
+		case *TimeoutProvisioner:
+			plan.Timeout = wrapped.Timeout
+			provisioner = wrapped.Provisioner
+		case *RetriedProvisioner:
+			plan.MaxRetries = wrapped.MaxRetries
+			provisioner = wrapped.Provisioner
+		case *DebuggedProvisioner:
+			provisioner = wrapped.Provisioner
+		case *ParallelProvisionHook:
+			plan.Concurrency = wrapped.Concurrency
+			for _, p := range wrapped.Provisioners {
+				plan.Parallel = append(plan.Parallel, p.plan())
+			}
+			provisioner = nil
+		case overriddenProvisioner:
+			override = wrapped.Override()
+			provisioner = nil
+		default:
+			provisioner = nil
+		}
+	}
+
+	if len(override) > 0 && !plan.Config.IsNull() && plan.Config.IsKnown() && plan.Config.Type().IsObjectType() {
+		attrs := plan.Config.AsValueMap()
+		if attrs == nil {
+			attrs = map[string]cty.Value{}
+		}
+		for k, v := range override {
+			attrs[k] = hcl2helper.HCL2ValueFromConfigValue(v)
+		}
+		plan.Config = cty.ObjectVal(attrs)
+	}
+
+	return plan
+}
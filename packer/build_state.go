@@ -0,0 +1,298 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// ResumableBuilderVar is the generated variable a builder declares, in the
+// variables returned by its Prepare, when it re-attaches to an already
+// existing machine instead of creating a fresh one on each run. Only those
+// builders can resume the instance a previous run left behind, and therefore
+// safely skip the steps that already completed on it; with any other builder,
+// -resume records the progress of the build but runs every step again.
+//
+// Builders run as plugins can only tell their capabilities through Prepare,
+// which is why this is a generated variable rather than an interface.
+const ResumableBuilderVar = "PackerResumable"
+
+// ResumableGeneratedVars returns the generatedVars a builder returned from
+// Prepare, except for ResumableBuilderVar, and whether the builder declared
+// it.
+func ResumableGeneratedVars(generatedVars []string) ([]string, bool) {
+	var vars []string
+	resumable := false
+	for _, v := range generatedVars {
+		if v == ResumableBuilderVar {
+			resumable = true
+			continue
+		}
+		vars = append(vars, v)
+	}
+	return vars, resumable
+}
+
+// BuildStateFile is the on-disk record of the progress of the builds of a
+// `packer build -resume=<state>` run.
+//
+// Each provisioner and post-processor sequence that completes is recorded in
+// it as soon as it finishes, so that a build that died halfway through can be
+// resumed without running those steps again.
+type BuildStateFile struct {
+	Builds map[string]*BuildState `json:"builds"`
+
+	path string
+	l    sync.Mutex
+}
+
+// BuildState records the provisioners and post-processor sequences of a single
+// build that completed.
+type BuildState struct {
+	Provisioners   []CompletedStep `json:"provisioners,omitempty"`
+	PostProcessors []CompletedStep `json:"post_processors,omitempty"`
+
+	file *BuildStateFile
+}
+
+// CompletedStep identifies a step of a build. The type is recorded alongside
+// the index so that a template change in between two runs does not make us
+// skip the wrong step.
+type CompletedStep struct {
+	Index int    `json:"index"`
+	Type  string `json:"type"`
+
+	// Artifacts are the artifacts produced by a post-processor sequence,
+	// replayed when the sequence is skipped.
+	Artifacts []*RecordedArtifact `json:"artifacts,omitempty"`
+	// KeepInputArtifact tells whether a post-processor sequence kept the
+	// artifact of the builder.
+	KeepInputArtifact bool `json:"keep_input_artifact,omitempty"`
+}
+
+// RecordedArtifact is an artifact produced in a previous run, as recorded in
+// the state file.
+type RecordedArtifact struct {
+	BuilderID   string   `json:"builder_id"`
+	ID          string   `json:"id"`
+	FileNames   []string `json:"files,omitempty"`
+	Description string   `json:"description"`
+}
+
+var _ packersdk.Artifact = new(RecordedArtifact)
+
+func recordArtifact(a packersdk.Artifact) *RecordedArtifact {
+	return &RecordedArtifact{
+		BuilderID:   a.BuilderId(),
+		ID:          a.Id(),
+		FileNames:   a.Files(),
+		Description: a.String(),
+	}
+}
+
+func (a *RecordedArtifact) BuilderId() string { return a.BuilderID }
+func (a *RecordedArtifact) Files() []string   { return a.FileNames }
+func (a *RecordedArtifact) Id() string        { return a.ID }
+func (a *RecordedArtifact) String() string    { return a.Description }
+
+// State returns nil, the state of an artifact is not recorded.
+func (a *RecordedArtifact) State(name string) interface{} { return nil }
+
+// Destroy fails: only the post-processor that produced the artifact knows
+// how to destroy it, and it did not run in this run.
+func (a *RecordedArtifact) Destroy() error {
+	return fmt.Errorf("artifact %q was recorded by a previous run, it must be destroyed manually", a.ID)
+}
+
+// LoadBuildStateFile reads the state file at path. A missing file is not an
+// error: it is what the first run of a resumable build looks like.
+func LoadBuildStateFile(path string) (*BuildStateFile, error) {
+	f := &BuildStateFile{
+		Builds: map[string]*BuildState{},
+		path:   path,
+	}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, f); err != nil {
+		return nil, fmt.Errorf("failed to decode build state file %q: %s", path, err)
+	}
+	if f.Builds == nil {
+		f.Builds = map[string]*BuildState{}
+	}
+	for _, state := range f.Builds {
+		state.file = f
+	}
+	return f, nil
+}
+
+// Build returns the state of the named build, creating it if needed.
+func (f *BuildStateFile) Build(name string) *BuildState {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	state, ok := f.Builds[name]
+	if !ok {
+		state = &BuildState{file: f}
+		f.Builds[name] = state
+	}
+	return state
+}
+
+// Forget removes the named build from the state file, this is done once a
+// build completed successfully so that the next run starts from scratch.
+func (f *BuildStateFile) Forget(name string) error {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	delete(f.Builds, name)
+	return f.save()
+}
+
+// save writes the state file to disk; f.l must be held by the caller.
+func (f *BuildStateFile) save() error {
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that an interruption cannot leave
+	// us with a truncated state file.
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+// ProvisionerDone tells whether provisioner i of type pType completed in a
+// previous run. It is safe to call on a nil BuildState.
+func (s *BuildState) ProvisionerDone(i int, pType string) bool {
+	if s == nil {
+		return false
+	}
+	s.file.l.Lock()
+	defer s.file.l.Unlock()
+	return hasCompletedStep(s.Provisioners, i, pType)
+}
+
+// PostProcessorsDone tells whether post-processor sequence i, made of the
+// pTypes post-processors, completed in a previous run. It is safe to call on
+// a nil BuildState.
+func (s *BuildState) PostProcessorsDone(i int, pTypes []string) bool {
+	if s == nil {
+		return false
+	}
+	s.file.l.Lock()
+	defer s.file.l.Unlock()
+	return hasCompletedStep(s.PostProcessors, i, strings.Join(pTypes, ","))
+}
+
+// SetProvisionerDone records that provisioner i of type pType completed, and
+// persists the state file.
+func (s *BuildState) SetProvisionerDone(i int, pType string) {
+	if s == nil {
+		return
+	}
+	s.file.l.Lock()
+	defer s.file.l.Unlock()
+	s.Provisioners = append(s.Provisioners, CompletedStep{Index: i, Type: pType})
+	if err := s.file.save(); err != nil {
+		log.Printf("[WARN] failed to save build state file: %s", err)
+	}
+}
+
+// PostProcessorsArtifacts returns the artifacts produced by post-processor
+// sequence i, made of the pTypes post-processors, in a previous run, and
+// whether it kept the artifact of the builder. It is safe to call on a nil
+// BuildState.
+func (s *BuildState) PostProcessorsArtifacts(i int, pTypes []string) ([]packersdk.Artifact, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.file.l.Lock()
+	defer s.file.l.Unlock()
+	for _, step := range s.PostProcessors {
+		if step.Index != i || step.Type != strings.Join(pTypes, ",") {
+			continue
+		}
+		artifacts := make([]packersdk.Artifact, len(step.Artifacts))
+		for j, a := range step.Artifacts {
+			artifacts[j] = a
+		}
+		return artifacts, step.KeepInputArtifact
+	}
+	return nil, false
+}
+
+// SetPostProcessorsDone records that post-processor sequence i, made of the
+// pTypes post-processors, completed with artifacts, keeping the artifact of
+// the builder or not, and persists the state file.
+func (s *BuildState) SetPostProcessorsDone(i int, pTypes []string, artifacts []packersdk.Artifact, keepInputArtifact bool) {
+	if s == nil {
+		return
+	}
+	step := CompletedStep{
+		Index:             i,
+		Type:              strings.Join(pTypes, ","),
+		KeepInputArtifact: keepInputArtifact,
+	}
+	for _, a := range artifacts {
+		if a != nil {
+			step.Artifacts = append(step.Artifacts, recordArtifact(a))
+		}
+	}
+	s.file.l.Lock()
+	defer s.file.l.Unlock()
+	s.PostProcessors = append(s.PostProcessors, step)
+	if err := s.file.save(); err != nil {
+		log.Printf("[WARN] failed to save build state file: %s", err)
+	}
+}
+
+// Empty tells whether nothing was recorded for this build yet.
+func (s *BuildState) Empty() bool {
+	if s == nil {
+		return true
+	}
+	s.file.l.Lock()
+	defer s.file.l.Unlock()
+	return len(s.Provisioners) == 0 && len(s.PostProcessors) == 0
+}
+
+// Reset clears everything recorded for this build.
+func (s *BuildState) Reset() {
+	if s == nil {
+		return
+	}
+	s.file.l.Lock()
+	defer s.file.l.Unlock()
+	s.Provisioners = nil
+	s.PostProcessors = nil
+	if err := s.file.save(); err != nil {
+		log.Printf("[WARN] failed to save build state file: %s", err)
+	}
+}
+
+func hasCompletedStep(steps []CompletedStep, i int, pType string) bool {
+	for _, step := range steps {
+		if step.Index == i && step.Type == pType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package packer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestBuildStateFile_roundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	f, err := LoadBuildStateFile(path)
+	if err != nil {
+		t.Fatalf("loading a missing state file should not fail: %s", err)
+	}
+	f.Build("null.test").SetProvisionerDone(0, "shell")
+	f.Build("null.test").SetPostProcessorsDone(1, []string{"compress", "manifest"}, []packersdk.Artifact{
+		&packersdk.MockArtifact{BuilderIdValue: "compress", IdValue: "archive.tar.gz"},
+	}, true)
+
+	f, err = LoadBuildStateFile(path)
+	if err != nil {
+		t.Fatalf("failed to load state file: %s", err)
+	}
+	state := f.Build("null.test")
+	if !state.ProvisionerDone(0, "shell") {
+		t.Fatal("provisioner 0 should be done")
+	}
+	if state.ProvisionerDone(0, "file") {
+		t.Fatal("provisioner 0 is a shell provisioner, not a file one")
+	}
+	if !state.PostProcessorsDone(1, []string{"compress", "manifest"}) {
+		t.Fatal("post-processors 1 should be done")
+	}
+	artifacts, keepInput := state.PostProcessorsArtifacts(1, []string{"compress", "manifest"})
+	if len(artifacts) != 1 || artifacts[0].Id() != "archive.tar.gz" || artifacts[0].BuilderId() != "compress" {
+		t.Fatalf("the artifacts of post-processors 1 should be replayed, got %#v", artifacts)
+	}
+	if !keepInput {
+		t.Fatal("post-processors 1 kept the artifact of the builder")
+	}
+	if err := artifacts[0].Destroy(); err == nil {
+		t.Fatal("a replayed artifact cannot be destroyed")
+	}
+
+	if err := f.Forget("null.test"); err != nil {
+		t.Fatalf("failed to forget build: %s", err)
+	}
+	f, err = LoadBuildStateFile(path)
+	if err != nil {
+		t.Fatalf("failed to load state file: %s", err)
+	}
+	if !f.Build("null.test").Empty() {
+		t.Fatal("forgotten build should be empty")
+	}
+}
+
+func TestProvisionHook_resume(t *testing.T) {
+	f, err := LoadBuildStateFile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	state := f.Build("null.test")
+	state.SetProvisionerDone(0, "shell")
+
+	pA := &packersdk.MockProvisioner{}
+	pB := &packersdk.MockProvisioner{}
+	hook := &ProvisionHook{
+		Provisioners: []*HookedProvisioner{
+			{pA, nil, "shell"},
+			{pB, nil, "shell"},
+		},
+		State: state,
+	}
+
+	err = hook.Run(context.Background(), "foo", testUi(), new(packersdk.MockCommunicator), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if pA.ProvCalled {
+		t.Error("provision should not be called on pA, it already completed")
+	}
+	if !pB.ProvCalled {
+		t.Error("provision should be called on pB")
+	}
+	if !state.ProvisionerDone(1, "shell") {
+		t.Error("pB should now be recorded as done")
+	}
+}
+
+func TestCoreBuild_Prepare_resumable(t *testing.T) {
+	for _, tc := range []struct {
+		generatedVars []string
+		resumable     bool
+	}{
+		{generatedVars: nil, resumable: false},
+		{generatedVars: []string{"ID"}, resumable: false},
+		{generatedVars: []string{"ID", ResumableBuilderVar}, resumable: true},
+	} {
+		build := testBuild()
+		build.Builder = &packersdk.MockBuilder{GeneratedVars: tc.generatedVars}
+		if _, err := build.Prepare(); err != nil {
+			t.Fatalf("unexpected prepare error: %s", err)
+		}
+		if build.canResume() != tc.resumable {
+			t.Errorf("generated variables %v: expected resumable to be %t", tc.generatedVars, tc.resumable)
+		}
+	}
+}
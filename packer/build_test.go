@@ -5,8 +5,10 @@ package packer
 
 import (
 	"context"
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -467,6 +469,92 @@ func TestBuild_Run_Artifacts(t *testing.T) {
 	}
 }
 
+// conditionalPostProcessor is a MockPostProcessor only running when run is
+// set.
+type conditionalPostProcessor struct {
+	MockPostProcessor
+	run bool
+}
+
+func (pp *conditionalPostProcessor) ShouldRun(packersdk.Artifact) (bool, error) {
+	return pp.run, nil
+}
+
+func TestBuild_Run_ConditionalPostProcessors(t *testing.T) {
+	skipped := &conditionalPostProcessor{MockPostProcessor: MockPostProcessor{ArtifactId: "skipped"}}
+	pp := &conditionalPostProcessor{MockPostProcessor: MockPostProcessor{ArtifactId: "pp"}, run: true}
+
+	build := testBuild()
+	build.PostProcessors = [][]CoreBuildPostProcessor{
+		{
+			{skipped, "skipped", "skipped", cty.Value{}, nil, nil},
+			{pp, "pp", "pp", cty.Value{}, nil, boolPointer(false)},
+		},
+		{
+			{skipped, "skipped", "skipped", cty.Value{}, nil, nil},
+		},
+	}
+
+	build.Prepare()
+	artifacts, err := build.Run(context.Background(), testUi())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if skipped.PostProcessCalled {
+		t.Fatal("post-processor should have been skipped")
+	}
+	if pp.PostProcessArtifact.Id() != "b" {
+		t.Fatalf("post-processor should process the builder artifact, got %q", pp.PostProcessArtifact.Id())
+	}
+
+	// The original artifact is kept, as it is the result of the second
+	// sequence, in which no post-processor ran.
+	expectedIds := []string{"b", "pp"}
+	artifactIds := make([]string, len(artifacts))
+	for i, artifact := range artifacts {
+		artifactIds[i] = artifact.Id()
+	}
+	if !reflect.DeepEqual(artifactIds, expectedIds) {
+		t.Fatalf("unexpected ids: %#v", artifactIds)
+	}
+}
+
+func TestBuild_Run_Timeout(t *testing.T) {
+	build := testBuild()
+	build.Timeout = 10 * time.Millisecond
+	prov := build.Provisioners[0].Provisioner.(*packersdk.MockProvisioner)
+	prov.ProvFunc = func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	builder := build.Builder.(*packersdk.MockBuilder)
+	var builderCtx context.Context
+	builder.RunFn = func(ctx context.Context) {
+		builderCtx = ctx
+	}
+
+	build.Prepare()
+	_, err := build.Run(context.Background(), testUi())
+
+	var timeoutErr *BuildTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if timeoutErr.Timeout != build.Timeout {
+		t.Fatalf("unexpected timeout: %s", timeoutErr.Timeout)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the provisioner error, got %v", err)
+	}
+	if builderCtx.Err() != context.Canceled {
+		t.Fatalf("the builder should not have been stopped by the deadline, got %v", builderCtx.Err())
+	}
+	if pp := build.PostProcessors[0][0].PostProcessor.(*MockPostProcessor); pp.PostProcessCalled {
+		t.Fatal("post-processors should not run")
+	}
+}
+
 func TestBuild_RunBeforePrepare(t *testing.T) {
 	defer func() {
 		p := recover()
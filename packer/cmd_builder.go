@@ -43,6 +43,12 @@ func (b *cmdBuilder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Ho
 	return b.builder.Run(ctx, ui, hook)
 }
 
+// Close stops the plugin process running the builder.
+func (b *cmdBuilder) Close() error {
+	b.client.Kill()
+	return nil
+}
+
 func (c *cmdBuilder) checkExit(p interface{}, cb func()) {
 	if c.client.Exited() && cb != nil {
 		cb()
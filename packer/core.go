@@ -556,6 +556,11 @@ func (c *Core) EvaluateExpression(line string) (string, bool, hcl.Diagnostics) {
 	}
 }
 
+// EvaluateOutputs returns nothing: JSON templates have no outputs.
+func (c *Core) EvaluateOutputs(map[string][]packersdk.Artifact) ([]Output, hcl.Diagnostics) {
+	return nil, nil
+}
+
 func (c *Core) InspectConfig(opts InspectConfigOptions) int {
 
 	// Convenience...
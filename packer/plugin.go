@@ -18,6 +18,7 @@ import (
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	pluginsdk "github.com/hashicorp/packer-plugin-sdk/plugin"
 	plugingetter "github.com/hashicorp/packer/packer/plugin-getter"
+	"github.com/hashicorp/packer/version"
 )
 
 var defaultChecksummer = plugingetter.Checksummer{
@@ -34,6 +35,10 @@ type PluginConfig struct {
 	Provisioners       ProvisionerSet
 	PostProcessors     PostProcessorSet
 	DataSources        DatasourceSet
+
+	// componentVersions are the versions of the plugins providing each
+	// discovered component, by kind and name.
+	componentVersions map[string]string
 }
 
 // PACKERSPACE is used to represent the spaces that separate args for a command
@@ -182,6 +187,7 @@ func (c *PluginConfig) DiscoverMultiPlugin(pluginName, pluginPath string) error
 		if builderName == pluginsdk.DEFAULT_NAME {
 			key = pluginName
 		}
+		c.setComponentVersion("builder", key, desc.Version)
 		c.Builders.Set(key, func() (packersdk.Builder, error) {
 			return c.Client(pluginPath, "start", "builder", builderName).Builder()
 		})
@@ -197,6 +203,7 @@ func (c *PluginConfig) DiscoverMultiPlugin(pluginName, pluginPath string) error
 		if postProcessorName == pluginsdk.DEFAULT_NAME {
 			key = pluginName
 		}
+		c.setComponentVersion("post-processor", key, desc.Version)
 		c.PostProcessors.Set(key, func() (packersdk.PostProcessor, error) {
 			return c.Client(pluginPath, "start", "post-processor", postProcessorName).PostProcessor()
 		})
@@ -212,6 +219,7 @@ func (c *PluginConfig) DiscoverMultiPlugin(pluginName, pluginPath string) error
 		if provisionerName == pluginsdk.DEFAULT_NAME {
 			key = pluginName
 		}
+		c.setComponentVersion("provisioner", key, desc.Version)
 		c.Provisioners.Set(key, func() (packersdk.Provisioner, error) {
 			return c.Client(pluginPath, "start", "provisioner", provisionerName).Provisioner()
 		})
@@ -226,6 +234,7 @@ func (c *PluginConfig) DiscoverMultiPlugin(pluginName, pluginPath string) error
 		if datasourceName == pluginsdk.DEFAULT_NAME {
 			key = pluginName
 		}
+		c.setComponentVersion("data-source", key, desc.Version)
 		c.DataSources.Set(key, func() (packersdk.Datasource, error) {
 			return c.Client(pluginPath, "start", "datasource", datasourceName).Datasource()
 		})
@@ -237,6 +246,23 @@ func (c *PluginConfig) DiscoverMultiPlugin(pluginName, pluginPath string) error
 	return nil
 }
 
+func (c *PluginConfig) setComponentVersion(kind, name, v string) {
+	if c.componentVersions == nil {
+		c.componentVersions = map[string]string{}
+	}
+	c.componentVersions[kind+"."+name] = v
+}
+
+// ComponentVersion returns the version of the plugin providing the named
+// component of kind builder, provisioner, post-processor or data-source.
+// Components bundled with Packer have the version of Packer.
+func (c *PluginConfig) ComponentVersion(kind, name string) string {
+	if v, ok := c.componentVersions[kind+"."+name]; ok {
+		return v
+	}
+	return version.FormattedVersion()
+}
+
 func (c *PluginConfig) Client(path string, args ...string) *PluginClient {
 	originalPath := path
 
@@ -22,11 +22,36 @@ type HookedProvisioner struct {
 	TypeName    string
 }
 
+// ConditionalProvisioner is implemented by provisioners that only run when a
+// condition is met. The condition is evaluated right before the provisioner
+// would run, with the data generated by the builder, and before any pause or
+// timeout of the provisioner.
+type ConditionalProvisioner interface {
+	ShouldRun(generatedData map[string]interface{}) (bool, error)
+}
+
+// shouldProvision tells whether p should run with generatedData.
+func shouldProvision(p packersdk.Provisioner, generatedData map[string]interface{}) (bool, error) {
+	conditional, ok := p.(ConditionalProvisioner)
+	if !ok {
+		return true, nil
+	}
+	return conditional.ShouldRun(generatedData)
+}
+
 // A Hook implementation that runs the given provisioners.
 type ProvisionHook struct {
 	// The provisioners to run as part of the hook. These should already
 	// be prepared (by calling Prepare) at some earlier stage.
 	Provisioners []*HookedProvisioner
+
+	// State, when set, records the provisioners as they complete.
+	// Provisioners it already knows as completed are skipped.
+	State *BuildState
+
+	// Deadline, when set, is when the provisioners are stopped, their
+	// context being cancelled.
+	Deadline time.Time
 }
 
 // BuilderDataCommonKeys is the list of common keys that all builder will
@@ -105,6 +130,20 @@ func CastDataToMap(data interface{}) map[string]interface{} {
 	return cast
 }
 
+var errNoCommunicator = fmt.Errorf(
+	"No communicator found for provisioners! This is usually because the\n" +
+		"`communicator` config was set to \"none\". If you have any provisioners\n" +
+		"then a communicator is required. Please fix this to continue.")
+
+// hasUi tells whether ui can report the progress of the provisioners: hooks
+// can be run without a ui, which a build wraps in a TargetedUI.
+func hasUi(ui packersdk.Ui) bool {
+	if tu, ok := ui.(*TargetedUI); ok {
+		return tu.Ui != nil
+	}
+	return ui != nil
+}
+
 // Runs the provisioners in order.
 func (h *ProvisionHook) Run(ctx context.Context, name string, ui packersdk.Ui, comm packersdk.Communicator, data interface{}) error {
 	// Shortcut
@@ -113,26 +152,184 @@ func (h *ProvisionHook) Run(ctx context.Context, name string, ui packersdk.Ui, c
 	}
 
 	if comm == nil {
-		return fmt.Errorf(
-			"No communicator found for provisioners! This is usually because the\n" +
-				"`communicator` config was set to \"none\". If you have any provisioners\n" +
-				"then a communicator is required. Please fix this to continue.")
+		return errNoCommunicator
 	}
-	for _, p := range h.Provisioners {
-		ts := CheckpointReporter.AddSpan(p.TypeName, "provisioner", p.Config)
+	if !h.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, h.Deadline)
+		defer cancel()
+	}
+	for i, p := range h.Provisioners {
+		if h.State.ProvisionerDone(i, p.TypeName) {
+			if hasUi(ui) {
+				ui.Say(fmt.Sprintf("Skipping provisioner %s: already completed in a previous run", p.TypeName))
+			}
+			continue
+		}
+		if !h.Deadline.IsZero() && ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("provisioning stopped before the %s provisioner: %w", p.TypeName, ctx.Err())
+		}
 
 		cast := CastDataToMap(data)
-		err := p.Provisioner.Provision(ctx, ui, comm, cast)
+		run, err := shouldProvision(p.Provisioner, cast)
+		if err != nil {
+			return err
+		}
+		if !run {
+			if hasUi(ui) {
+				ui.Say(fmt.Sprintf("Skipping provisioner %s: its condition is not met", p.TypeName))
+			}
+			h.State.SetProvisionerDone(i, p.TypeName)
+			continue
+		}
+
+		if hasUi(ui) {
+			ui.Machine("provisioner-start", p.TypeName)
+		}
+		start := time.Now()
+		ts := CheckpointReporter.AddSpan(p.TypeName, "provisioner", p.Config)
+
+		err = p.Provisioner.Provision(ctx, ui, comm, cast)
 
 		ts.End(err)
+		if hasUi(ui) {
+			ui.Machine("provisioner-end", p.TypeName, machineDuration(time.Since(start)), machineError(err))
+		}
 		if err != nil {
 			return err
 		}
+		h.State.SetProvisionerDone(i, p.TypeName)
 	}
 
 	return nil
 }
 
+// ParallelProvisionHook is a Hook implementation that runs the given
+// provisioners concurrently, over the same communicator. The first
+// provisioner to fail cancels the others, through their context.
+//
+// It is also a Provisioner, so that a group of provisioners running
+// concurrently can be one of the provisioners of a ProvisionHook.
+type ParallelProvisionHook struct {
+	// The provisioners to run as part of the hook.
+	Provisioners []CoreBuildProvisioner
+
+	// Concurrency is the maximum number of provisioners running at the same
+	// time, 0 means no limit.
+	Concurrency int
+}
+
+var _ packersdk.Hook = new(ParallelProvisionHook)
+var _ packersdk.Provisioner = new(ParallelProvisionHook)
+
+func (h *ParallelProvisionHook) ConfigSpec() hcldec.ObjectSpec { return hcldec.ObjectSpec{} }
+
+// Prepare prepares each of the provisioners with raws, after their own
+// configuration.
+func (h *ParallelProvisionHook) Prepare(raws ...interface{}) error {
+	for _, p := range h.Provisioners {
+		configs := make([]interface{}, len(p.config), len(p.config)+len(raws))
+		copy(configs, p.config)
+		configs = append(configs, raws...)
+		if err := p.Provisioner.Prepare(configs...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *ParallelProvisionHook) Provision(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, generatedData map[string]interface{}) error {
+	return h.Run(ctx, packersdk.HookProvision, ui, comm, generatedData)
+}
+
+// Runs the provisioners concurrently.
+func (h *ParallelProvisionHook) Run(ctx context.Context, name string, ui packersdk.Ui, comm packersdk.Communicator, data interface{}) error {
+	if len(h.Provisioners) == 0 {
+		return nil
+	}
+	if comm == nil {
+		return errNoCommunicator
+	}
+
+	buildCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := h.Concurrency
+	if concurrency <= 0 || concurrency > len(h.Provisioners) {
+		concurrency = len(h.Provisioners)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	cast := CastDataToMap(data)
+	for _, p := range h.Provisioners {
+		p := p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			pName := p.PName
+			if pName == "" {
+				pName = p.PType
+			}
+			pUi := &prefixedUi{Prefix: pName, Ui: ui}
+
+			run, err := shouldProvision(p.Provisioner, cast)
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("%s: %w", pName, err)
+					cancel()
+				})
+				return
+			}
+			if !run {
+				pUi.Say(fmt.Sprintf("Skipping provisioner %s: its condition is not met", p.PType))
+				return
+			}
+
+			var pConfig interface{}
+			if len(p.config) > 0 {
+				pConfig = p.config[0]
+			} else {
+				pConfig = p.HCLConfig
+			}
+
+			pUi.Machine("provisioner-start", p.PType)
+			start := time.Now()
+			ts := CheckpointReporter.AddSpan(p.PType, "provisioner", pConfig)
+			err = p.Provisioner.Provision(ctx, pUi, comm, cast)
+			ts.End(err)
+			pUi.Machine("provisioner-end", p.PType, machineDuration(time.Since(start)), machineError(err))
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("%s: %w", pName, err)
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr == nil {
+		// When the build was cancelled, some of the provisioners may not
+		// have run.
+		return buildCtx.Err()
+	}
+	return firstErr
+}
+
 // PausedProvisioner is a Provisioner implementation that pauses before
 // the provisioner is actually run.
 type PausedProvisioner struct {
@@ -146,6 +343,10 @@ func (p *PausedProvisioner) Prepare(raws ...interface{}) error {
 	return p.Provisioner.Prepare(raws...)
 }
 
+func (p *PausedProvisioner) ShouldRun(generatedData map[string]interface{}) (bool, error) {
+	return shouldProvision(p.Provisioner, generatedData)
+}
+
 func (p *PausedProvisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, generatedData map[string]interface{}) error {
 
 	// Use a select to determine if we get cancelled during the wait
@@ -164,6 +365,9 @@ func (p *PausedProvisioner) Provision(ctx context.Context, ui packersdk.Ui, comm
 type RetriedProvisioner struct {
 	MaxRetries  int
 	Provisioner packersdk.Provisioner
+	// Retry, when set, tells which errors are retried and how long to wait
+	// before each retry; otherwise all errors are retried immediately.
+	Retry *RetryPolicy
 }
 
 func (r *RetriedProvisioner) ConfigSpec() hcldec.ObjectSpec { return r.ConfigSpec() }
@@ -172,6 +376,10 @@ func (r *RetriedProvisioner) Prepare(raws ...interface{}) error {
 	return r.Provisioner.Prepare(raws...)
 }
 
+func (r *RetriedProvisioner) ShouldRun(generatedData map[string]interface{}) (bool, error) {
+	return shouldProvision(r.Provisioner, generatedData)
+}
+
 func (r *RetriedProvisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, generatedData map[string]interface{}) error {
 	if ctx.Err() != nil { // context was cancelled
 		return ctx.Err()
@@ -182,15 +390,21 @@ func (r *RetriedProvisioner) Provision(ctx context.Context, ui packersdk.Ui, com
 		return nil
 	}
 
-	leftTries := r.MaxRetries
-	for ; leftTries > 0; leftTries-- {
+	for attempt := 0; attempt < r.MaxRetries; attempt++ {
 		if ctx.Err() != nil { // context was cancelled
 			return ctx.Err()
 		}
+		if !r.Retry.ShouldRetry(err) {
+			ui.Say(fmt.Sprintf("Provisioner failed with %q, which is not retried", err))
+			return err
+		}
 
-		ui.Say(fmt.Sprintf("Provisioner failed with %q, retrying with %d trie(s) left", err, leftTries))
+		ui.Say(fmt.Sprintf("Provisioner failed with %q, retrying with %d trie(s) left", err, r.MaxRetries-attempt))
+		if err := r.Retry.wait(ctx, ui, attempt); err != nil {
+			return err
+		}
 
-		err := r.Provisioner.Provision(ctx, ui, comm, generatedData)
+		err = r.Provisioner.Provision(ctx, ui, comm, generatedData)
 		if err == nil {
 			return nil
 		}
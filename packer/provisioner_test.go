@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -47,6 +48,42 @@ func TestProvisionHook(t *testing.T) {
 	}
 }
 
+// conditionalProvisioner is a MockProvisioner only running when run is set.
+type conditionalProvisioner struct {
+	packersdk.MockProvisioner
+	run bool
+}
+
+func (p *conditionalProvisioner) ShouldRun(map[string]interface{}) (bool, error) {
+	return p.run, nil
+}
+
+func TestProvisionHook_condition(t *testing.T) {
+	skipped := &conditionalProvisioner{}
+	p := &conditionalProvisioner{run: true}
+
+	hook := &ProvisionHook{
+		Provisioners: []*HookedProvisioner{
+			// The condition is evaluated before pausing, a skipped
+			// provisioner does not pause the build.
+			{&PausedProvisioner{PauseBefore: time.Hour, Provisioner: skipped}, nil, "skipped"},
+			{&RetriedProvisioner{MaxRetries: 1, Provisioner: &TimeoutProvisioner{Timeout: time.Hour, Provisioner: p}}, nil, "p"},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := hook.Run(ctx, "foo", testUi(), new(packersdk.MockCommunicator), nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if skipped.ProvCalled {
+		t.Error("the provisioner whose condition is not met should be skipped")
+	}
+	if !p.ProvCalled {
+		t.Error("the provisioner whose condition is met should run")
+	}
+}
+
 func TestProvisionHook_nilComm(t *testing.T) {
 	pA := &packersdk.MockProvisioner{}
 	pB := &packersdk.MockProvisioner{}
@@ -91,6 +128,92 @@ func TestProvisionHook_cancel(t *testing.T) {
 	}
 }
 
+func TestParallelProvisionHook(t *testing.T) {
+	var running, maxRunning int32
+	provFunc := func(ctx context.Context) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			prev := atomic.LoadInt32(&maxRunning)
+			if n <= prev || atomic.CompareAndSwapInt32(&maxRunning, prev, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+
+	var provisioners []CoreBuildProvisioner
+	for i := 0; i < 4; i++ {
+		provisioners = append(provisioners, CoreBuildProvisioner{
+			PType:       "mock",
+			Provisioner: &packersdk.MockProvisioner{ProvFunc: provFunc},
+		})
+	}
+	hook := &ParallelProvisionHook{
+		Provisioners: provisioners,
+		Concurrency:  2,
+	}
+
+	err := hook.Run(context.Background(), "foo", testUi(), new(packersdk.MockCommunicator), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i, p := range provisioners {
+		if !p.Provisioner.(*packersdk.MockProvisioner).ProvCalled {
+			t.Errorf("provision should be called on provisioner %d", i)
+		}
+	}
+	if maxRunning > 2 {
+		t.Fatalf("expected at most 2 provisioners running at the same time, got %d", maxRunning)
+	}
+}
+
+func TestParallelProvisionHook_firstError(t *testing.T) {
+	pA := &packersdk.MockProvisioner{
+		ProvFunc: func(context.Context) error {
+			return errors.New("failed")
+		},
+	}
+	pB := &packersdk.MockProvisioner{
+		ProvFunc: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	hook := &ParallelProvisionHook{
+		Provisioners: []CoreBuildProvisioner{
+			{PType: "a", Provisioner: pA},
+			{PType: "b", Provisioner: pB},
+		},
+	}
+
+	err := hook.Run(context.Background(), "foo", testUi(), new(packersdk.MockCommunicator), nil)
+	if err == nil || err.Error() != "a: failed" {
+		t.Fatalf("expected the error of the first failing provisioner, got %v", err)
+	}
+}
+
+func TestParallelProvisionHook_cancelled(t *testing.T) {
+	p := &packersdk.MockProvisioner{}
+	hook := &ParallelProvisionHook{
+		Provisioners: []CoreBuildProvisioner{
+			{PType: "mock", Provisioner: p},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := hook.Run(ctx, "foo", testUi(), new(packersdk.MockCommunicator), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancellation error, got %v", err)
+	}
+	if p.ProvCalled {
+		t.Fatal("provision should not be called once the build is cancelled")
+	}
+}
+
 // TODO(mitchellh): Test that they're run in the proper order
 
 func TestPausedProvisioner_impl(t *testing.T) {
@@ -18,6 +18,10 @@ type TimeoutProvisioner struct {
 	Timeout time.Duration
 }
 
+func (p *TimeoutProvisioner) ShouldRun(generatedData map[string]interface{}) (bool, error) {
+	return shouldProvision(p.Provisioner, generatedData)
+}
+
 func (p *TimeoutProvisioner) Provision(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator, generatedData map[string]interface{}) error {
 	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
 	defer cancel()
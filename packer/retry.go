@@ -0,0 +1,149 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package packer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// RetryPolicy tells which errors of a provisioner or post-processor are worth
+// a retry, and how long to wait before each retry.
+type RetryPolicy struct {
+	// RetryOn, when set, restricts retries to the errors matching one of
+	// these expressions.
+	RetryOn []*regexp.Regexp
+	// NoRetryOn lists the errors that are never retried, even when they
+	// match RetryOn.
+	NoRetryOn []*regexp.Regexp
+
+	// InitialBackoff is the delay before the first retry; each following
+	// delay is Multiplier times longer, up to MaxBackoff when set.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomizes each delay by up to this fraction of it, so that
+	// builds failing together do not all retry at the same time.
+	Jitter float64
+}
+
+// ShouldRetry tells whether err is worth a retry. It is safe to call on a nil
+// RetryPolicy, which retries all errors.
+func (p *RetryPolicy) ShouldRetry(err error) bool {
+	if p == nil {
+		return true
+	}
+	msg := err.Error()
+	for _, re := range p.NoRetryOn {
+		if re.MatchString(msg) {
+			return false
+		}
+	}
+	if len(p.RetryOn) == 0 {
+		return true
+	}
+	for _, re := range p.RetryOn {
+		if re.MatchString(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns how long to wait before retry number attempt, starting at
+// 0. It is safe to call on a nil RetryPolicy, which retries immediately.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	if p == nil || p.InitialBackoff <= 0 {
+		return 0
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(backoff)
+}
+
+// wait sleeps before retry number attempt, returning early with an error when
+// ctx is cancelled.
+func (p *RetryPolicy) wait(ctx context.Context, ui packersdk.Ui, attempt int) error {
+	backoff := p.Backoff(attempt)
+	if backoff <= 0 {
+		return ctx.Err()
+	}
+	ui.Say(fmt.Sprintf("Waiting %s before retrying...", backoff.Round(time.Millisecond)))
+	select {
+	case <-time.After(backoff):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RetriedPostProcessor is a PostProcessor implementation that retries the
+// post-processor whenever there's an error.
+type RetriedPostProcessor struct {
+	MaxRetries    int
+	Retry         *RetryPolicy
+	PostProcessor packersdk.PostProcessor
+}
+
+var _ packersdk.PostProcessor = new(RetriedPostProcessor)
+var _ ConditionalPostProcessor = new(RetriedPostProcessor)
+
+func (r *RetriedPostProcessor) ConfigSpec() hcldec.ObjectSpec {
+	return r.PostProcessor.ConfigSpec()
+}
+
+func (r *RetriedPostProcessor) Configure(raws ...interface{}) error {
+	return r.PostProcessor.Configure(raws...)
+}
+
+func (r *RetriedPostProcessor) ShouldRun(artifact packersdk.Artifact) (bool, error) {
+	if conditional, ok := r.PostProcessor.(ConditionalPostProcessor); ok {
+		return conditional.ShouldRun(artifact)
+	}
+	return true, nil
+}
+
+func (r *RetriedPostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifact packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	if ctx.Err() != nil { // context was cancelled
+		return nil, false, false, ctx.Err()
+	}
+
+	result, keep, forceOverride, err := r.PostProcessor.PostProcess(ctx, ui, artifact)
+	for attempt := 0; err != nil && attempt < r.MaxRetries; attempt++ {
+		if ctx.Err() != nil { // context was cancelled
+			return nil, false, false, ctx.Err()
+		}
+		if !r.Retry.ShouldRetry(err) {
+			ui.Say(fmt.Sprintf("Post-processor failed with %q, which is not retried", err))
+			return result, keep, forceOverride, err
+		}
+
+		ui.Say(fmt.Sprintf("Post-processor failed with %q, retrying with %d trie(s) left", err, r.MaxRetries-attempt))
+		if err := r.Retry.wait(ctx, ui, attempt); err != nil {
+			return nil, false, false, err
+		}
+		result, keep, forceOverride, err = r.PostProcessor.PostProcess(ctx, ui, artifact)
+	}
+	if err != nil && r.MaxRetries > 0 {
+		ui.Say("retry limit reached.")
+	}
+
+	return result, keep, forceOverride, err
+}
@@ -0,0 +1,95 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package packer
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// flakyPostProcessor fails with err for its first failures calls.
+type flakyPostProcessor struct {
+	MockPostProcessor
+	failures int
+	err      error
+	calls    int
+}
+
+func (pp *flakyPostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, a packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	pp.calls++
+	if pp.calls <= pp.failures {
+		return nil, false, false, pp.err
+	}
+	return pp.MockPostProcessor.PostProcess(ctx, ui, a)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	var nilPolicy *RetryPolicy
+	if nilPolicy.Backoff(3) != 0 {
+		t.Fatal("a nil policy should retry immediately")
+	}
+
+	p := &RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+	}
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		if got := p.Backoff(attempt); got != expected {
+			t.Errorf("attempt %d: expected %s, got %s", attempt, expected, got)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		if got := p.Backoff(0); got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Fatalf("jittered backoff out of range: %s", got)
+		}
+	}
+}
+
+func TestRetriedPostProcessor(t *testing.T) {
+	pp := &flakyPostProcessor{
+		failures: 2,
+		err:      errors.New("RequestLimitExceeded"),
+	}
+	retried := &RetriedPostProcessor{
+		MaxRetries:    2,
+		Retry:         &RetryPolicy{RetryOn: []*regexp.Regexp{regexp.MustCompile("LimitExceeded")}},
+		PostProcessor: pp,
+	}
+
+	_, _, _, err := retried.PostProcess(context.Background(), testUi(), new(packersdk.MockArtifact))
+	if err != nil {
+		t.Fatalf("should have succeeded after retries: %s", err)
+	}
+	if pp.calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", pp.calls)
+	}
+}
+
+func TestRetriedPostProcessor_noRetryOn(t *testing.T) {
+	pp := &flakyPostProcessor{
+		failures: 1,
+		err:      errors.New("invalid configuration"),
+	}
+	retried := &RetriedPostProcessor{
+		MaxRetries:    3,
+		Retry:         &RetryPolicy{NoRetryOn: []*regexp.Regexp{regexp.MustCompile("invalid")}},
+		PostProcessor: pp,
+	}
+
+	_, _, _, err := retried.PostProcess(context.Background(), testUi(), new(packersdk.MockArtifact))
+	if err == nil {
+		t.Fatal("should have failed without retrying")
+	}
+	if pp.calls != 1 {
+		t.Fatalf("expected a single call, got %d", pp.calls)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	hcl "github.com/hashicorp/hcl/v2"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	plugingetter "github.com/hashicorp/packer/packer/plugin-getter"
+	"github.com/zclconf/go-cty/cty"
 )
 
 type GetBuildsOptions struct {
@@ -34,10 +35,32 @@ type Evaluator interface {
 	EvaluateExpression(expr string) (output string, exit bool, diags hcl.Diagnostics)
 }
 
+// Output is the value of an output block, evaluated once the builds
+// completed.
+type Output struct {
+	Name        string
+	Description string
+	// Sensitive outputs are not shown in the build output.
+	Sensitive bool
+	Value     cty.Value
+}
+
+type OutputEvaluator interface {
+	// EvaluateOutputs evaluates the outputs of a config with the artifacts of
+	// the builds that completed, by build name.
+	EvaluateOutputs(artifacts map[string][]packersdk.Artifact) ([]Output, hcl.Diagnostics)
+}
+
 type InitializeOptions struct {
 	// When set, the execution of datasources will be skipped and the datasource will provide
 	// an output spec that will be used for validation only.
 	SkipDatasourcesExecution bool
+	// DatasourceParallelism is the maximum number of datasources evaluated
+	// concurrently, 0 meaning no limit.
+	DatasourceParallelism int
+	// When set, data sources whose outputs are cached are executed again,
+	// refreshing their cache.
+	RefreshDatasources bool
 }
 
 type PluginBinaryDetector interface {
@@ -57,6 +80,7 @@ type Handler interface {
 	PluginRequirements() (plugingetter.Requirements, hcl.Diagnostics)
 	Evaluator
 	BuildGetter
+	OutputEvaluator
 	ConfigFixer
 	ConfigInspector
 	PluginBinaryDetector
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 
 	checkpoint "github.com/hashicorp/go-checkpoint"
@@ -41,6 +42,8 @@ type PackerReport struct {
 }
 
 type CheckpointTelemetry struct {
+	// spansLock guards spans, as data sources can be executed concurrently.
+	spansLock     sync.Mutex
 	spans         []*TelemetrySpan
 	signatureFile string
 	startTime     time.Time
@@ -117,7 +120,9 @@ func (c *CheckpointTelemetry) AddSpan(name, pluginType string, options interface
 		StartTime: time.Now().UTC(),
 		Type:      pluginType,
 	}
+	c.spansLock.Lock()
 	c.spans = append(c.spans, ts)
+	c.spansLock.Unlock()
 	return ts
 }
 
@@ -146,6 +151,8 @@ func (c *CheckpointTelemetry) Finalize(command string, errCode int, err error) e
 	params := c.baseParams(TelemetryVersion)
 	params.EndTime = time.Now().UTC()
 
+	c.spansLock.Lock()
+	defer c.spansLock.Unlock()
 	extra := &PackerReport{
 		Spans:    c.spans,
 		ExitCode: errCode,
@@ -5,18 +5,22 @@ package packer
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 	"unicode"
 
 	getter "github.com/hashicorp/go-getter/v2"
+	"github.com/hashicorp/hcl/v2"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
@@ -122,14 +126,26 @@ func (u *TargetedUI) Ask(query string) (string, error) {
 }
 
 func (u *TargetedUI) Say(message string) {
+	if tu, ok := u.Ui.(targetedUi); ok {
+		tu.targetedMessage(u.Target, "say", message)
+		return
+	}
 	u.Ui.Say(u.prefixLines(true, message))
 }
 
 func (u *TargetedUI) Message(message string) {
+	if tu, ok := u.Ui.(targetedUi); ok {
+		tu.targetedMessage(u.Target, "message", message)
+		return
+	}
 	u.Ui.Message(u.prefixLines(false, message))
 }
 
 func (u *TargetedUI) Error(message string) {
+	if tu, ok := u.Ui.(targetedUi); ok {
+		tu.targetedMessage(u.Target, "error", message)
+		return
+	}
 	u.Ui.Error(u.prefixLines(true, message))
 }
 
@@ -157,6 +173,57 @@ func (u *TargetedUI) TrackProgress(src string, currentSize, totalSize int64, str
 	return u.Ui.TrackProgress(u.prefixLines(false, src), currentSize, totalSize, stream)
 }
 
+// prefixedUi prefixes each line of the messages of Ui with Prefix, to tell
+// apart the output of provisioners running concurrently.
+type prefixedUi struct {
+	Prefix string
+	packersdk.Ui
+}
+
+func (u *prefixedUi) Ask(query string) (string, error) {
+	return u.Ui.Ask(u.prefixLines(query))
+}
+
+func (u *prefixedUi) Say(message string) {
+	u.Ui.Say(u.prefixLines(message))
+}
+
+func (u *prefixedUi) Message(message string) {
+	u.Ui.Message(u.prefixLines(message))
+}
+
+func (u *prefixedUi) Error(message string) {
+	u.Ui.Error(u.prefixLines(message))
+}
+
+func (u *prefixedUi) prefixLines(message string) string {
+	lines := strings.Split(message, "\n")
+	for i, line := range lines {
+		lines[i] = fmt.Sprintf("[%s] %s", u.Prefix, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// targetedUi is implemented by UIs that keep track of the target of a message
+// themselves, TargetedUI hands them messages as is instead of prefixing them
+// with the target.
+type targetedUi interface {
+	targetedMessage(target, level, message string)
+}
+
+// machineDuration formats d for machine-readable output, in seconds.
+func machineDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// machineError formats err for machine-readable output, nil being empty.
+func machineError(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
 // MachineReadableUi is a UI that only outputs machine-readable output
 // to the given Writer.
 type MachineReadableUi struct {
@@ -182,6 +249,18 @@ func (u *MachineReadableUi) Error(message string) {
 	u.Machine("ui", "error", message)
 }
 
+// jsonOnlyEvents are the categories of the machine-readable messages only
+// sent for the events of the JSON output of `-output=json`; they are left out
+// of the machine-readable output, whose format does not change.
+var jsonOnlyEvents = map[string]bool{
+	"build-start":          true,
+	"build-end":            true,
+	"provisioner-start":    true,
+	"provisioner-end":      true,
+	"post-processor-start": true,
+	"post-processor-end":   true,
+}
+
 func (u *MachineReadableUi) Machine(category string, args ...string) {
 	now := time.Now().UTC()
 
@@ -192,6 +271,9 @@ func (u *MachineReadableUi) Machine(category string, args ...string) {
 		target = category[0:commaIdx]
 		category = category[commaIdx+1:]
 	}
+	if jsonOnlyEvents[category] {
+		return
+	}
 
 	// Prepare the args
 	for i, v := range args {
@@ -255,3 +337,260 @@ func (u *TimestampedUi) TrackProgress(src string, currentSize, totalSize int64,
 func (u *TimestampedUi) timestampLine(string string) string {
 	return fmt.Sprintf("%v: %v", time.Now().Format(time.RFC3339), string)
 }
+
+// JSONUi is a UI that outputs a stream of newline-delimited JSON events to the
+// given Writer, one JSONEvent per line.
+//
+// Machine-readable messages are turned into structured events: the messages
+// describing an artifact, for example, are gathered into a single artifact
+// event.
+type JSONUi struct {
+	Writer io.Writer
+	PB     packersdk.NoopProgressTracker
+
+	l         sync.Mutex
+	artifacts map[string]*JSONArtifact
+}
+
+var _ packersdk.Ui = new(JSONUi)
+
+// JSONEvent is a single event of the output of a JSONUi.
+type JSONEvent struct {
+	Timestamp time.Time `json:"@timestamp"`
+	// Type is one of ui, build-start, build-end, provisioner-start,
+	// provisioner-end, post-processor-start, post-processor-end, artifact,
+	// output and diagnostic; or the category of any other machine-readable
+	// message.
+	Type string `json:"type"`
+	// Target is the build the event is about, if any.
+	Target string `json:"target,omitempty"`
+
+	// Level and Message are set for ui events, Level is one of say, message
+	// and error.
+	Level   string `json:"level,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	// Component is the type of the provisioner or post-processor of the
+	// event, and Name the name of the post-processor or of the output.
+	Component string `json:"component,omitempty"`
+	Name      string `json:"name,omitempty"`
+	// Duration of the build, provisioner or post-processor, in seconds; set
+	// on *-end events.
+	Duration float64 `json:"duration_seconds,omitempty"`
+	// Error is set on *-end events of a step that failed.
+	Error string `json:"error,omitempty"`
+
+	// Value is the value of an output, in JSON.
+	Value json.RawMessage `json:"value,omitempty"`
+
+	Artifact   *JSONArtifact   `json:"artifact,omitempty"`
+	Diagnostic *JSONDiagnostic `json:"diagnostic,omitempty"`
+
+	// Args are the arguments of machine-readable messages that do not have a
+	// structured event.
+	Args []string `json:"args,omitempty"`
+}
+
+// JSONArtifact describes an artifact produced by a build.
+type JSONArtifact struct {
+	Index     int      `json:"index"`
+	BuilderID string   `json:"builder_id,omitempty"`
+	ID        string   `json:"id,omitempty"`
+	String    string   `json:"string,omitempty"`
+	Files     []string `json:"files,omitempty"`
+}
+
+// JSONDiagnostic is an HCL diagnostic, with the range of the configuration it
+// is about.
+type JSONDiagnostic struct {
+	Severity string     `json:"severity"`
+	Summary  string     `json:"summary"`
+	Detail   string     `json:"detail,omitempty"`
+	Range    *JSONRange `json:"range,omitempty"`
+}
+
+// JSONRange is the range of a configuration file a diagnostic is about.
+type JSONRange struct {
+	Filename string  `json:"filename"`
+	Start    JSONPos `json:"start"`
+	End      JSONPos `json:"end"`
+}
+
+// JSONPos is a position in a configuration file.
+type JSONPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Byte   int `json:"byte"`
+}
+
+func (u *JSONUi) Ask(query string) (string, error) {
+	return "", errors.New("json UI can't ask")
+}
+
+func (u *JSONUi) Say(message string) {
+	u.targetedMessage("", "say", message)
+}
+
+func (u *JSONUi) Message(message string) {
+	u.targetedMessage("", "message", message)
+}
+
+func (u *JSONUi) Error(message string) {
+	u.targetedMessage("", "error", message)
+}
+
+func (u *JSONUi) targetedMessage(target, level, message string) {
+	u.write(JSONEvent{
+		Type:    "ui",
+		Target:  target,
+		Level:   level,
+		Message: packersdk.LogSecretFilter.FilterString(message),
+	})
+}
+
+func (u *JSONUi) Machine(category string, args ...string) {
+	// Determine if we have a target, and set it
+	target := ""
+	commaIdx := strings.Index(category, ",")
+	if commaIdx > -1 {
+		target = category[0:commaIdx]
+		category = category[commaIdx+1:]
+	}
+
+	filtered := make([]string, len(args))
+	for i, v := range args {
+		filtered[i] = packersdk.LogSecretFilter.FilterString(v)
+	}
+	arg := func(i int) string {
+		if i < len(filtered) {
+			return filtered[i]
+		}
+		return ""
+	}
+	seconds := func(s string) float64 {
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	}
+
+	event := JSONEvent{Type: category, Target: target}
+	switch category {
+	case "build-start":
+	case "build-end":
+		event.Duration = seconds(arg(0))
+		event.Error = arg(1)
+	case "provisioner-start":
+		event.Component = arg(0)
+	case "provisioner-end":
+		event.Component = arg(0)
+		event.Duration = seconds(arg(1))
+		event.Error = arg(2)
+	case "post-processor-start":
+		event.Component = arg(0)
+		event.Name = arg(1)
+	case "post-processor-end":
+		event.Component = arg(0)
+		event.Name = arg(1)
+		event.Duration = seconds(arg(2))
+		event.Error = arg(3)
+	case "artifact":
+		artifact := u.artifact(target, arg(0), arg(1), arg(2), arg(3))
+		if artifact == nil {
+			return
+		}
+		event.Artifact = artifact
+	case "output":
+		event.Name = arg(0)
+		event.Value = json.RawMessage(arg(1))
+		if !json.Valid(event.Value) {
+			// the value of a sensitive output is hidden
+			event.Value, _ = json.Marshal(arg(1))
+		}
+	default:
+		event.Args = filtered
+	}
+	u.write(event)
+}
+
+// artifact gathers the `artifact` machine-readable messages of an artifact;
+// the artifact is returned once its end message is received.
+func (u *JSONUi) artifact(target, index, key, value, file string) *JSONArtifact {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	if u.artifacts == nil {
+		u.artifacts = map[string]*JSONArtifact{}
+	}
+	id := target + "," + index
+	artifact, ok := u.artifacts[id]
+	if !ok {
+		i, _ := strconv.Atoi(index)
+		artifact = &JSONArtifact{Index: i}
+		u.artifacts[id] = artifact
+	}
+
+	switch key {
+	case "builder-id":
+		artifact.BuilderID = value
+	case "id":
+		artifact.ID = value
+	case "string":
+		artifact.String = value
+	case "file":
+		artifact.Files = append(artifact.Files, file)
+	case "end":
+		delete(u.artifacts, id)
+		return artifact
+	}
+	return nil
+}
+
+// Diagnostics outputs a diagnostic event for each of diags.
+func (u *JSONUi) Diagnostics(diags hcl.Diagnostics) {
+	for _, diag := range diags {
+		jsonDiag := &JSONDiagnostic{
+			Severity: "error",
+			Summary:  packersdk.LogSecretFilter.FilterString(diag.Summary),
+			Detail:   packersdk.LogSecretFilter.FilterString(diag.Detail),
+		}
+		if diag.Severity == hcl.DiagWarning {
+			jsonDiag.Severity = "warning"
+		}
+		if rng := diag.Subject; rng != nil {
+			jsonDiag.Range = &JSONRange{
+				Filename: rng.Filename,
+				Start:    JSONPos{rng.Start.Line, rng.Start.Column, rng.Start.Byte},
+				End:      JSONPos{rng.End.Line, rng.End.Column, rng.End.Byte},
+			}
+		}
+		u.write(JSONEvent{
+			Type:       "diagnostic",
+			Diagnostic: jsonDiag,
+		})
+	}
+}
+
+func (u *JSONUi) write(event JSONEvent) {
+	event.Timestamp = time.Now().UTC()
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[ERR] failed to encode json event: %s", err)
+		return
+	}
+
+	u.l.Lock()
+	_, err = fmt.Fprintf(u.Writer, "%s\n", line)
+	u.l.Unlock()
+	if err != nil {
+		if err == syscall.EPIPE || strings.Contains(err.Error(), "broken pipe") {
+			// Ignore epipe errors because that just means that the file
+			// is probably closed or going to /dev/null or something.
+		} else {
+			panic(err)
+		}
+	}
+	log.Printf("%s", line)
+}
+
+func (u *JSONUi) TrackProgress(src string, currentSize, totalSize int64, stream io.ReadCloser) (body io.ReadCloser) {
+	return u.PB.TrackProgress(src, currentSize, totalSize, stream)
+}
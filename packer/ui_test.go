@@ -5,6 +5,7 @@ package packer
 
 import (
 	"bytes"
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -298,3 +299,92 @@ func TestMachineReadableUi(t *testing.T) {
 		t.Fatalf("bad: %#v", data)
 	}
 }
+
+func TestMachineReadableUi_jsonOnlyEvents(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ui := &MachineReadableUi{Writer: buf}
+
+	ui.Machine("null.foo,build-start")
+	ui.Machine("null.foo,provisioner-end", "shell", "1.500", "")
+	if buf.Len() != 0 {
+		t.Fatalf("the events of the JSON output should not be machine-readable messages, got %q", buf.String())
+	}
+}
+
+func TestJSONUi_ImplUi(t *testing.T) {
+	var raw interface{}
+	raw = &JSONUi{}
+	if _, ok := raw.(packersdk.Ui); !ok {
+		t.Fatalf("JSONUi must implement Ui")
+	}
+}
+
+func TestJSONUi(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ui := &TargetedUI{
+		Target: "null.foo",
+		Ui:     &JSONUi{Writer: buf},
+	}
+
+	readEvents := func() []JSONEvent {
+		var events []JSONEvent
+		dec := json.NewDecoder(buf)
+		for dec.More() {
+			var event JSONEvent
+			if err := dec.Decode(&event); err != nil {
+				t.Fatalf("bad json output: %s", err)
+			}
+			events = append(events, event)
+		}
+		buf.Reset()
+		return events
+	}
+
+	ui.Say("foo\nbar")
+	events := readEvents()
+	if len(events) != 1 {
+		t.Fatalf("expected one event, got %#v", events)
+	}
+	if ev := events[0]; ev.Type != "ui" || ev.Target != "null.foo" || ev.Level != "say" || ev.Message != "foo\nbar" {
+		t.Fatalf("bad ui event: %#v", ev)
+	}
+
+	ui.Machine("provisioner-end", "shell", "1.500", "exit status 1")
+	events = readEvents()
+	if ev := events[0]; ev.Type != "provisioner-end" || ev.Component != "shell" || ev.Duration != 1.5 || ev.Error != "exit status 1" {
+		t.Fatalf("bad provisioner-end event: %#v", ev)
+	}
+
+	ui.Machine("artifact", "0", "builder-id", "packer.null")
+	ui.Machine("artifact", "0", "id", "42")
+	ui.Machine("artifact", "0", "files-count", "2")
+	ui.Machine("artifact", "0", "file", "0", "a.txt")
+	ui.Machine("artifact", "0", "file", "1", "b.txt")
+	ui.Machine("artifact", "0", "end")
+	events = readEvents()
+	if len(events) != 1 {
+		t.Fatalf("expected a single artifact event, got %#v", events)
+	}
+	artifact := events[0].Artifact
+	if artifact == nil || artifact.BuilderID != "packer.null" || artifact.ID != "42" ||
+		strings.Join(artifact.Files, ",") != "a.txt,b.txt" {
+		t.Fatalf("bad artifact event: %#v", events[0])
+	}
+
+	ui.Machine("output", "ami_id", `"ami-42"`)
+	ui.Machine("output", "password", "<sensitive>")
+	events = readEvents()
+	if ev := events[0]; ev.Type != "output" || ev.Name != "ami_id" || string(ev.Value) != `"ami-42"` {
+		t.Fatalf("bad output event: %#v", ev)
+	}
+	var password string
+	if ev := events[1]; ev.Name != "password" || json.Unmarshal(ev.Value, &password) != nil || password != "<sensitive>" {
+		t.Fatalf("bad sensitive output event: %#v", ev)
+	}
+
+	ui.Machine("foo", "bar", "baz")
+	events = readEvents()
+	if ev := events[0]; ev.Type != "foo" || strings.Join(ev.Args, ",") != "bar,baz" {
+		t.Fatalf("bad machine event: %#v", ev)
+	}
+}